@@ -52,11 +52,14 @@ import (
 	"time"
 
 	"github.com/akramboussanni/marchive/config"
+	"github.com/akramboussanni/marchive/internal/anna"
 	"github.com/akramboussanni/marchive/internal/api/routes"
 	"github.com/akramboussanni/marchive/internal/db"
+	"github.com/akramboussanni/marchive/internal/events"
 	"github.com/akramboussanni/marchive/internal/model"
 	"github.com/akramboussanni/marchive/internal/repo"
 	"github.com/akramboussanni/marchive/internal/services"
+	"github.com/akramboussanni/marchive/internal/storage"
 	"github.com/akramboussanni/marchive/internal/utils"
 )
 
@@ -116,17 +119,53 @@ func main() {
 
 	createDefaultAdmin(repos)
 
-	downloadService := services.NewDownloadService(repos, config.App.DownloadDir, config.App.AnnasApiKey)
+	source, err := anna.NewSource(config.App.BookSource, anna.SourceOptions{
+		APIKeys:        append([]string{config.App.AnnasApiKey}, config.App.AnnasApiKeys...),
+		DailyQuota:     config.App.AnnasDailyQuota,
+		KeyUsage:       repos.APIKeyUsage,
+		Mirrors:        config.App.AnnasMirrors,
+		MirrorCooldown: time.Duration(config.App.AnnasMirrorCooldown) * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("failed to create book source: %v", err)
+	}
+
+	store, err := storage.New(storage.Config{
+		Backend:     config.App.StorageBackend,
+		LocalRoot:   config.App.DownloadDir,
+		S3Endpoint:  config.App.S3Endpoint,
+		S3Region:    config.App.S3Region,
+		S3Bucket:    config.App.S3Bucket,
+		S3AccessKey: config.App.S3AccessKey,
+		S3SecretKey: config.App.S3SecretKey,
+		S3PathStyle: config.App.S3PathStyle,
+	})
+	if err != nil {
+		log.Fatalf("failed to create storage backend: %v", err)
+	}
+
+	hub := events.NewHub()
+
+	limits := services.StorageLimits{
+		CapBytes: config.App.StorageCapMB << 20,
+		Policy:   config.App.StorageEvictionPolicy,
+	}
+	downloadService := services.NewDownloadService(repos, config.App.DownloadDir, store, limits, source, config.App.DownloadWorkers, hub)
+	searchCache := services.NewSearchCache(repos.SearchCache, source, time.Duration(config.App.SearchCacheTTL)*time.Second)
 	ctx, cancel := context.WithCancel(context.Background())
 	go downloadService.StartService(ctx)
+	go searchCache.StartCleanup(ctx)
 
-	r := routes.SetupRouter(repos)
+	r := routes.SetupRouter(repos, source, hub, downloadService, searchCache, store)
 
 	port := strconv.Itoa(config.App.AppPort)
 	server := &http.Server{
 		Addr:    ":" + port,
 		Handler: r,
 	}
+	// Event streams stay open until the client leaves, so end them when
+	// shutting down instead of waiting them out
+	server.RegisterOnShutdown(hub.Close)
 
 	if config.App.TLSEnabled {
 		if config.App.TLSCertFile == "" || config.App.TLSKeyFile == "" {
@@ -148,15 +187,25 @@ func main() {
 	}
 
 	quit := make(chan os.Signal, 1)
+	shutdownDone := make(chan struct{})
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
+		defer close(shutdownDone)
 		<-quit
 		log.Println("shutting down server...")
 		cancel()
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer shutdownCancel()
 		if err := server.Shutdown(shutdownCtx); err != nil {
-			log.Fatalf("server forced to shutdown: %v", err)
+			// Still let the downloads drain below before exiting
+			log.Printf("server forced to shutdown: %v", err)
+			server.Close()
+		}
+
+		downloadCtx, downloadCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer downloadCancel()
+		if err := downloadService.Shutdown(downloadCtx); err != nil {
+			log.Printf("aborted unfinished downloads, they will resume on next start: %v", err)
 		}
 		log.Println("server exited gracefully")
 	}()
@@ -177,4 +226,6 @@ func main() {
 			log.Fatalf("error when starting server: %v", err)
 		}
 	}
+
+	<-shutdownDone
 }
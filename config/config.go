@@ -29,8 +29,31 @@ type AppConfig struct {
 
 	JwtExpirations map[string]int64 `env:"JWT_EXPIRATIONS" default:"{\"credential\":900,\"refresh\":129600}"`
 
-	AnnasApiKey string `env:"ANNAS_API_KEY" panic:"true"`
+	AnnasApiKey     string   `env:"ANNAS_API_KEY" panic:"true"`
+	AnnasApiKeys    []string `env:"ANNAS_API_KEYS"`
+	AnnasDailyQuota int      `env:"ANNAS_DAILY_QUOTA" default:"0"`
+
 	DownloadDir string `env:"DOWNLOAD_DIR" default:"./downloads"`
+	BookSource  string `env:"BOOK_SOURCE" default:"anna"`
+
+	DownloadWorkers int `env:"DOWNLOAD_WORKERS" default:"3"`
+
+	StorageBackend  string `env:"STORAGE_BACKEND" default:"local"`
+	S3Endpoint      string `env:"S3_ENDPOINT"`
+	S3Region        string `env:"S3_REGION" default:"us-east-1"`
+	S3Bucket        string `env:"S3_BUCKET"`
+	S3AccessKey     string `env:"S3_ACCESS_KEY"`
+	S3SecretKey     string `env:"S3_SECRET_KEY"`
+	S3PathStyle     bool   `env:"S3_PATH_STYLE" default:"false"`
+	S3PresignExpiry int64  `env:"S3_PRESIGN_EXPIRY" default:"900"`
+
+	StorageCapMB          int64  `env:"STORAGE_CAP_MB" default:"0"`
+	StorageEvictionPolicy string `env:"STORAGE_EVICTION_POLICY" default:"lru"`
+
+	AnnasMirrors        []string `env:"ANNAS_MIRRORS" default:"https://annas-archive.pm,https://annas-archive.li,https://annas-archive.se,https://annas-archive.org"`
+	AnnasMirrorCooldown int64    `env:"ANNAS_MIRROR_COOLDOWN" default:"300"`
+
+	SearchCacheTTL int64 `env:"SEARCH_CACHE_TTL" default:"3600"`
 }
 
 var App AppConfig
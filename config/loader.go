@@ -64,9 +64,15 @@ var kindFuncs map[reflect.Kind](func(string) (any, error)) = map[reflect.Kind](f
 func setField(field reflect.Value, envTag string, shouldPanic string, defaultTag string) {
 	switch field.Kind() {
 	case reflect.String:
-		field.SetString(os.Getenv(envTag))
+		value := os.Getenv(envTag)
+		if value == "" {
+			value = defaultTag
+		}
+		field.SetString(value)
 	case reflect.Map:
 		parseMapField(field, envTag, shouldPanic, defaultTag)
+	case reflect.Slice:
+		parseSliceField(field, envTag, defaultTag)
 	default:
 		kindFunc, ok := kindFuncs[field.Kind()]
 		if !ok {
@@ -113,6 +119,26 @@ func parseMapField(field reflect.Value, envTag string, shouldPanic string, defau
 	}
 }
 
+// parseSliceField reads a comma-separated list into a []string field
+func parseSliceField(field reflect.Value, envTag string, defaultTag string) {
+	if field.Type().Elem().Kind() != reflect.String {
+		panic("unsupported slice element type: " + field.Type().Elem().Kind().String())
+	}
+
+	envValue := os.Getenv(envTag)
+	if envValue == "" {
+		envValue = defaultTag
+	}
+
+	values := make([]string, 0)
+	for _, part := range strings.Split(envValue, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			values = append(values, trimmed)
+		}
+	}
+	field.Set(reflect.ValueOf(values))
+}
+
 func ParseSafely[T any](input string, fun func(string) (T, error), envTag, shouldPanic, defaultTag string) T {
 	val, err := fun(input)
 	if err != nil {
@@ -38,6 +38,7 @@ export interface SearchRequest {
   limit?: number
   offset?: number
   search_type?: 'all' | 'downloaded' | 'missing'
+  cursor?: string
 }
 
 export interface SearchResponse {
@@ -47,6 +48,7 @@ export interface SearchResponse {
   query: string
   search_type: string
   pagination: Pagination
+  next_cursor?: string
 }
 
 export interface ToggleFavoriteRequest {
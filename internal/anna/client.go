@@ -0,0 +1,133 @@
+package anna
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	AnnasBaseURL          = "https://annas-archive.pm"
+	AnnasSearchEndpoint   = "%s/search?%s"
+	AnnasDownloadEndpoint = "%s/dyn/api/fast_download.json?md5=%s&key=%s"
+)
+
+// Client is the Anna's Archive implementation of BookSource
+type Client struct {
+	mirrors    *MirrorPool
+	keys       *KeyPool
+	httpClient *http.Client
+}
+
+func init() {
+	RegisterSource("anna", func(opts SourceOptions) (BookSource, error) {
+		return NewClient(opts), nil
+	})
+}
+
+func NewClient(opts SourceOptions) *Client {
+	mirrors := opts.Mirrors
+	if len(mirrors) == 0 {
+		mirrors = []string{AnnasBaseURL}
+	}
+
+	return &Client{
+		mirrors:    NewMirrorPool(mirrors, opts.MirrorCooldown),
+		keys:       NewKeyPool(opts.APIKeys, opts.DailyQuota, opts.KeyUsage),
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (c *Client) Search(ctx context.Context, query SearchQuery) ([]*Book, error) {
+	return c.FindBook(ctx, query)
+}
+
+func (c *Client) Metadata(ctx context.Context, hash string) (*Book, error) {
+	return c.GetBookMetadata(ctx, hash)
+}
+
+// MirrorStatus reports the health of every configured mirror
+func (c *Client) MirrorStatus() []MirrorStatus {
+	return c.mirrors.Status()
+}
+
+// KeyStatus reports today's fast download usage of every API key
+func (c *Client) KeyStatus() []KeyStatus {
+	return c.keys.Status()
+}
+
+// ResolveDownload asks the fast download API for a direct link to the file.
+// Keys are used in rotation and a key that Anna reports as spent is benched
+// for the day; when none are left a *QuotaExhaustedError is returned.
+func (c *Client) ResolveDownload(ctx context.Context, hash string) (*DownloadLink, error) {
+	for {
+		key, err := c.keys.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		link, info, err := c.resolveWithKey(ctx, hash, key.secret)
+		if err == nil {
+			c.keys.reportSuccess(ctx, key, info)
+			return link, nil
+		}
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && c.keys.reportError(ctx, key, apiErr) {
+			continue
+		}
+		return nil, err
+	}
+}
+
+// resolveWithKey resolves a link with one key, failing over to the next
+// mirror when one is unreachable
+func (c *Client) resolveWithKey(ctx context.Context, hash, secretKey string) (*DownloadLink, *fastDownloadInfo, error) {
+	var link *DownloadLink
+	var info *fastDownloadInfo
+	mirror, err := c.mirrors.try(ctx, func(baseURL string) error {
+		var err error
+		link, info, err = c.resolveDownload(ctx, baseURL, hash, secretKey)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	link.Mirror = mirror
+	return link, info, nil
+}
+
+func (c *Client) resolveDownload(ctx context.Context, baseURL, hash, secretKey string) (*DownloadLink, *fastDownloadInfo, error) {
+	apiURL := fmt.Sprintf(AnnasDownloadEndpoint, baseURL, url.QueryEscape(hash), url.QueryEscape(secretKey))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, &mirrorFailure{err: err}
+	}
+	defer resp.Body.Close()
+
+	var apiResp fastDownloadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, nil, &mirrorFailure{err: fmt.Errorf("invalid fast download response (status %d): %w", resp.StatusCode, err)}
+	}
+	if apiResp.DownloadURL == "" {
+		if apiResp.Error != "" {
+			return nil, nil, &APIError{Message: apiResp.Error}
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return nil, nil, &mirrorFailure{err: &StatusError{Op: "fast download API", StatusCode: resp.StatusCode}}
+		}
+		return nil, nil, errors.New("failed to get download URL")
+	}
+
+	return &DownloadLink{URL: apiResp.DownloadURL}, apiResp.AccountInfo, nil
+}
@@ -0,0 +1,231 @@
+package anna
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProgressFunc receives the number of bytes written so far and the expected
+// total, which is -1 when the server did not send a Content-Length
+type ProgressFunc func(written, total int64)
+
+type progressWriter struct {
+	written    int64
+	total      int64
+	onProgress ProgressFunc
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.written += int64(len(p))
+	if pw.onProgress != nil {
+		pw.onProgress(pw.written, pw.total)
+	}
+	return len(p), nil
+}
+
+// PartialPath is where the unfinished download of a book is kept. It only
+// depends on the hash so an interrupted transfer can be found again after a
+// restart. Hashes that are not an MD5 are refused.
+func PartialPath(folderPath, hash string) (string, error) {
+	if !IsMD5(hash) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidHash, hash)
+	}
+	return filepath.Join(folderPath, strings.ToLower(hash)+".part"), nil
+}
+
+// StoredFilename is the name a book file is kept under on disk. It is built
+// from the hash so books sharing a title never overwrite each other. Hashes
+// that are not an MD5 are refused.
+func StoredFilename(hash, format string) (string, error) {
+	if !IsMD5(hash) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidHash, hash)
+	}
+	name := strings.ToLower(hash)
+	if format = strings.ToLower(strings.TrimSpace(format)); format != "" {
+		name += "." + sanitizeFilename(format)
+	}
+	return name, nil
+}
+
+// DisplayFilename is the human readable name offered to users downloading
+// the book. Files were stored under this name before StoredFilename existed.
+func DisplayFilename(title, format string) string {
+	return sanitizeFilename(title) + "." + format
+}
+
+// Download resolves a download link for the book through src and streams
+// the file into folderPath, reporting progress to onProgress if set. It
+// returns the path of the finished file.
+//
+// Bytes go to a .part file first. If one is left over from an interrupted
+// attempt the transfer resumes from its end with a Range request, and the
+// file is only renamed into place once it is complete and hashes to the
+// book's MD5.
+func (b *Book) Download(ctx context.Context, src BookSource, folderPath string, onProgress ProgressFunc) (string, error) {
+	partPath, err := PartialPath(folderPath, b.Hash)
+	if err != nil {
+		return "", err
+	}
+
+	link, err := src.ResolveDownload(ctx, b.Hash)
+	if err != nil {
+		return "", err
+	}
+	b.Mirror = link.Mirror
+
+	out, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	info, err := out.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	downloadResp, offset, err := openRange(ctx, link.URL, info.Size())
+	if err != nil {
+		return "", err
+	}
+	defer downloadResp.Body.Close()
+
+	// Drop anything past the offset the server agreed to resume from
+	if err := out.Truncate(offset); err != nil {
+		return "", err
+	}
+
+	// Hash what is already on disk so the checksum covers the whole file
+	hasher := md5.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(out, 0, offset)); err != nil {
+		return "", err
+	}
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	total := int64(-1)
+	if downloadResp.ContentLength >= 0 {
+		total = offset + downloadResp.ContentLength
+	}
+
+	progress := &progressWriter{written: offset, total: total, onProgress: onProgress}
+	if onProgress != nil {
+		onProgress(offset, total)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(out, hasher, progress), downloadResp.Body); err != nil {
+		return "", err
+	}
+	if total >= 0 && progress.written != total {
+		return "", fmt.Errorf("%w: got %d of %d bytes", ErrIncompleteDownload, progress.written, total)
+	}
+
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if !strings.EqualFold(actual, b.Hash) {
+		// A bad .part is useless for resuming, start over next time
+		out.Close()
+		os.Remove(partPath)
+		return "", &ChecksumError{
+			Expected:    strings.ToLower(b.Hash),
+			Actual:      actual,
+			Size:        progress.written,
+			ContentType: downloadResp.Header.Get("Content-Type"),
+		}
+	}
+
+	if err := out.Sync(); err != nil {
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+
+	name, err := StoredFilename(b.Hash, b.Format)
+	if err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(folderPath, name)
+	if err := os.Rename(partPath, filePath); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// ChecksumError is returned when a downloaded file does not hash to the MD5
+// the book is known by
+type ChecksumError struct {
+	Expected    string
+	Actual      string
+	Size        int64
+	ContentType string
+}
+
+func (e *ChecksumError) Error() string {
+	msg := fmt.Sprintf("downloaded file failed verification: expected md5 %s, got %s (%d bytes)", e.Expected, e.Actual, e.Size)
+	if strings.HasPrefix(e.ContentType, "text/html") {
+		msg += "; the server sent an HTML page instead of the book"
+	}
+	return msg
+}
+
+// FileMD5 returns the hex encoded MD5 of the file at path
+func FileMD5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := md5.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// openRange requests url starting at offset and returns the response along
+// with the offset the server actually honoured, which is 0 when it ignored
+// or rejected the Range header
+func openRange(ctx context.Context, url string, offset int64) (*http.Response, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, 0, nil
+	case http.StatusPartialContent:
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			resp.Body.Close()
+			return openRange(ctx, url, 0)
+		}
+		return resp, offset, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		if offset == 0 {
+			return nil, 0, &StatusError{Op: "file download", StatusCode: resp.StatusCode}
+		}
+		return openRange(ctx, url, 0)
+	default:
+		resp.Body.Close()
+		return nil, 0, &StatusError{Op: "file download", StatusCode: resp.StatusCode}
+	}
+}
@@ -0,0 +1,65 @@
+package anna
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartialPath(t *testing.T) {
+	dir := filepath.Join("data", "downloads")
+	tests := []struct {
+		hash string
+		want string
+	}{
+		{"d41d8cd98f00b204e9800998ecf8427e", filepath.Join(dir, "d41d8cd98f00b204e9800998ecf8427e.part")},
+		{"D41D8CD98F00B204E9800998ECF8427E", filepath.Join(dir, "d41d8cd98f00b204e9800998ecf8427e.part")},
+		{"", ""},
+		{"../../x", ""},
+		{"../../../../../../../../etc/passwd", ""},
+		{"d41d8cd98f00b204e9800998ecf8427", ""},
+		{"d41d8cd98f00b204e9800998ecf8427z", ""},
+		{"upload_1_0123456789abcdef", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := PartialPath(dir, tt.hash)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("PartialPath(%q) = %q, %v, want ErrInvalidHash", tt.hash, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("PartialPath(%q) = %q, %v, want %q", tt.hash, got, err, tt.want)
+		}
+	}
+}
+
+func TestStoredFilename(t *testing.T) {
+	tests := []struct {
+		hash, format string
+		want         string
+	}{
+		{"d41d8cd98f00b204e9800998ecf8427e", "epub", "d41d8cd98f00b204e9800998ecf8427e.epub"},
+		{"D41D8CD98F00B204E9800998ECF8427E", " PDF ", "d41d8cd98f00b204e9800998ecf8427e.pdf"},
+		{"d41d8cd98f00b204e9800998ecf8427e", "", "d41d8cd98f00b204e9800998ecf8427e"},
+		{"d41d8cd98f00b204e9800998ecf8427e", "../x", "d41d8cd98f00b204e9800998ecf8427e...x"},
+		{"../../x", "epub", ""},
+		{"/etc/passwd", "", ""},
+		{"upload_1_0123456789abcdef", "epub", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := StoredFilename(tt.hash, tt.format)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("StoredFilename(%q, %q) = %q, %v, want ErrInvalidHash", tt.hash, tt.format, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("StoredFilename(%q, %q) = %q, %v, want %q", tt.hash, tt.format, got, err, tt.want)
+		}
+	}
+}
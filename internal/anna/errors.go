@@ -0,0 +1,80 @@
+package anna
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrAllMirrorsFailed   = errors.New("all Anna mirrors failed")
+	ErrIncompleteDownload = errors.New("download ended early")
+	// ErrInvalidHash is returned for a book hash that is not an MD5, before it
+	// can become part of a file name
+	ErrInvalidHash = errors.New("invalid book hash")
+)
+
+// StatusError is an unexpected HTTP status from Anna or the host serving the file
+type StatusError struct {
+	Op         string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.Op, e.StatusCode)
+}
+
+// APIError is an error message returned by the fast download API
+type APIError struct {
+	Message string
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// rateLimitHints are fragments of fast download API messages that mean the
+// request may succeed later
+var rateLimitHints = []string{"too many", "rate limit", "try again", "slow down"}
+
+// IsTransient reports whether a download error is worth retrying later:
+// network trouble, 5xx responses, rate limits or a truncated transfer.
+// Anything else, such as an unknown hash or a file that does not match its
+// MD5, fails the same way every time.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, ErrAllMirrorsFailed) || errors.Is(err, ErrIncompleteDownload) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		msg := strings.ToLower(apiErr.Message)
+		for _, hint := range rateLimitHints {
+			if strings.Contains(msg, hint) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// An HTML page in place of the book is usually an error or captcha page
+	var checksumErr *ChecksumError
+	if errors.As(err, &checksumErr) {
+		return strings.HasPrefix(checksumErr.ContentType, "text/html")
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,274 @@
+package anna
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoAPIKeys = errors.New("no Anna API keys configured")
+
+// QuotaExhaustedError is returned when every API key has used up its fast
+// downloads for the day. Quotas reset at ResetAt (midnight UTC).
+type QuotaExhaustedError struct {
+	ResetAt time.Time
+}
+
+func (e *QuotaExhaustedError) Error() string {
+	return fmt.Sprintf("all Anna API keys are out of fast downloads until %s", e.ResetAt.Format(time.RFC3339))
+}
+
+// KeyUsage is the usage of one API key on one day, as persisted by a
+// KeyUsageStore
+type KeyUsage struct {
+	KeyID      string
+	Used       int
+	DailyQuota int
+	Exhausted  bool
+	LastError  string
+}
+
+// KeyUsageStore persists key usage so counts survive restarts
+type KeyUsageStore interface {
+	LoadKeyUsage(ctx context.Context, day string) ([]KeyUsage, error)
+	SaveKeyUsage(ctx context.Context, day string, usage KeyUsage) error
+}
+
+// KeyStatus is a snapshot of an API key's health for the current day
+type KeyStatus struct {
+	ID         string `json:"id"`
+	Hint       string `json:"hint,omitempty"`
+	UsedToday  int    `json:"used_today"`
+	DailyQuota int    `json:"daily_quota"`
+	Remaining  int    `json:"remaining"`
+	Healthy    bool   `json:"healthy"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// KeyStatusReporter is implemented by sources that rotate API keys
+type KeyStatusReporter interface {
+	KeyStatus() []KeyStatus
+}
+
+// keyErrorHints are fragments of fast download API messages that mean the
+// key itself can't be used today, so the next key should be tried
+var keyErrorHints = []string{"no downloads left", "downloads left", "quota", "invalid secret key", "not a member", "membership"}
+
+type keyState struct {
+	id        string
+	secret    string
+	used      int
+	quota     int
+	exhausted bool
+	lastError string
+}
+
+func (k *keyState) usable() bool {
+	return !k.exhausted && (k.quota <= 0 || k.used < k.quota)
+}
+
+// KeyPool rotates fast downloads across API keys and keeps count of how many
+// each key used today. A quota of 0 means unknown; the key is used until Anna
+// says it is out.
+type KeyPool struct {
+	mu    sync.Mutex
+	keys  []*keyState
+	quota int
+	store KeyUsageStore
+	day   string
+	next  int
+}
+
+func NewKeyPool(secrets []string, dailyQuota int, store KeyUsageStore) *KeyPool {
+	pool := &KeyPool{quota: dailyQuota, store: store}
+
+	seen := make(map[string]bool)
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		if secret == "" || seen[secret] {
+			continue
+		}
+		seen[secret] = true
+		pool.keys = append(pool.keys, &keyState{id: KeyID(secret), secret: secret, quota: dailyQuota})
+	}
+	return pool
+}
+
+// KeyID identifies a key in storage and admin views without revealing it
+func KeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:6])
+}
+
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// nextReset is the next midnight UTC, when Anna's daily quotas roll over
+func nextReset(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// rollover resets the counters on a new day and loads whatever the store
+// has for it. Callers hold p.mu.
+func (p *KeyPool) rollover(ctx context.Context) {
+	day := usageDay(time.Now())
+	if day == p.day {
+		return
+	}
+	p.day = day
+
+	for _, key := range p.keys {
+		key.used = 0
+		key.quota = p.quota
+		key.exhausted = false
+		key.lastError = ""
+	}
+
+	if p.store == nil {
+		return
+	}
+	usage, err := p.store.LoadKeyUsage(ctx, day)
+	if err != nil {
+		log.Printf("Failed to load API key usage: %v", err)
+		return
+	}
+	for _, u := range usage {
+		for _, key := range p.keys {
+			if key.id != u.KeyID {
+				continue
+			}
+			key.used = u.Used
+			if u.DailyQuota > 0 {
+				key.quota = u.DailyQuota
+			}
+			key.exhausted = u.Exhausted
+			key.lastError = u.LastError
+		}
+	}
+}
+
+// acquire picks the next usable key, round robin
+func (p *KeyPool) acquire(ctx context.Context) (*keyState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.keys) == 0 {
+		return nil, ErrNoAPIKeys
+	}
+	p.rollover(ctx)
+
+	for i := 0; i < len(p.keys); i++ {
+		key := p.keys[(p.next+i)%len(p.keys)]
+		if key.usable() {
+			p.next = (p.next + i + 1) % len(p.keys)
+			return key, nil
+		}
+	}
+	return nil, &QuotaExhaustedError{ResetAt: nextReset(time.Now())}
+}
+
+// reportSuccess counts a fast download against key. info is Anna's own view
+// of the account, when the response carried it.
+func (p *KeyPool) reportSuccess(ctx context.Context, key *keyState, info *fastDownloadInfo) {
+	p.mu.Lock()
+	key.used++
+	if info != nil && info.DownloadsPerDay > 0 {
+		key.quota = info.DownloadsPerDay
+		key.used = info.DownloadsPerDay - info.DownloadsLeft
+	}
+	key.lastError = ""
+	usage := key.usage()
+	p.mu.Unlock()
+
+	p.save(ctx, usage)
+}
+
+// reportError records an API error for key. It reports whether the error
+// was about the key itself, in which case the key is benched for the day
+// and another key may succeed.
+func (p *KeyPool) reportError(ctx context.Context, key *keyState, apiErr *APIError) bool {
+	msg := strings.ToLower(apiErr.Message)
+	keyRelated := false
+	for _, hint := range keyErrorHints {
+		if strings.Contains(msg, hint) {
+			keyRelated = true
+			break
+		}
+	}
+	if !keyRelated {
+		return false
+	}
+
+	p.mu.Lock()
+	key.exhausted = true
+	key.lastError = apiErr.Message
+	usage := key.usage()
+	p.mu.Unlock()
+
+	log.Printf("Anna API key %s benched until %s: %s", key.id, nextReset(time.Now()).Format(time.RFC3339), apiErr.Message)
+	p.save(ctx, usage)
+	return true
+}
+
+func (p *KeyPool) save(ctx context.Context, usage KeyUsage) {
+	if p.store == nil {
+		return
+	}
+	if err := p.store.SaveKeyUsage(ctx, usageDay(time.Now()), usage); err != nil {
+		log.Printf("Failed to save API key usage: %v", err)
+	}
+}
+
+func (k *keyState) usage() KeyUsage {
+	return KeyUsage{
+		KeyID:      k.id,
+		Used:       k.used,
+		DailyQuota: k.quota,
+		Exhausted:  k.exhausted,
+		LastError:  k.lastError,
+	}
+}
+
+// Status reports today's usage of every key
+func (p *KeyPool) Status() []KeyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rollover(context.Background())
+
+	statuses := make([]KeyStatus, 0, len(p.keys))
+	for _, key := range p.keys {
+		remaining := -1
+		if key.quota > 0 {
+			remaining = max(key.quota-key.used, 0)
+		}
+		if key.exhausted {
+			remaining = 0
+		}
+
+		// Short keys are not hinted at, the last characters would give too much away
+		hint := ""
+		if len(key.secret) > 8 {
+			hint = "…" + key.secret[len(key.secret)-4:]
+		}
+
+		statuses = append(statuses, KeyStatus{
+			ID:         key.id,
+			Hint:       hint,
+			UsedToday:  key.used,
+			DailyQuota: key.quota,
+			Remaining:  remaining,
+			Healthy:    key.usable(),
+			LastError:  key.lastError,
+		})
+	}
+	return statuses
+}
@@ -0,0 +1,206 @@
+package anna
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMirrorCooldown is how long a mirror is skipped after its first failure
+const DefaultMirrorCooldown = 5 * time.Minute
+
+// maxMirrorCooldown caps the backoff of a mirror that keeps failing
+const maxMirrorCooldown = 1 * time.Hour
+
+var ErrNoMirrors = errors.New("no Anna mirrors configured")
+
+// MirrorStatus is a snapshot of a mirror's health
+type MirrorStatus struct {
+	URL           string `json:"url"`
+	Healthy       bool   `json:"healthy"`
+	Failures      int    `json:"failures"`
+	LastError     string `json:"last_error,omitempty"`
+	LastSuccess   int64  `json:"last_success,omitempty"`
+	CooldownUntil int64  `json:"cooldown_until,omitempty"`
+}
+
+type mirrorState struct {
+	baseURL       string
+	failures      int
+	lastError     string
+	lastSuccess   time.Time
+	cooldownUntil time.Time
+}
+
+// MirrorPool hands out Anna mirrors in their configured order, skipping the
+// ones that are cooling down after a failure
+type MirrorPool struct {
+	mu       sync.Mutex
+	mirrors  []*mirrorState
+	cooldown time.Duration
+}
+
+// mirrorFailure marks an error as the mirror's fault (unreachable, 5xx, garbage
+// response) rather than an answer from it, so the next mirror gets tried
+type mirrorFailure struct {
+	err error
+}
+
+func (e *mirrorFailure) Error() string { return e.err.Error() }
+func (e *mirrorFailure) Unwrap() error { return e.err }
+
+func NewMirrorPool(urls []string, cooldown time.Duration) *MirrorPool {
+	if cooldown <= 0 {
+		cooldown = DefaultMirrorCooldown
+	}
+
+	pool := &MirrorPool{cooldown: cooldown}
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		pool.mirrors = append(pool.mirrors, &mirrorState{baseURL: u})
+	}
+	return pool
+}
+
+// candidates returns healthy mirrors in configured order followed by the
+// cooling ones, soonest to recover first, so a request is never refused
+// outright just because every mirror failed recently
+func (p *MirrorPool) candidates() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]string, 0, len(p.mirrors))
+	cooling := make([]*mirrorState, 0)
+	for _, m := range p.mirrors {
+		if now.Before(m.cooldownUntil) {
+			cooling = append(cooling, m)
+			continue
+		}
+		healthy = append(healthy, m.baseURL)
+	}
+
+	sort.SliceStable(cooling, func(i, j int) bool {
+		return cooling[i].cooldownUntil.Before(cooling[j].cooldownUntil)
+	})
+	for _, m := range cooling {
+		healthy = append(healthy, m.baseURL)
+	}
+	return healthy
+}
+
+func (p *MirrorPool) reportSuccess(baseURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if m := p.find(baseURL); m != nil {
+		m.failures = 0
+		m.lastError = ""
+		m.lastSuccess = time.Now()
+		m.cooldownUntil = time.Time{}
+	}
+}
+
+func (p *MirrorPool) reportFailure(baseURL string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := p.find(baseURL)
+	if m == nil {
+		return
+	}
+
+	m.lastError = err.Error()
+	// Requests sent in parallel all fail during the same outage; only count
+	// the first, so one outage backs the mirror off once
+	if time.Now().Before(m.cooldownUntil) {
+		return
+	}
+	m.failures++
+
+	// Double the cooldown for every consecutive failure
+	cooldown := p.cooldown
+	for i := 1; i < m.failures && cooldown < maxMirrorCooldown; i++ {
+		cooldown *= 2
+	}
+	if cooldown > maxMirrorCooldown {
+		cooldown = maxMirrorCooldown
+	}
+	m.cooldownUntil = time.Now().Add(cooldown)
+}
+
+func (p *MirrorPool) find(baseURL string) *mirrorState {
+	for _, m := range p.mirrors {
+		if m.baseURL == baseURL {
+			return m
+		}
+	}
+	return nil
+}
+
+// Status returns the health of every mirror in configured order
+func (p *MirrorPool) Status() []MirrorStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]MirrorStatus, 0, len(p.mirrors))
+	for _, m := range p.mirrors {
+		status := MirrorStatus{
+			URL:       m.baseURL,
+			Healthy:   !now.Before(m.cooldownUntil),
+			Failures:  m.failures,
+			LastError: m.lastError,
+		}
+		if !m.lastSuccess.IsZero() {
+			status.LastSuccess = m.lastSuccess.Unix()
+		}
+		if !status.Healthy {
+			status.CooldownUntil = m.cooldownUntil.Unix()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// try runs fn against each candidate mirror until one of them answers.
+// Only errors wrapped as mirrorFailure move on to the next mirror; any other
+// error is the mirror's real answer and is returned as is.
+func (p *MirrorPool) try(ctx context.Context, fn func(baseURL string) error) (string, error) {
+	candidates := p.candidates()
+	if len(candidates) == 0 {
+		return "", ErrNoMirrors
+	}
+
+	var lastErr error
+	for _, baseURL := range candidates {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		err := fn(baseURL)
+		var failure *mirrorFailure
+		if errors.As(err, &failure) {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			p.reportFailure(baseURL, failure.err)
+			lastErr = fmt.Errorf("%s: %w", baseURL, failure.err)
+			continue
+		}
+
+		p.reportSuccess(baseURL)
+		return baseURL, err
+	}
+
+	return "", fmt.Errorf("%w, last error: %w", ErrAllMirrorsFailed, lastErr)
+}
@@ -0,0 +1,45 @@
+package anna
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMirrorFailuresCountOncePerOutage(t *testing.T) {
+	pool := NewMirrorPool([]string{"https://a.example", "https://b.example"}, time.Minute)
+	down := errors.New("connection refused")
+
+	// Five page requests were sent to the mirror before the outage, and all
+	// of them fail
+	for i := 0; i < 5; i++ {
+		pool.reportFailure("https://a.example", down)
+	}
+
+	a := pool.find("https://a.example")
+	if a.failures != 1 {
+		t.Errorf("failures after one outage = %d, want 1", a.failures)
+	}
+	if remaining := time.Until(a.cooldownUntil); remaining > time.Minute || remaining < 50*time.Second {
+		t.Errorf("cooldown after one outage = %s, want about 1m", remaining)
+	}
+	if got := pool.candidates(); got[0] != "https://b.example" {
+		t.Errorf("candidates = %v, want the healthy mirror first", got)
+	}
+
+	// Failing again once the cooldown is over is a second outage
+	a.cooldownUntil = time.Now().Add(-time.Second)
+	pool.reportFailure("https://a.example", down)
+	pool.reportFailure("https://a.example", down)
+	if a.failures != 2 {
+		t.Errorf("failures after a second outage = %d, want 2", a.failures)
+	}
+	if remaining := time.Until(a.cooldownUntil); remaining > 2*time.Minute || remaining < 110*time.Second {
+		t.Errorf("cooldown after a second outage = %s, want about 2m", remaining)
+	}
+
+	pool.reportSuccess("https://a.example")
+	if a.failures != 0 || !a.cooldownUntil.IsZero() {
+		t.Errorf("after success: failures %d, cooling until %s", a.failures, a.cooldownUntil)
+	}
+}
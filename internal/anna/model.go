@@ -11,9 +11,16 @@ type Book struct {
 	Hash      string `json:"hash"`
 	CoverURL  string `json:"cover_url"`
 	CoverData string `json:"cover_data"`
+	Mirror    string `json:"mirror,omitempty"`
 }
 
 type fastDownloadResponse struct {
-	DownloadURL string `json:"download_url"`
-	Error       string `json:"error"`
+	DownloadURL string            `json:"download_url"`
+	Error       string            `json:"error"`
+	AccountInfo *fastDownloadInfo `json:"account_fast_download_info"`
+}
+
+type fastDownloadInfo struct {
+	DownloadsLeft   int `json:"downloads_left"`
+	DownloadsPerDay int `json:"downloads_per_day"`
 }
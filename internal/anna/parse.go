@@ -0,0 +1,228 @@
+package anna
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ParseSearchResults extracts books from an Anna search results page.
+// pageURL is the address the page was served from and is used to make
+// result and cover links absolute. It does no I/O, so saved pages can be fed
+// to it directly.
+func ParseSearchResults(doc *goquery.Document, pageURL *url.URL) []*Book {
+	seen := make(map[string]bool)
+	links := make([]*goquery.Selection, 0)
+
+	// Title links carry js-vim-focus; collect those first so they win over
+	// the cover link pointing at the same record
+	collect := func(_ int, s *goquery.Selection) {
+		href := s.AttrOr("href", "")
+		if seen[href] {
+			return
+		}
+		seen[href] = true
+		links = append(links, s)
+	}
+	doc.Find("a[href*='/md5/'].js-vim-focus").Each(collect)
+	doc.Find("a[href*='/md5/']").Each(collect)
+
+	books := make([]*Book, 0, len(links))
+	for _, link := range links {
+		if book := parseSearchResult(link, pageURL); book != nil {
+			books = append(books, book)
+		}
+	}
+	return books
+}
+
+func parseSearchResult(titleLink *goquery.Selection, pageURL *url.URL) *Book {
+	container := titleLink.Closest("div.flex")
+	if container.Length() == 0 {
+		return nil
+	}
+
+	title := strings.TrimSpace(titleLink.Text())
+
+	var authors string
+	authorLink := titleLink.NextFiltered("a")
+	if authorLink.Length() > 0 {
+		authors = strings.TrimSpace(authorLink.Text())
+		authors = strings.TrimSpace(strings.Replace(authors, "👤", "", -1))
+	}
+
+	language, format, size := extractMetaInformation(findMetaLine(container))
+
+	trimmedFormat := strings.TrimSpace(format)
+	if trimmedFormat != "" {
+		trimmedFormat = strings.Trim(trimmedFormat, "[]()·")
+	}
+
+	coverURL, coverData := findCover(container, pageURL)
+
+	link := titleLink.AttrOr("href", "")
+	hash := strings.TrimPrefix(link, "/md5/")
+
+	return &Book{
+		Language:  strings.TrimSpace(language),
+		Format:    trimmedFormat,
+		Size:      strings.TrimSpace(size),
+		Title:     title,
+		Authors:   authors,
+		URL:       absoluteURL(pageURL, link),
+		Hash:      hash,
+		CoverURL:  coverURL,
+		CoverData: coverData,
+	}
+}
+
+// findMetaLine looks for the "language · format · size" line of a result
+func findMetaLine(container *goquery.Selection) string {
+	var meta string
+
+	container.Find("div").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+
+		if strings.Contains(text, "·") &&
+			(strings.Contains(text, "MB") || strings.Contains(text, "KB") || strings.Contains(text, "GB")) &&
+			(strings.Contains(text, "[") || strings.Contains(text, "ZIP") || strings.Contains(text, "PDF") || strings.Contains(text, "EPUB")) {
+
+			cleanText := text
+
+			if saveIndex := strings.Index(cleanText, "Save"); saveIndex != -1 {
+				cleanText = strings.TrimSpace(cleanText[:saveIndex])
+			}
+
+			if funcIndex := strings.Index(cleanText, "(function"); funcIndex != -1 {
+				cleanText = strings.TrimSpace(cleanText[:funcIndex])
+			}
+
+			if len(cleanText) > 10 && strings.Contains(cleanText, "·") {
+				meta = cleanText
+			}
+		}
+	})
+
+	return meta
+}
+
+// findCover returns the cover image URL of a result, or a description of
+// Anna's generated fallback cover when there is no image
+func findCover(container *goquery.Selection, pageURL *url.URL) (coverURL, coverData string) {
+	coverLink := container.Find("a.custom-a.block").First()
+	if coverLink.Length() > 0 {
+		coverImg := coverLink.Find("img")
+		if coverImg.Length() > 0 {
+			coverURL = absoluteURL(pageURL, coverImg.AttrOr("src", ""))
+		}
+
+		if coverURL == "" {
+			fallbackDiv := coverLink.Find("div.js-aarecord-list-fallback-cover")
+			if fallbackDiv.Length() > 0 {
+				bgColor, _ := fallbackDiv.Attr("style")
+				titleDiv := fallbackDiv.Find("div.font-bold.text-violet-900")
+				authorDiv := fallbackDiv.Find("div.font-bold.text-amber-900")
+
+				coverData = fmt.Sprintf("fallback:bg=%s;title=%s;author=%s",
+					bgColor,
+					titleDiv.Text(),
+					authorDiv.Text())
+			}
+		}
+	}
+
+	if coverURL == "" {
+		coverURL = firstImageSrc(container.Find("img"), pageURL)
+	}
+
+	if coverURL == "" {
+		parent := container.Parent()
+		if parent.Length() > 0 {
+			coverURL = firstImageSrc(parent.Find("img"), pageURL)
+		}
+	}
+
+	return coverURL, coverData
+}
+
+func firstImageSrc(imgs *goquery.Selection, pageURL *url.URL) string {
+	var src string
+	imgs.EachWithBreak(func(_ int, img *goquery.Selection) bool {
+		src = absoluteURL(pageURL, img.AttrOr("src", ""))
+		return src == ""
+	})
+	return src
+}
+
+func absoluteURL(base *url.URL, ref string) string {
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ""
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base == nil {
+		return parsed.String()
+	}
+	return base.ResolveReference(parsed).String()
+}
+
+// ParseReport summarizes how well a results page was understood. A markup
+// change on Anna's side usually shows up here as results with no title,
+// hash or format long before anyone notices garbled search results.
+type ParseReport struct {
+	Total         int      `json:"total"`
+	MissingTitle  []string `json:"missing_title,omitempty"`
+	MissingHash   []string `json:"missing_hash,omitempty"`
+	MissingFormat []string `json:"missing_format,omitempty"`
+}
+
+// CheckParseHealth flags parsed results that lack a title, hash or format.
+// Results are identified by hash, or by URL when the hash is missing.
+func CheckParseHealth(books []*Book) ParseReport {
+	report := ParseReport{Total: len(books)}
+
+	for _, book := range books {
+		id := book.Hash
+		if id == "" {
+			id = book.URL
+		}
+
+		if strings.TrimSpace(book.Title) == "" {
+			report.MissingTitle = append(report.MissingTitle, id)
+		}
+		if !IsMD5(book.Hash) {
+			report.MissingHash = append(report.MissingHash, id)
+		}
+		if strings.TrimSpace(book.Format) == "" {
+			report.MissingFormat = append(report.MissingFormat, id)
+		}
+	}
+
+	return report
+}
+
+func (r ParseReport) Healthy() bool {
+	return len(r.MissingTitle) == 0 && len(r.MissingHash) == 0 && len(r.MissingFormat) == 0
+}
+
+func (r ParseReport) String() string {
+	return fmt.Sprintf("%d results, %d missing title, %d missing hash, %d missing format",
+		r.Total, len(r.MissingTitle), len(r.MissingHash), len(r.MissingFormat))
+}
+
+// IsMD5 reports whether s looks like a hex encoded MD5 digest
+func IsMD5(s string) bool {
+	if len(s) != 32 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package anna
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// parseFixture parses a saved search page from testdata as if it came from
+// the search at pageURL
+func parseFixture(t *testing.T, name, pageURL string) []*Book {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatalf("parse %s: %v", name, err)
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		t.Fatalf("parse url %s: %v", pageURL, err)
+	}
+	return ParseSearchResults(doc, u)
+}
+
+func TestParseSearchResults(t *testing.T) {
+	books := parseFixture(t, "search_results.html", "https://annas-archive.org/search?q=go")
+
+	tests := []struct {
+		title    string
+		hash     string
+		format   string
+		language string
+		size     string
+		authors  string
+		cover    string
+		// Prefix of the fallback cover data, when there's no cover image
+		coverData string
+	}{
+		{
+			title:    "The Go Programming Language",
+			hash:     "0123456789abcdef0123456789abcdef",
+			format:   "EPUB",
+			language: "English [en]",
+			size:     "4.1MB",
+			authors:  "Alan A. A. Donovan, Brian W. Kernighan",
+			cover:    "https://covers.example.org/covers300/go.jpg",
+		},
+		{
+			title:     "Le Petit Prince",
+			hash:      "fedcba9876543210fedcba9876543210",
+			format:    "PDF",
+			language:  "French [fr]",
+			size:      "12.3MB",
+			authors:   "Antoine de Saint-Exupéry",
+			coverData: "fallback:bg=background-color: hsl(120deg 43% 73%);title=Le Petit Prince;author=Antoine de Saint-Exupéry",
+		},
+		{
+			title:    "Untitled Notes",
+			hash:     "00112233445566778899aabbccddeeff",
+			format:   "MOBI",
+			language: "English [en]",
+			size:     "850KB",
+			// Relative covers resolve against the page they came from
+			cover: "https://annas-archive.org/covers/local-123.jpg",
+		},
+	}
+
+	if len(books) != len(tests) {
+		t.Fatalf("got %d results, want %d", len(books), len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			b := books[i]
+			if b.Title != tt.title {
+				t.Errorf("title = %q, want %q", b.Title, tt.title)
+			}
+			if b.Hash != tt.hash {
+				t.Errorf("hash = %q, want %q", b.Hash, tt.hash)
+			}
+			if want := "https://annas-archive.org/md5/" + tt.hash; b.URL != want {
+				t.Errorf("url = %q, want %q", b.URL, want)
+			}
+			if b.Format != tt.format {
+				t.Errorf("format = %q, want %q", b.Format, tt.format)
+			}
+			if b.Language != tt.language {
+				t.Errorf("language = %q, want %q", b.Language, tt.language)
+			}
+			if b.Size != tt.size {
+				t.Errorf("size = %q, want %q", b.Size, tt.size)
+			}
+			if b.Authors != tt.authors {
+				t.Errorf("authors = %q, want %q", b.Authors, tt.authors)
+			}
+			if b.CoverURL != tt.cover {
+				t.Errorf("cover = %q, want %q", b.CoverURL, tt.cover)
+			}
+			if b.CoverData != tt.coverData {
+				t.Errorf("cover data = %q, want %q", b.CoverData, tt.coverData)
+			}
+		})
+	}
+}
+
+func TestCheckParseHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    ParseReport
+		healthy bool
+	}{
+		{
+			name:    "well formed",
+			fixture: "search_results.html",
+			want:    ParseReport{Total: 3},
+			healthy: true,
+		},
+		{
+			name:    "broken markup",
+			fixture: "search_broken.html",
+			want: ParseReport{
+				Total:         3,
+				MissingTitle:  []string{"aaaabbbbccccddddeeeeffff00001111"},
+				MissingHash:   []string{"not-a-hash"},
+				MissingFormat: []string{"22223333444455556666777788889999"},
+			},
+			healthy: false,
+		},
+		{
+			// A page with no results isn't a sign the layout changed
+			name:    "no results",
+			fixture: "search_empty.html",
+			want:    ParseReport{},
+			healthy: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			books := parseFixture(t, tt.fixture, "https://annas-archive.org/search?q=test")
+			report := CheckParseHealth(books)
+			if !reflect.DeepEqual(report, tt.want) {
+				t.Errorf("report = %+v, want %+v", report, tt.want)
+			}
+			if report.Healthy() != tt.healthy {
+				t.Errorf("healthy = %v, want %v (%s)", report.Healthy(), tt.healthy, report)
+			}
+		})
+	}
+}
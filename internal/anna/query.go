@@ -0,0 +1,98 @@
+package anna
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxSearchPages bounds how many result pages one search fetches
+const MaxSearchPages = 5
+
+// Content types Anna's Archive can narrow a search to
+var contentTypes = map[string]bool{
+	"book_nonfiction":    true,
+	"book_fiction":       true,
+	"book_unknown":       true,
+	"book_comic":         true,
+	"magazine":           true,
+	"journal_article":    true,
+	"standards_document": true,
+	"musical_score":      true,
+	"audiobook":          true,
+	"other":              true,
+}
+
+// Orders Anna's Archive can sort results in; empty is most relevant first
+var searchSorts = map[string]bool{
+	"newest":       true,
+	"oldest":       true,
+	"largest":      true,
+	"smallest":     true,
+	"newest_added": true,
+	"oldest_added": true,
+	"random":       true,
+}
+
+// SearchQuery is a search of Anna's Archive. Zero fields are left to Anna's
+// defaults.
+type SearchQuery struct {
+	Query string
+	// First results page, starting at 1
+	Page int
+	// Number of pages to fetch from Page on, at most MaxSearchPages
+	Pages int
+	// Language code, e.g. "en"
+	Language string
+	// File extension, e.g. "epub"
+	Extension   string
+	ContentType string
+	Sort        string
+}
+
+func ValidContentType(contentType string) bool {
+	return contentType == "" || contentTypes[contentType]
+}
+
+func ValidSearchSort(sort string) bool {
+	return sort == "" || searchSorts[sort]
+}
+
+// PageRange returns the first page to fetch and how many
+func (q SearchQuery) PageRange() (first, count int) {
+	first, count = max(q.Page, 1), q.Pages
+	if count < 1 {
+		count = 1
+	}
+	return first, min(count, MaxSearchPages)
+}
+
+// Params returns the URL parameters that narrow or order the search,
+// without the query and page
+func (q SearchQuery) Params() url.Values {
+	v := url.Values{}
+	if q.Language != "" {
+		v.Set("lang", strings.ToLower(q.Language))
+	}
+	if q.Extension != "" {
+		v.Set("ext", strings.ToLower(q.Extension))
+	}
+	if q.ContentType != "" {
+		v.Set("content", q.ContentType)
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	return v
+}
+
+// searchURL is the address of one results page on the mirror at baseURL
+func (q SearchQuery) searchURL(baseURL string, page int) string {
+	v := q.Params()
+	v.Set("q", q.Query)
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	return fmt.Sprintf(AnnasSearchEndpoint, baseURL, v.Encode())
+}
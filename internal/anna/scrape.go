@@ -1,203 +1,121 @@
 package anna
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"net/url"
+	"log"
 	"sync"
 
-	"strings"
-
 	"github.com/PuerkitoBio/goquery"
 	colly "github.com/gocolly/colly/v2"
 )
 
-const (
-	AnnasSearchEndpoint   = "https://annas-archive.pm/search?q=%s"
-	AnnasDownloadEndpoint = "https://annas-archive.pm/dyn/api/fast_download.json?md5=%s&key=%s"
-)
-
-func FindBook(query string) ([]*Book, error) {
-	c := colly.NewCollector(
-		colly.Async(true),
-	)
-
-	bookList := make([]*colly.HTMLElement, 0)
-	var mu sync.Mutex
-
-	c.OnHTML("a[href*='/md5/'].js-vim-focus", func(e *colly.HTMLElement) {
-		mu.Lock()
-		bookList = append(bookList, e)
-		mu.Unlock()
-	})
-
-	c.OnHTML("a[href*='/md5/']", func(e *colly.HTMLElement) {
-		href := e.Attr("href")
-		alreadyFound := false
-		mu.Lock()
-		for _, existing := range bookList {
-			if existing.Attr("href") == href {
-				alreadyFound = true
-				break
-			}
-		}
-		if !alreadyFound {
-			bookList = append(bookList, e)
-		}
-		mu.Unlock()
-	})
-
-	c.OnRequest(func(r *colly.Request) {
-	})
-
-	fullURL := fmt.Sprintf(AnnasSearchEndpoint, url.QueryEscape(query))
-	c.Visit(fullURL)
-	c.Wait()
+// FindBook searches the first healthy mirror for query and tags every result
+// with the mirror that served it. Several pages are fetched concurrently and
+// joined in order; a book listed on more than one appears once. Results stop
+// at the first page that fails or comes back empty, so later pages never
+// leave a gap.
+func (cl *Client) FindBook(ctx context.Context, query SearchQuery) ([]*Book, error) {
+	first, count := query.PageRange()
+	pages := make([][]*Book, count)
+	errs := make([]error, count)
+
+	var wg sync.WaitGroup
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pages[i], errs[i] = cl.findPage(ctx, query, first+i)
+		}()
+	}
+	wg.Wait()
 
-	bookListParsed := make([]*Book, 0, len(bookList))
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
 
-	for _, e := range bookList {
-		container := e.DOM.Closest("div.flex")
-		if container.Length() == 0 {
-			continue
+	seen := make(map[string]bool)
+	var books []*Book
+	for i, page := range pages {
+		if errs[i] != nil {
+			log.Printf("Anna search for %q stopped at page %d: %v", query.Query, first+i, errs[i])
+			break
 		}
-
-		title := strings.TrimSpace(e.Text)
-
-		var authors string
-		titleLink := e.DOM
-		authorLink := titleLink.NextFiltered("a")
-		if authorLink.Length() > 0 {
-			authors = strings.TrimSpace(authorLink.Text())
-			authors = strings.TrimSpace(strings.Replace(authors, "👤", "", -1))
-			authors = strings.TrimSpace(authors)
+		if len(page) == 0 {
+			break
 		}
-
-		var meta string
-
-		container.Find("div").Each(func(j int, s *goquery.Selection) {
-			text := strings.TrimSpace(s.Text())
-
-			if strings.Contains(text, "·") &&
-				(strings.Contains(text, "MB") || strings.Contains(text, "KB") || strings.Contains(text, "GB")) &&
-				(strings.Contains(text, "[") || strings.Contains(text, "ZIP") || strings.Contains(text, "PDF") || strings.Contains(text, "EPUB")) {
-
-				cleanText := text
-
-				if saveIndex := strings.Index(cleanText, "Save"); saveIndex != -1 {
-					cleanText = strings.TrimSpace(cleanText[:saveIndex])
-				}
-
-				if funcIndex := strings.Index(cleanText, "(function"); funcIndex != -1 {
-					cleanText = strings.TrimSpace(cleanText[:funcIndex])
-				}
-
-				if len(cleanText) > 10 && strings.Contains(cleanText, "·") {
-					meta = cleanText
-				}
+		for _, book := range page {
+			if seen[book.Hash] {
+				continue
 			}
-		})
-
-		language, format, size := extractMetaInformation(meta)
-
-		trimmedFormat := strings.TrimSpace(format)
-		if trimmedFormat != "" {
-			trimmedFormat = strings.Trim(trimmedFormat, "[]()·")
+			seen[book.Hash] = true
+			books = append(books, book)
 		}
+	}
+	return books, nil
+}
 
-		var publisher string
-
-		/*var filePath string
-		container.Find("div.text-\\[9px\\].text-gray-500").Each(func(j int, s *goquery.Selection) {
-			text := strings.TrimSpace(s.Text())
-			if strings.Contains(text, "/") && (strings.Contains(text, ".pdf") || strings.Contains(text, ".epub") || strings.Contains(text, ".mobi")) {
-				filePath = text
-			}
-		})*/
-
-		var coverURL, coverData string
-
-		coverLink := container.Find("a.custom-a.block").First()
-		if coverLink.Length() > 0 {
-			coverImg := coverLink.Find("img")
-			if coverImg.Length() > 0 {
-				coverURL = coverImg.AttrOr("src", "")
-				if coverURL != "" {
-					coverURL = e.Request.AbsoluteURL(coverURL)
-				}
-			}
-
-			if coverURL == "" {
-				fallbackDiv := coverLink.Find("div.js-aarecord-list-fallback-cover")
-				if fallbackDiv.Length() > 0 {
-					bgColor, _ := fallbackDiv.Attr("style")
-					titleDiv := fallbackDiv.Find("div.font-bold.text-violet-900")
-					authorDiv := fallbackDiv.Find("div.font-bold.text-amber-900")
-
-					coverData = fmt.Sprintf("fallback:bg=%s;title=%s;author=%s",
-						bgColor,
-						titleDiv.Text(),
-						authorDiv.Text())
-				}
-			}
+// findPage fetches one page of results from the first healthy mirror
+func (cl *Client) findPage(ctx context.Context, query SearchQuery, page int) ([]*Book, error) {
+	var books []*Book
+	mirror, err := cl.mirrors.try(ctx, func(baseURL string) error {
+		found, err := cl.scrapeSearch(ctx, query.searchURL(baseURL, page))
+		if err != nil {
+			return &mirrorFailure{err: err}
 		}
+		books = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		if coverURL == "" {
-			allImgs := container.Find("img")
-			allImgs.Each(func(idx int, img *goquery.Selection) {
-				src := img.AttrOr("src", "")
-				if coverURL == "" && src != "" {
-					coverURL = e.Request.AbsoluteURL(src)
-				}
-			})
-		}
+	for _, book := range books {
+		book.Mirror = mirror
+	}
+	return books, nil
+}
 
-		if coverURL == "" {
-			allLinks := container.Find("a")
-			allLinks.Each(func(idx int, link *goquery.Selection) {
-				linkHTML, _ := link.Html()
-				if strings.Contains(linkHTML, "<img") {
-					img := link.Find("img").First()
-					if img.Length() > 0 {
-						src := img.AttrOr("src", "")
-						if src != "" && coverURL == "" {
-							coverURL = e.Request.AbsoluteURL(src)
-						}
-					}
-				}
-			})
+func (cl *Client) scrapeSearch(ctx context.Context, searchURL string) ([]*Book, error) {
+	c := colly.NewCollector(
+		colly.StdlibContext(ctx),
+	)
+	c.SetClient(cl.httpClient)
+
+	var visitErr error
+	c.OnError(func(r *colly.Response, err error) {
+		if r != nil && r.StatusCode != 0 {
+			visitErr = fmt.Errorf("search returned status %d: %w", r.StatusCode, err)
+			return
 		}
+		visitErr = err
+	})
 
-		if coverURL == "" {
-			parent := container.Parent()
-			if parent.Length() > 0 {
-				parentImgs := parent.Find("img")
-				parentImgs.Each(func(idx int, img *goquery.Selection) {
-					src := img.AttrOr("src", "")
-					if coverURL == "" && src != "" {
-						coverURL = e.Request.AbsoluteURL(src)
-					}
-				})
-			}
+	var books []*Book
+	c.OnResponse(func(r *colly.Response) {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+		if err != nil {
+			visitErr = fmt.Errorf("failed to parse search page: %w", err)
+			return
 		}
+		books = ParseSearchResults(doc, r.Request.URL)
+	})
 
-		link := e.Attr("href")
-		hash := strings.TrimPrefix(link, "/md5/")
+	if err := c.Visit(searchURL); err != nil && visitErr == nil {
+		visitErr = err
+	}
 
-		book := &Book{
-			Language:  strings.TrimSpace(language),
-			Format:    trimmedFormat,
-			Size:      strings.TrimSpace(size),
-			Title:     strings.TrimSpace(title),
-			Publisher: strings.TrimSpace(publisher),
-			Authors:   strings.TrimSpace(authors),
-			URL:       e.Request.AbsoluteURL(link),
-			Hash:      hash,
-			CoverURL:  coverURL,
-			CoverData: coverData,
-		}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if visitErr != nil {
+		return nil, visitErr
+	}
 
-		bookListParsed = append(bookListParsed, book)
+	if report := CheckParseHealth(books); !report.Healthy() {
+		log.Printf("Anna search parse health for %s: %s", searchURL, report)
 	}
 
-	return bookListParsed, nil
+	return books, nil
 }
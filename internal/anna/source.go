@@ -0,0 +1,80 @@
+package anna
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BookSource is a catalog marchive can search and fetch books from.
+// Anna's Archive is the default implementation; other catalogs or fakes
+// can be plugged in with RegisterSource.
+type BookSource interface {
+	Search(ctx context.Context, query SearchQuery) ([]*Book, error)
+	Metadata(ctx context.Context, hash string) (*Book, error)
+	ResolveDownload(ctx context.Context, hash string) (*DownloadLink, error)
+}
+
+// DownloadLink is a resolved, directly fetchable URL for a book file
+type DownloadLink struct {
+	URL    string `json:"url"`
+	Mirror string `json:"mirror,omitempty"`
+}
+
+// SourceOptions carries the configuration handed to a source factory
+type SourceOptions struct {
+	APIKeys        []string
+	DailyQuota     int
+	KeyUsage       KeyUsageStore
+	Mirrors        []string
+	MirrorCooldown time.Duration
+}
+
+type SourceFactory func(opts SourceOptions) (BookSource, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[string]SourceFactory)
+)
+
+// RegisterSource makes a book source available under the given name.
+// It panics if the name is already taken, like database/sql drivers.
+func RegisterSource(name string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	if factory == nil {
+		panic("anna: RegisterSource factory is nil")
+	}
+	if _, exists := sources[name]; exists {
+		panic("anna: RegisterSource called twice for source " + name)
+	}
+	sources[name] = factory
+}
+
+// NewSource builds the book source registered under name
+func NewSource(name string, opts SourceOptions) (BookSource, error) {
+	sourcesMu.RLock()
+	factory, ok := sources[name]
+	sourcesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown book source %q (available: %v)", name, SourceNames())
+	}
+	return factory(opts)
+}
+
+// SourceNames returns the names of all registered book sources
+func SourceNames() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
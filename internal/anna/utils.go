@@ -1,13 +1,9 @@
 package anna
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -64,49 +60,6 @@ func extractMetaInformation(meta string) (language, format, size string) {
 	return language, format, size
 }
 
-func (b *Book) Download(secretKey, folderPath string) error {
-	apiURL := fmt.Sprintf(AnnasDownloadEndpoint, b.Hash, secretKey)
-
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	var apiResp fastDownloadResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return err
-	}
-	if apiResp.DownloadURL == "" {
-		if apiResp.Error != "" {
-			return errors.New(apiResp.Error)
-		}
-		return errors.New("failed to get download URL")
-	}
-
-	downloadResp, err := http.Get(apiResp.DownloadURL)
-	if err != nil {
-		return err
-	}
-	defer downloadResp.Body.Close()
-
-	if downloadResp.StatusCode != http.StatusOK {
-		return errors.New("failed to download file")
-	}
-
-	filename := sanitizeFilename(b.Title) + "." + b.Format
-	filePath := filepath.Join(folderPath, filename)
-
-	out, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, downloadResp.Body)
-	return err
-}
-
 func (b *Book) String() string {
 	return fmt.Sprintf("Title: %s\nAuthors: %s\nPublisher: %s\nLanguage: %s\nFormat: %s\nSize: %s\nURL: %s\nHash: %s",
 		b.Title, b.Authors, b.Publisher, b.Language, b.Format, b.Size, b.URL, b.Hash)
@@ -127,8 +80,8 @@ func min(a, b int) int {
 	return b
 }
 
-func GetBookMetadata(hash string) (*Book, error) {
-	books, err := FindBook(hash)
+func (c *Client) GetBookMetadata(ctx context.Context, hash string) (*Book, error) {
+	books, err := c.FindBook(ctx, SearchQuery{Query: hash})
 	if err != nil {
 		return nil, fmt.Errorf("failed to search for book metadata: %w", err)
 	}
@@ -1,6 +1,9 @@
 package admin
 
-import "github.com/akramboussanni/marchive/internal/model"
+import (
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/model"
+)
 
 type UserListResponse struct {
 	Users      []UserWithStats `json:"users"`
@@ -38,6 +41,17 @@ type SystemStatsResponse struct {
 	ActiveUsers     int                     `json:"active_users_24h"`
 	RecentDownloads []model.DownloadRequest `json:"recent_downloads"`
 	TopBooks        []BookDownloadStats     `json:"top_books"`
+	APIKeys         []anna.KeyStatus        `json:"api_keys"`
+	Storage         StorageStats            `json:"storage"`
+	SearchCache     model.SearchCacheStats  `json:"search_cache"`
+}
+
+// StorageStats is storage usage in bytes, with the configured cap (0 = none)
+type StorageStats struct {
+	model.StorageUsage
+	TotalBytes     int64  `json:"total_bytes"`
+	CapBytes       int64  `json:"cap_bytes"`
+	EvictionPolicy string `json:"eviction_policy"`
 }
 
 type BookDownloadStats struct {
@@ -71,3 +85,27 @@ type SetDailyLimitRequest struct {
 	DailyLimit int   `json:"daily_limit" binding:"required" example:"10"`
 }
 
+
+type VerifyBooksResponse struct {
+	Checked    int               `json:"checked"`
+	Verified   int               `json:"verified"`
+	Skipped    int               `json:"skipped"`
+	Mismatched []BookVerifyIssue `json:"mismatched"`
+	Missing    []BookVerifyIssue `json:"missing"`
+}
+
+type BookVerifyIssue struct {
+	Hash   string `json:"hash"`
+	Title  string `json:"title"`
+	Actual string `json:"actual_md5,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type QueueResponse struct {
+	Jobs       []model.DownloadJobWithMetadata `json:"jobs"`
+	Pagination Pagination                      `json:"pagination"`
+}
+
+type SetJobPriorityRequest struct {
+	Priority int `json:"priority" example:"10"`
+}
@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/akramboussanni/marchive/internal/api"
+	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/go-chi/chi/v5"
+)
+
+// HandleListQueue lists pending and active download jobs in the order the
+// workers will pick them up
+func (ar *AdminRouter) HandleListQueue(w http.ResponseWriter, r *http.Request) {
+	limitStr := r.URL.Query().Get("limit")
+	offsetStr := r.URL.Query().Get("offset")
+
+	limit := 20
+	offset := 0
+
+	if limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	if offsetStr != "" {
+		if parsed, err := strconv.Atoi(offsetStr); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	jobs, err := ar.DownloadJobRepo.GetQueuedJobs(r.Context(), limit, offset)
+	if err != nil {
+		applog.Error("Failed to get queued jobs:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	total, err := ar.DownloadJobRepo.CountQueuedJobs(r.Context())
+	if err != nil {
+		applog.Error("Failed to count queued jobs:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	response := QueueResponse{
+		Jobs: api.EmptyIfNil(jobs),
+		Pagination: Pagination{
+			Limit:   limit,
+			Offset:  offset,
+			Total:   total,
+			HasNext: offset+limit < total,
+		},
+	}
+
+	api.WriteJSON(w, http.StatusOK, response)
+}
+
+func (ar *AdminRouter) HandleSetJobPriority(w http.ResponseWriter, r *http.Request) {
+	jobID, err := strconv.ParseInt(chi.URLParam(r, "jobID"), 10, 64)
+	if err != nil {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "invalid job ID")
+		return
+	}
+
+	req, err := api.DecodeJSON[SetJobPriorityRequest](w, r)
+	if err != nil {
+		return
+	}
+
+	updated, err := ar.DownloadJobRepo.SetJobPriority(r.Context(), jobID, req.Priority)
+	if err != nil {
+		applog.Error("Failed to set job priority:", err)
+		api.WriteInternalError(w)
+		return
+	}
+	if !updated {
+		api.WriteMessage(w, http.StatusNotFound, "error", "job not found")
+		return
+	}
+
+	api.WriteMessage(w, http.StatusOK, "success", "job priority updated")
+}
@@ -4,9 +4,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/akramboussanni/marchive/internal/anna"
 	"github.com/akramboussanni/marchive/internal/middleware"
 	"github.com/akramboussanni/marchive/internal/repo"
 	"github.com/akramboussanni/marchive/internal/services"
+	"github.com/akramboussanni/marchive/internal/storage"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -14,21 +16,29 @@ type AdminRouter struct {
 	UserRepo            *repo.UserRepo
 	TokenRepo           *repo.TokenRepo
 	BookRepo            *repo.BookRepo
+	DownloadJobRepo     *repo.DownloadJobRepo
 	DownloadRequestRepo *repo.DownloadRequestRepo
 	RequestCreditsRepo  *repo.RequestCreditsRepo
 	SettingsRepo        *repo.SettingsRepo
 	UserService         *services.UserService
+	Source              anna.BookSource
+	SearchCache         *services.SearchCache
+	Storage             storage.Storage
 }
 
-func NewAdminRouter(repos *repo.Repos, userService *services.UserService) http.Handler {
+func NewAdminRouter(repos *repo.Repos, userService *services.UserService, source anna.BookSource, searchCache *services.SearchCache, store storage.Storage) http.Handler {
 	ar := &AdminRouter{
 		UserRepo:            repos.User,
 		TokenRepo:           repos.Token,
 		BookRepo:            repos.Book,
+		DownloadJobRepo:     repos.DownloadJob,
 		DownloadRequestRepo: repos.DownloadRequest,
 		RequestCreditsRepo:  repos.RequestCredits,
 		SettingsRepo:        repos.Settings,
 		UserService:         userService,
+		Source:              source,
+		SearchCache:         searchCache,
+		Storage:             store,
 	}
 	r := chi.NewRouter()
 
@@ -39,7 +49,7 @@ func NewAdminRouter(repos *repo.Repos, userService *services.UserService) http.H
 
 	r.Group(func(r chi.Router) {
 		middleware.AddRatelimit(r, 60, 1*time.Minute)
-		middleware.AddAuth(r, repos.User, repos.Token)
+		middleware.AddAuth(r, repos.User, repos.Token, repos.PersonalToken)
 		r.Use(middleware.AdminOnly)
 
 		r.Get("/stats", ar.HandleSystemStats)
@@ -58,6 +68,13 @@ func NewAdminRouter(repos *repo.Repos, userService *services.UserService) http.H
 		// Daily download limit management
 		r.Post("/users/daily-limit", ar.HandleSetDailyLimit)
 
+		// Download queue
+		r.Get("/queue", ar.HandleListQueue)
+		r.Put("/queue/{jobID}/priority", ar.HandleSetJobPriority)
+
+		// Stored file integrity
+		r.Post("/books/verify", ar.HandleVerifyBooks)
+
 		// Settings management
 		r.Get("/settings", settingsHandler.HandleGetSettings)
 		r.Post("/settings", settingsHandler.HandleUpdateSetting)
@@ -4,8 +4,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/akramboussanni/marchive/config"
+	"github.com/akramboussanni/marchive/internal/anna"
 	"github.com/akramboussanni/marchive/internal/api"
 	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/services"
 )
 
 func (ar *AdminRouter) HandleSystemStats(w http.ResponseWriter, r *http.Request) {
@@ -63,6 +66,20 @@ func (ar *AdminRouter) HandleSystemStats(w http.ResponseWriter, r *http.Request)
 		})
 	}
 
+	usage, err := services.GetStorageUsage(ctx, ar.BookRepo, ar.Storage)
+	if err != nil {
+		applog.Error("Failed to get storage usage:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	searchCache, err := ar.SearchCache.Stats(ctx)
+	if err != nil {
+		applog.Error("Failed to get search cache stats:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
 	response := SystemStatsResponse{
 		TotalUsers:      totalUsers,
 		TotalBooks:      totalBooks,
@@ -70,6 +87,18 @@ func (ar *AdminRouter) HandleSystemStats(w http.ResponseWriter, r *http.Request)
 		ActiveUsers:     activeUsers,
 		RecentDownloads: api.EmptyIfNil(recentDownloads),
 		TopBooks:        api.EmptyIfNil(topBooksStats),
+		APIKeys:         []anna.KeyStatus{},
+		Storage: StorageStats{
+			StorageUsage:   *usage,
+			TotalBytes:     usage.TotalBytes(),
+			CapBytes:       config.App.StorageCapMB << 20,
+			EvictionPolicy: config.App.StorageEvictionPolicy,
+		},
+		SearchCache: *searchCache,
+	}
+
+	if reporter, ok := ar.Source.(anna.KeyStatusReporter); ok {
+		response.APIKeys = reporter.KeyStatus()
 	}
 
 	api.WriteJSON(w, http.StatusOK, response)
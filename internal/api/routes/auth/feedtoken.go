@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/akramboussanni/marchive/internal/api"
+	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/utils"
+)
+
+// @Summary Get OPDS feed token status
+// @Description Report whether the current user has an OPDS feed token and when it was last used. The token itself can't be shown again.
+// @Tags Account
+// @Produce json
+// @Security CookieAuth
+// @Success 200 {object} FeedTokenResponse "Feed token status"
+// @Failure 401 {object} api.ErrorResponse "Unauthorized - invalid or missing session cookie"
+// @Failure 500 {object} api.ErrorResponse "Internal server error"
+// @Router /auth/me/feed-token [get]
+func (ar *AuthRouter) HandleGetFeedToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	token, err := ar.FeedTokenRepo.GetFeedToken(r.Context(), user.ID)
+	if err != nil {
+		applog.Error("Failed to get feed token:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	if token == nil {
+		api.WriteJSON(w, http.StatusOK, FeedTokenResponse{})
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, FeedTokenResponse{
+		Enabled:    true,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.LastUsedAt,
+	})
+}
+
+// @Summary Create OPDS feed token
+// @Description Create a token that lets an e-reader read the OPDS catalog without logging in, replacing any previous token. The raw token is only returned here.
+// @Tags Account
+// @Produce json
+// @Security CookieAuth
+// @Success 200 {object} FeedTokenResponse "New feed token and catalog URL"
+// @Failure 401 {object} api.ErrorResponse "Unauthorized - invalid or missing session cookie"
+// @Failure 500 {object} api.ErrorResponse "Internal server error"
+// @Router /auth/me/feed-token [post]
+func (ar *AuthRouter) HandleCreateFeedToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	raw, err := utils.GetRandomToken(32)
+	if err != nil {
+		applog.Error("Failed to generate feed token:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	token, err := ar.FeedTokenRepo.SetFeedToken(r.Context(), user.ID, raw.Hash)
+	if err != nil {
+		applog.Error("Failed to save feed token:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	applog.Info("Feed token created", "userID:", user.ID)
+	api.WriteJSON(w, http.StatusOK, FeedTokenResponse{
+		Enabled:   true,
+		Token:     raw.Raw,
+		FeedURL:   "/opds/token/" + raw.Raw + "/",
+		CreatedAt: token.CreatedAt,
+	})
+}
+
+// @Summary Revoke OPDS feed token
+// @Description Revoke the current user's OPDS feed token. Readers using it lose access.
+// @Tags Account
+// @Produce json
+// @Security CookieAuth
+// @Success 200 {object} api.SuccessResponse "Feed token revoked"
+// @Failure 401 {object} api.ErrorResponse "Unauthorized - invalid or missing session cookie"
+// @Failure 500 {object} api.ErrorResponse "Internal server error"
+// @Router /auth/me/feed-token [delete]
+func (ar *AuthRouter) HandleDeleteFeedToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	if err := ar.FeedTokenRepo.DeleteFeedToken(r.Context(), user.ID); err != nil {
+		applog.Error("Failed to delete feed token:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	api.WriteMessage(w, http.StatusOK, "success", "feed token revoked")
+}
@@ -1,5 +1,7 @@
 package auth
 
+import "github.com/akramboussanni/marchive/internal/model"
+
 // @Description User registration request
 type RegisterRequest struct {
 	Username string `json:"username" example:"johndoe" binding:"required" minLength:"3" maxLength:"30" pattern:"^[a-zA-Z0-9_-]+$"`
@@ -34,3 +36,25 @@ type PasswordChangeRequest struct {
 	CurrentPassword string `json:"current_password" example:"SecurePass123!" binding:"required" description:"Current password for verification"`
 	NewPassword     string `json:"new_password" example:"NewSecurePass123!" binding:"required" minLength:"8" description:"New password that meets security requirements"`
 }
+
+// @Description OPDS feed token status. Token and FeedURL are only set right after the token is created.
+type FeedTokenResponse struct {
+	Enabled    bool   `json:"enabled" example:"true"`
+	Token      string `json:"token,omitempty" example:"k3Jd9x..." description:"Raw token, shown once"`
+	FeedURL    string `json:"feed_url,omitempty" example:"/opds/token/k3Jd9x.../" description:"Catalog URL to add to an e-reader"`
+	CreatedAt  int64  `json:"created_at,string,omitempty" example:"1640995200"`
+	LastUsedAt int64  `json:"last_used_at,string,omitempty" example:"1640995200"`
+}
+
+// @Description Request to create a personal access token
+type CreatePersonalTokenRequest struct {
+	Name          string `json:"name" example:"backup script" binding:"required" maxLength:"100"`
+	Scope         string `json:"scope" example:"read" binding:"required" enums:"read,download,admin"`
+	ExpiresInDays int    `json:"expires_in_days" example:"90" description:"Days until the token expires, 0 for never"`
+}
+
+// @Description A newly created personal access token. The raw token is only returned once.
+type CreatePersonalTokenResponse struct {
+	Token         string              `json:"token" example:"mat_k3Jd9x..." description:"Send as Authorization: Bearer <token>"`
+	PersonalToken model.PersonalToken `json:"personal_token"`
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/api"
+	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxPersonalTokens caps how many tokens one user can hold
+const maxPersonalTokens = 50
+
+// @Summary List personal access tokens
+// @Description List the current user's personal access tokens with their scope and when they were last used.
+// @Tags Account
+// @Produce json
+// @Security CookieAuth
+// @Success 200 {array} model.PersonalToken "Personal access tokens"
+// @Failure 401 {object} api.ErrorResponse "Unauthorized - invalid or missing session cookie"
+// @Failure 403 {object} api.ErrorResponse "Requested with a personal token"
+// @Failure 500 {object} api.ErrorResponse "Internal server error"
+// @Router /auth/tokens [get]
+func (ar *AuthRouter) HandleListPersonalTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	tokens, err := ar.PersonalTokenRepo.GetTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		applog.Error("Failed to list personal tokens:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, api.EmptyIfNil(tokens))
+}
+
+// @Summary Create personal access token
+// @Description Create a long-lived token for scripts and other clients, sent as "Authorization: Bearer <token>". The read scope allows browsing and searching, download also allows downloading book files and requesting downloads, and admin (admins only) allows everything else too, such as favorites, uploads and account changes. The raw token is only returned here.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security CookieAuth
+// @Param request body CreatePersonalTokenRequest true "Token name, scope and expiry"
+// @Success 201 {object} CreatePersonalTokenResponse "Created token"
+// @Failure 400 {object} api.ErrorResponse "Invalid name, scope or expiry"
+// @Failure 401 {object} api.ErrorResponse "Unauthorized - invalid or missing session cookie"
+// @Failure 403 {object} api.ErrorResponse "Admin scope requested by a non-admin, or requested with a personal token"
+// @Failure 409 {object} api.ErrorResponse "Too many tokens"
+// @Failure 500 {object} api.ErrorResponse "Internal server error"
+// @Router /auth/tokens [post]
+func (ar *AuthRouter) HandleCreatePersonalToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	req, err := api.DecodeJSON[CreatePersonalTokenRequest](w, r)
+	if err != nil {
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "name must be 1 to 100 characters")
+		return
+	}
+	if !model.ValidTokenScope(req.Scope) {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "scope must be read, download or admin")
+		return
+	}
+	if req.Scope == model.TokenScopeAdmin && user.Role != "admin" {
+		api.WriteMessage(w, http.StatusForbidden, "error", "only admins can create admin tokens")
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "expires_in_days cannot be negative")
+		return
+	}
+
+	count, err := ar.PersonalTokenRepo.CountTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		applog.Error("Failed to count personal tokens:", err)
+		api.WriteInternalError(w)
+		return
+	}
+	if count >= maxPersonalTokens {
+		api.WriteMessage(w, http.StatusConflict, "error", "too many tokens, revoke one first")
+		return
+	}
+
+	raw, err := utils.GetRandomToken(32)
+	if err != nil {
+		applog.Error("Failed to generate personal token:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	now := time.Now()
+	token := model.PersonalToken{
+		ID:        utils.GenerateSnowflakeID(),
+		UserID:    user.ID,
+		Name:      req.Name,
+		TokenHash: raw.Hash,
+		TokenHint: raw.Raw[:6],
+		Scope:     req.Scope,
+		CreatedAt: now.Unix(),
+	}
+	if req.ExpiresInDays > 0 {
+		token.ExpiresAt = now.AddDate(0, 0, req.ExpiresInDays).Unix()
+	}
+
+	if err := ar.PersonalTokenRepo.CreateToken(r.Context(), &token); err != nil {
+		applog.Error("Failed to save personal token:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	applog.Info("Personal token created", "userID:", user.ID, "scope:", token.Scope)
+	api.WriteJSON(w, http.StatusCreated, CreatePersonalTokenResponse{
+		Token:         model.PersonalTokenPrefix + raw.Raw,
+		PersonalToken: token,
+	})
+}
+
+// @Summary Revoke personal access token
+// @Description Revoke one of the current user's personal access tokens.
+// @Tags Account
+// @Produce json
+// @Security CookieAuth
+// @Param tokenID path string true "Token ID"
+// @Success 200 {object} api.SuccessResponse "Token revoked"
+// @Failure 400 {object} api.ErrorResponse "Invalid token ID"
+// @Failure 401 {object} api.ErrorResponse "Unauthorized - invalid or missing session cookie"
+// @Failure 403 {object} api.ErrorResponse "Requested with a personal token"
+// @Failure 404 {object} api.ErrorResponse "Token not found"
+// @Failure 500 {object} api.ErrorResponse "Internal server error"
+// @Router /auth/tokens/{tokenID} [delete]
+func (ar *AuthRouter) HandleDeletePersonalToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "invalid token ID")
+		return
+	}
+
+	deleted, err := ar.PersonalTokenRepo.DeleteToken(r.Context(), tokenID, user.ID)
+	if err != nil {
+		applog.Error("Failed to revoke personal token:", err)
+		api.WriteInternalError(w)
+		return
+	}
+	if !deleted {
+		api.WriteMessage(w, http.StatusNotFound, "error", "token not found")
+		return
+	}
+
+	applog.Info("Personal token revoked", "userID:", user.ID, "tokenID:", tokenID)
+	api.WriteMessage(w, http.StatusOK, "success", "token revoked")
+}
@@ -14,14 +14,18 @@ type AuthRouter struct {
 	TokenRepo          *repo.TokenRepo
 	LockoutRepo        *repo.LockoutRepo
 	RequestCreditsRepo *repo.RequestCreditsRepo
+	FeedTokenRepo      *repo.FeedTokenRepo
+	PersonalTokenRepo  *repo.PersonalTokenRepo
 }
 
-func NewAuthRouter(userRepo *repo.UserRepo, tokenRepo *repo.TokenRepo, lockoutRepo *repo.LockoutRepo, requestCreditsRepo *repo.RequestCreditsRepo) http.Handler {
+func NewAuthRouter(userRepo *repo.UserRepo, tokenRepo *repo.TokenRepo, lockoutRepo *repo.LockoutRepo, requestCreditsRepo *repo.RequestCreditsRepo, feedTokenRepo *repo.FeedTokenRepo, personalTokenRepo *repo.PersonalTokenRepo) http.Handler {
 	ar := &AuthRouter{
 		UserRepo:           userRepo,
 		TokenRepo:          tokenRepo,
 		LockoutRepo:        lockoutRepo,
 		RequestCreditsRepo: requestCreditsRepo,
+		FeedTokenRepo:      feedTokenRepo,
+		PersonalTokenRepo:  personalTokenRepo,
 	}
 	r := chi.NewRouter()
 
@@ -39,7 +43,8 @@ func NewAuthRouter(userRepo *repo.UserRepo, tokenRepo *repo.TokenRepo, lockoutRe
 	//8/hour+auth+recaptcha
 	r.Group(func(r chi.Router) {
 		middleware.AddRatelimit(r, 8, 1*time.Hour)
-		middleware.AddAuth(r, ar.UserRepo, ar.TokenRepo)
+		middleware.AddAuth(r, ar.UserRepo, ar.TokenRepo, ar.PersonalTokenRepo)
+		r.Use(middleware.SessionOnly)
 		middleware.AddRecaptcha(r)
 		r.Post("/change-password", ar.HandleChangePassword)
 	})
@@ -47,11 +52,24 @@ func NewAuthRouter(userRepo *repo.UserRepo, tokenRepo *repo.TokenRepo, lockoutRe
 	//30/min+auth
 	r.Group(func(r chi.Router) {
 		middleware.AddRatelimit(r, 30, 1*time.Minute)
-		middleware.AddAuth(r, ar.UserRepo, ar.TokenRepo)
+		middleware.AddAuth(r, ar.UserRepo, ar.TokenRepo, ar.PersonalTokenRepo)
 		r.Get("/me", ar.HandleProfile)
 		r.Get("/me/credits", ar.HandleGetMyCredits)
 	})
 
+	//30/min+auth, not with personal tokens
+	r.Group(func(r chi.Router) {
+		middleware.AddRatelimit(r, 30, 1*time.Minute)
+		middleware.AddAuth(r, ar.UserRepo, ar.TokenRepo, ar.PersonalTokenRepo)
+		r.Use(middleware.SessionOnly)
+		r.Get("/me/feed-token", ar.HandleGetFeedToken)
+		r.Post("/me/feed-token", ar.HandleCreateFeedToken)
+		r.Delete("/me/feed-token", ar.HandleDeleteFeedToken)
+		r.Get("/tokens", ar.HandleListPersonalTokens)
+		r.Post("/tokens", ar.HandleCreatePersonalToken)
+		r.Delete("/tokens/{tokenID}", ar.HandleDeletePersonalToken)
+	})
+
 	//15/min
 	r.Group(func(r chi.Router) {
 		middleware.AddRatelimit(r, 15, 1*time.Minute)
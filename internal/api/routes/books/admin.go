@@ -1,12 +1,17 @@
 package books
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
 	"net/http"
-	"os"
+	"path"
 
 	"github.com/akramboussanni/marchive/internal/api"
 	"github.com/akramboussanni/marchive/internal/applog"
 	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/storage"
 	"github.com/akramboussanni/marchive/internal/utils"
 	"github.com/go-chi/chi/v5"
 )
@@ -63,12 +68,11 @@ func (br *BookRouter) HandleDeleteBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete the physical file if it exists
-	if book.FilePath != "" {
-		if err := os.Remove(book.FilePath); err != nil && !os.IsNotExist(err) {
-			applog.Error("Failed to delete book file:", err)
-			// Continue anyway to remove from database
-		}
+	// Delete the stored files, continuing anyway to remove from database
+	br.deleteStored(r.Context(), book.FilePath)
+	br.deleteDerived(r.Context(), book.Hash)
+	if storage.IsStoredCover(book.CoverData) {
+		br.deleteStored(r.Context(), book.CoverData)
 	}
 
 	// Delete from database
@@ -105,6 +109,8 @@ func (br *BookRouter) HandleUpdateBookMetadata(w http.ResponseWriter, r *http.Re
 		api.WriteInternalError(w)
 		return
 	}
+	// Converted copies carry the old title and authors
+	br.deleteDerived(r.Context(), req.BookHash)
 
 	api.WriteMessage(w, http.StatusOK, "success", "Book metadata updated successfully")
 }
@@ -153,6 +159,8 @@ func (br *BookRouter) HandleGetBookDetail(w http.ResponseWriter, r *http.Request
 		DownloadCount: book.DownloadCount,
 		IsGhost:       book.IsGhost,
 		RequestedBy:   book.RequestedBy,
+		ISBN:          book.ISBN,
+		Description:   book.Description,
 		CreatedAt:     book.CreatedAt,
 	}
 
@@ -199,19 +207,66 @@ func (br *BookRouter) HandleUploadBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	format := utils.GetFileExtension(bookHeader.Filename)
+
+	// Fields left empty in the form are filled from the file's own metadata
+	meta := br.extractMetadata(bookFile, bookHeader.Size, format)
+
 	// Get metadata
-	title := r.FormValue("title")
-	if title == "" {
-		api.WriteMessage(w, http.StatusBadRequest, "error", "title is required")
+	title := firstNonEmpty(r.FormValue("title"), meta.Title, utils.GuessBookTitle(bookHeader.Filename))
+	authors := firstNonEmpty(r.FormValue("authors"), meta.AuthorList())
+	publisher := firstNonEmpty(r.FormValue("publisher"), meta.Publisher)
+	language := firstNonEmpty(r.FormValue("language"), meta.Language)
+
+	// Books are stored under the MD5 of their content, the hash Anna's Archive
+	// uses too, so a file that is already in the library is linked instead of
+	// stored twice
+	hash, err := hashUpload(bookFile)
+	if err != nil {
+		applog.Error("Failed to hash book file:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	existing, lookupErr := br.BookRepo.GetBookByHash(r.Context(), hash)
+	if errors.Is(lookupErr, sql.ErrNoRows) {
+		existing = nil
+	} else if lookupErr != nil {
+		applog.Error("Failed to look up book:", lookupErr)
+		api.WriteInternalError(w)
 		return
 	}
-	authors := r.FormValue("authors")
-	publisher := r.FormValue("publisher")
-	language := r.FormValue("language")
+	if existing != nil && existing.Status == model.BookStatusReady && existing.FilePath != "" {
+		if _, err := br.Storage.Stat(r.Context(), existing.FilePath); err == nil {
+			api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+				"status":    "success",
+				"message":   "Book is already in the library",
+				"duplicate": true,
+				"book":      newBookWithStats(existing),
+			})
+			return
+		}
+	}
+
+	// A fetch still running for the book would overwrite the upload when it
+	// finishes, so the upload has to wait for it
+	if existing != nil {
+		busy, err := br.fetchInProgress(r.Context(), existing)
+		if err != nil {
+			applog.Error("Failed to check download jobs:", err)
+			api.WriteInternalError(w)
+			return
+		}
+		if busy {
+			api.WriteMessage(w, http.StatusConflict, "error", "book is being downloaded, try again once it finishes")
+			return
+		}
+	}
 
 	// Get cover image (optional)
 	var coverPath string
 	var coverData string
+	var coverSize int64
 	coverFile, coverHeader, err := r.FormFile("cover")
 	if err == nil {
 		defer coverFile.Close()
@@ -223,33 +278,37 @@ func (br *BookRouter) HandleUploadBook(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Save cover image
-		coverPath, err = utils.SaveUploadedFile(coverFile, coverHeader, "downloads/covers")
+		coverPath, err = br.saveUpload(r.Context(), coverFile, coverHeader, storage.CoversPrefix)
 		if err != nil {
 			applog.Error("Failed to save cover image:", err)
 			api.WriteInternalError(w)
 			return
 		}
-		coverData = coverPath // Store path as cover data for now
+		coverData = coverPath // Store the storage key as cover data for now
+		coverSize = coverHeader.Size
+	} else if meta.Cover != nil {
+		// No cover given, use the one embedded in the book
+		coverPath, err = br.saveCover(r.Context(), meta.Cover)
+		if err != nil {
+			applog.Error("Failed to save embedded cover:", err)
+			coverPath = ""
+		} else {
+			coverData = coverPath
+			coverSize = int64(len(meta.Cover.Data))
+		}
 	}
 
 	// Save book file
-	bookPath, err := utils.SaveUploadedFile(bookFile, bookHeader, "downloads/uploads")
+	bookPath, written, err := br.storeContent(r.Context(), bookFile, bookHeader.Size, hash, format)
 	if err != nil {
 		applog.Error("Failed to save book file:", err)
 		// Clean up cover if it was saved
-		if coverPath != "" {
-			utils.DeleteFile(coverPath)
-		}
+		br.deleteStored(r.Context(), coverPath)
 		api.WriteInternalError(w)
 		return
 	}
 
-	// Get file size and format
-	fileSize, _ := utils.GetFileSize(bookPath)
-	format := utils.GetFileExtension(bookHeader.Filename)
-
-	// Generate unique hash for the book
-	hash := utils.GenerateHash(bookPath)
+	fileSize := bookHeader.Size
 
 	// Create book record
 	book := &model.SavedBook{
@@ -267,16 +326,29 @@ func (br *BookRouter) HandleUploadBook(w http.ResponseWriter, r *http.Request) {
 		IsUploaded:       true,
 		UploadedBy:       &user.ID,
 		OriginalFilename: bookHeader.Filename,
+		FileSize:         fileSize,
+		CoverSize:        coverSize,
+		ISBN:             meta.ISBN,
+		Description:      meta.Description,
+	}
+
+	// The book is known but its file never arrived or went missing; the
+	// upload fills it in
+	if existing != nil {
+		br.attachUpload(w, r, existing, book)
+		return
 	}
 
 	// Save to database
 	if err := br.BookRepo.CreateUploadedBook(r.Context(), book); err != nil {
 		applog.Error("Failed to create book record:", err)
-		// Clean up files
-		utils.DeleteFile(bookPath)
-		if coverPath != "" {
-			utils.DeleteFile(coverPath)
+		// Clean up files, unless a concurrent upload of the same file now owns it
+		if written {
+			if _, err := br.BookRepo.GetBookByHash(r.Context(), hash); err != nil {
+				br.deleteStored(r.Context(), bookPath)
+			}
 		}
+		br.deleteStored(r.Context(), coverPath)
 		api.WriteInternalError(w)
 		return
 	}
@@ -284,25 +356,89 @@ func (br *BookRouter) HandleUploadBook(w http.ResponseWriter, r *http.Request) {
 	api.WriteJSON(w, http.StatusCreated, map[string]interface{}{
 		"status":  "success",
 		"message": "Book uploaded successfully",
-		"book": BookWithStats{
-			Hash:             book.Hash,
-			Title:            book.Title,
-			Authors:          book.Authors,
-			Publisher:        book.Publisher,
-			Language:         book.Language,
-			Format:           book.Format,
-			Size:             book.Size,
-			CoverURL:         book.CoverURL,
-			CoverData:        book.CoverData,
-			Status:           book.Status,
-			IsUploaded:       book.IsUploaded,
-			UploadedBy:       book.UploadedBy,
-			OriginalFilename: book.OriginalFilename,
-			CreatedAt:        book.CreatedAt,
-		},
+		"book":    newBookWithStats(book),
 	})
 }
 
+// attachUpload points a known book at the file and cover of an upload and
+// marks it ready. An uploaded cover replaces the book's own uploaded cover.
+func (br *BookRouter) attachUpload(w http.ResponseWriter, r *http.Request, book, upload *model.SavedBook) {
+	if err := br.BookRepo.UpdateBookStatus(r.Context(), book.Hash, model.BookStatusReady, upload.FilePath); err != nil {
+		applog.Error("Failed to attach uploaded file:", err)
+		br.deleteStored(r.Context(), upload.CoverData)
+		api.WriteInternalError(w)
+		return
+	}
+	if err := br.BookRepo.UpdateFileSize(r.Context(), book.Hash, upload.FileSize); err != nil {
+		applog.Error("Failed to record file size:", err)
+	}
+	br.deleteDerived(r.Context(), book.Hash)
+
+	if upload.CoverData != "" {
+		if err := br.BookRepo.UpdateBookCover(r.Context(), book.Hash, book.CoverURL, upload.CoverData); err != nil {
+			applog.Error("Failed to update book cover:", err)
+			br.deleteStored(r.Context(), upload.CoverData)
+		} else {
+			if storage.IsStoredCover(book.CoverData) {
+				br.deleteStored(r.Context(), book.CoverData)
+			}
+			if err := br.BookRepo.UpdateCoverSize(r.Context(), book.Hash, upload.CoverSize); err != nil {
+				applog.Error("Failed to record cover size:", err)
+			}
+		}
+	}
+
+	updated, err := br.BookRepo.GetBookByHash(r.Context(), book.Hash)
+	if err != nil {
+		applog.Error("Failed to get book:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "Uploaded file attached to existing book",
+		"book":    newBookWithStats(updated),
+	})
+}
+
+// fetchInProgress reports whether the book is being processed or still has
+// a download job queued for it
+func (br *BookRouter) fetchInProgress(ctx context.Context, book *model.SavedBook) (bool, error) {
+	if book.Status == model.BookStatusProcessing {
+		return true, nil
+	}
+	queued, err := br.DownloadJobRepo.CountQueuedJobsForBook(ctx, book.Hash)
+	if err != nil {
+		return false, err
+	}
+	return queued > 0, nil
+}
+
+func newBookWithStats(book *model.SavedBook) BookWithStats {
+	return BookWithStats{
+		Hash:             book.Hash,
+		Title:            book.Title,
+		Authors:          book.Authors,
+		Publisher:        book.Publisher,
+		Language:         book.Language,
+		Format:           book.Format,
+		Size:             book.Size,
+		CoverURL:         book.CoverURL,
+		CoverData:        book.CoverData,
+		Status:           book.Status,
+		DownloadCount:    book.DownloadCount,
+		IsGhost:          book.IsGhost,
+		RequestedBy:      book.RequestedBy,
+		IsUploaded:       book.IsUploaded,
+		UploadedBy:       book.UploadedBy,
+		OriginalFilename: book.OriginalFilename,
+		ISBN:             book.ISBN,
+		Description:      book.Description,
+		CreatedAt:        book.CreatedAt,
+	}
+}
+
 func (br *BookRouter) HandleUpdateCover(w http.ResponseWriter, r *http.Request) {
 	user, ok := utils.UserFromContext(r.Context())
 	if !ok {
@@ -351,13 +487,8 @@ func (br *BookRouter) HandleUpdateCover(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Delete old cover if it exists
-	if book.CoverData != "" {
-		utils.DeleteFile(book.CoverData)
-	}
-
 	// Save new cover image
-	coverPath, err := utils.SaveUploadedFile(coverFile, coverHeader, "downloads/covers")
+	coverPath, err := br.saveUpload(r.Context(), coverFile, coverHeader, storage.CoversPrefix)
 	if err != nil {
 		applog.Error("Failed to save cover image:", err)
 		api.WriteInternalError(w)
@@ -367,15 +498,23 @@ func (br *BookRouter) HandleUpdateCover(w http.ResponseWriter, r *http.Request)
 	// Update database
 	if err := br.BookRepo.UpdateBookCover(r.Context(), hash, "", coverPath); err != nil {
 		applog.Error("Failed to update book cover:", err)
-		utils.DeleteFile(coverPath)
+		br.deleteStored(r.Context(), coverPath)
 		api.WriteInternalError(w)
 		return
 	}
+	if err := br.BookRepo.UpdateCoverSize(r.Context(), hash, coverHeader.Size); err != nil {
+		applog.Error("Failed to record cover size:", err)
+	}
+
+	// Delete old cover now that nothing points at it
+	if storage.IsStoredCover(book.CoverData) {
+		br.deleteStored(r.Context(), book.CoverData)
+	}
 
 	api.WriteMessage(w, http.StatusOK, "success", "Cover updated successfully")
 }
 
-// HandleRestoreBooks scans the downloads directory and adds any books not in the database
+// HandleRestoreBooks scans storage and adds any books not in the database
 func (br *BookRouter) HandleRestoreBooks(w http.ResponseWriter, r *http.Request) {
 	user, ok := utils.UserFromContext(r.Context())
 	if !ok {
@@ -394,33 +533,23 @@ func (br *BookRouter) HandleRestoreBooks(w http.ResponseWriter, r *http.Request)
 		".djvu": true, ".fb2": true, ".txt": true,
 	}
 
-	// Directories to scan
-	downloadsDirs := []string{"downloads", "downloads/uploads"}
+	// Storage prefixes to scan: downloaded books sit at the root
+	prefixes := []string{"", storage.UploadsPrefix}
 	
 	var restored int
 	var skipped int
 	var errors []string
 
-	for _, dir := range downloadsDirs {
-		// Check if directory exists
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			continue
-		}
-
-		// Read directory entries
-		entries, err := os.ReadDir(dir)
+	for _, prefix := range prefixes {
+		objects, err := br.Storage.List(r.Context(), prefix)
 		if err != nil {
-			applog.Error("Failed to read directory:", err)
-			errors = append(errors, "Failed to read "+dir)
+			applog.Error("Failed to list stored files:", err)
+			errors = append(errors, "Failed to read "+prefix)
 			continue
 		}
 
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
-
-			filename := entry.Name()
+		for _, obj := range objects {
+			filename := path.Base(obj.Key)
 			ext := utils.GetFileExtensionWithDot(filename)
 
 			// Skip non-book files
@@ -428,14 +557,8 @@ func (br *BookRouter) HandleRestoreBooks(w http.ResponseWriter, r *http.Request)
 				continue
 			}
 
-			// Get full path
-			filePath, err := utils.GetAbsolutePath(dir, filename)
-			if err != nil {
-				continue
-			}
-
 			// Check if this file is already in the database by file path
-			exists, err := br.BookRepo.BookExistsByFilePath(r.Context(), filePath)
+			exists, err := br.storedBookExists(r.Context(), obj.Key)
 			if err != nil {
 				applog.Error("Failed to check book existence:", err)
 				continue
@@ -446,37 +569,60 @@ func (br *BookRouter) HandleRestoreBooks(w http.ResponseWriter, r *http.Request)
 				continue
 			}
 
-			// Get file info
-			info, err := entry.Info()
+			format := utils.GetFileExtension(filename)
+
+			// A file already known under its content hash is a copy, not a new book
+			hash, meta, err := br.inspectStored(r.Context(), obj.Key, obj.Size, format)
 			if err != nil {
+				applog.Error("Failed to hash stored file:", err)
+				errors = append(errors, "Failed to read: "+filename)
+				continue
+			}
+			if _, err := br.BookRepo.GetBookByHash(r.Context(), hash); err == nil {
+				skipped++
 				continue
 			}
 
-			// Guess metadata from filename
-			title := utils.GuessBookTitle(filename)
-			format := utils.GetFileExtension(filename)
+			// Use the file's own metadata, guessing the title from the filename without it
+			title := firstNonEmpty(meta.Title, utils.GuessBookTitle(filename))
+
+			var coverData string
+			var coverSize int64
+			if meta.Cover != nil {
+				if key, err := br.saveCover(r.Context(), meta.Cover); err != nil {
+					applog.Error("Failed to save embedded cover:", err)
+				} else {
+					coverData = key
+					coverSize = int64(len(meta.Cover.Data))
+				}
+			}
 
 			// Create book record
 			book := &model.SavedBook{
-				Hash:             utils.GenerateHash(filePath),
+				Hash:             hash,
 				Title:            title,
-				Authors:          "",
-				Publisher:        "",
-				Language:         "",
+				Authors:          meta.AuthorList(),
+				Publisher:        meta.Publisher,
+				Language:         meta.Language,
 				Format:           format,
-				Size:             utils.FormatFileSize(info.Size()),
+				Size:             utils.FormatFileSize(obj.Size),
+				FileSize:         obj.Size,
 				CoverURL:         "",
-				CoverData:        "",
-				FilePath:         filePath,
+				CoverData:        coverData,
+				CoverSize:        coverSize,
+				FilePath:         obj.Key,
 				Status:           model.BookStatusReady,
 				IsUploaded:       true,
 				UploadedBy:       &user.ID,
 				OriginalFilename: filename,
+				ISBN:             meta.ISBN,
+				Description:      meta.Description,
 			}
 
 			if err := br.BookRepo.CreateUploadedBook(r.Context(), book); err != nil {
 				applog.Error("Failed to create book record:", err)
 				errors = append(errors, "Failed to add: "+filename)
+				br.deleteStored(r.Context(), coverData)
 				continue
 			}
 
@@ -493,3 +639,54 @@ func (br *BookRouter) HandleRestoreBooks(w http.ResponseWriter, r *http.Request)
 
 	api.WriteJSON(w, http.StatusOK, response)
 }
+
+// HandleInspectUpload reads the metadata embedded in a book file without
+// storing it, so the upload form can be prefilled. The cover comes back as a
+// data URI.
+func (br *BookRouter) HandleInspectUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		applog.Error("Failed to parse multipart form:", err)
+		api.WriteMessage(w, http.StatusBadRequest, "error", "failed to parse form data")
+		return
+	}
+
+	bookFile, bookHeader, err := r.FormFile("book")
+	if err != nil {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "book file is required")
+		return
+	}
+	defer bookFile.Close()
+
+	if err := utils.ValidateBookFile(bookHeader); err != nil {
+		api.WriteMessage(w, http.StatusBadRequest, "error", err.Error())
+		return
+	}
+
+	hash, err := hashUpload(bookFile)
+	if err != nil {
+		applog.Error("Failed to hash book file:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	meta := br.extractMetadata(bookFile, bookHeader.Size, utils.GetFileExtension(bookHeader.Filename))
+	response := InspectUploadResponse{
+		Hash:        hash,
+		Title:       firstNonEmpty(meta.Title, utils.GuessBookTitle(bookHeader.Filename)),
+		Authors:     api.EmptyIfNil(meta.Authors),
+		Language:    meta.Language,
+		Publisher:   meta.Publisher,
+		ISBN:        meta.ISBN,
+		Description: meta.Description,
+	}
+	if meta.Cover != nil {
+		response.CoverData = "data:" + meta.Cover.MediaType + ";base64," + base64.StdEncoding.EncodeToString(meta.Cover.Data)
+	}
+
+	if existing, err := br.BookRepo.GetBookByHash(r.Context(), hash); err == nil && existing.Status == model.BookStatusReady {
+		stats := newBookWithStats(existing)
+		response.ExistingBook = &stats
+	}
+
+	api.WriteJSON(w, http.StatusOK, response)
+}
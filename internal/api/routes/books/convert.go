@@ -0,0 +1,88 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/akramboussanni/marchive/internal/convert"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/storage"
+)
+
+// derivedFile returns the storage key of the book converted to format,
+// converting it on first request and caching the result next to the original
+func (br *BookRouter) derivedFile(ctx context.Context, book *model.SavedBook, format string) (string, error) {
+	key, err := convert.DerivedKey(book.Hash, format)
+	if err != nil {
+		return "", err
+	}
+	if _, err := br.Storage.Stat(ctx, key); err == nil {
+		return key, nil
+	} else if !errors.Is(err, storage.ErrNotExist) {
+		return "", err
+	}
+
+	obj, err := br.Storage.Open(ctx, book.FilePath)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+
+	info, err := br.Storage.Stat(ctx, book.FilePath)
+	if err != nil {
+		return "", err
+	}
+
+	// Converters read at offsets, so remote objects are spooled first
+	in, ok := obj.(io.ReaderAt)
+	if !ok {
+		spool, err := os.CreateTemp("", "marchive-convert-in-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		if _, err := io.Copy(spool, obj); err != nil {
+			return "", err
+		}
+		in = spool
+	}
+
+	out, err := os.CreateTemp("", "marchive-convert-out-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(out.Name())
+
+	// EPUB wants a language code, not the name books are listed with
+	bookInfo := convert.Info{
+		Hash:     book.Hash,
+		Title:    book.Title,
+		Authors:  book.Authors,
+		Language: model.ISOLanguageCode(book.Language),
+	}
+	err = convert.Convert(ctx, book.Format, format, in, info.Size, out, bookInfo)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("converting %s to %s: %w", book.Format, format, err)
+	}
+
+	if err := br.Storage.PutFile(ctx, key, out.Name()); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// deleteDerived removes every cached conversion of a book. They go stale
+// when its file is replaced or its metadata edited.
+func (br *BookRouter) deleteDerived(ctx context.Context, hash string) {
+	for _, key := range convert.DerivedKeys(hash) {
+		br.deleteStored(ctx, key)
+	}
+}
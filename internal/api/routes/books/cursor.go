@@ -0,0 +1,87 @@
+package books
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/search"
+)
+
+var (
+	errInvalidCursor  = errors.New("invalid cursor")
+	errCursorMismatch = errors.New("cursor belongs to a different search")
+)
+
+// searchCursor marks where the next page of a search starts. Saved books
+// come first and results from Anna's Archive follow, so a page can end
+// partway through either list. Anna's Archive is searched a few result
+// pages at a time; once those run out the cursor moves on to the next few.
+type searchCursor struct {
+	Local int `json:"l"`
+	// Position in the results from the current Anna pages
+	Anna int `json:"a"`
+	// First of the current Anna pages, zero for the search's own
+	AnnaPage int `json:"p,omitempty"`
+	// Results from earlier Anna pages
+	AnnaBefore int `json:"b,omitempty"`
+	// Fingerprint of the search the cursor was made for
+	Search string `json:"s"`
+}
+
+// cursorAt turns an offset into the merged results into a cursor
+func cursorAt(offset, localTotal int, search string) searchCursor {
+	local := min(offset, localTotal)
+	return searchCursor{Local: local, Anna: offset - local, Search: search}
+}
+
+func (c searchCursor) offset() int {
+	return c.Local + c.AnnaBefore + c.Anna
+}
+
+func (c searchCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a cursor from a previous page of the search with the
+// given fingerprint
+func decodeCursor(raw, search string) (searchCursor, error) {
+	var c searchCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.Local < 0 || c.Anna < 0 || c.AnnaPage < 0 || c.AnnaBefore < 0 {
+		return c, errInvalidCursor
+	}
+	if c.Search != search {
+		return c, errCursorMismatch
+	}
+	return c, nil
+}
+
+// searchFingerprint identifies a search by everything that decides its
+// results, so a cursor can't be replayed against another one
+func searchFingerprint(searchType string, f model.BookFilter, annaQuery anna.SearchQuery) string {
+	requestedBy := ""
+	if f.RequestedBy != nil {
+		requestedBy = strconv.FormatInt(*f.RequestedBy, 10)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(strings.Join([]string{
+		search.Normalize(f.Query), searchType,
+		f.Language, f.Format, f.Source, requestedBy,
+		strconv.FormatInt(f.CreatedAfter, 10), strconv.FormatInt(f.CreatedBefore, 10),
+		f.Sort,
+		annaQuery.Params().Encode(), strconv.Itoa(annaQuery.Page), strconv.Itoa(annaQuery.Pages),
+	}, "\x00")))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
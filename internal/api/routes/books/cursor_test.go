@@ -0,0 +1,123 @@
+package books
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/model"
+)
+
+func TestCursorAt(t *testing.T) {
+	tests := []struct {
+		offset, localTotal int
+		want               searchCursor
+	}{
+		{0, 10, searchCursor{Local: 0, Anna: 0}},
+		{5, 10, searchCursor{Local: 5, Anna: 0}},
+		{10, 10, searchCursor{Local: 10, Anna: 0}},
+		{15, 10, searchCursor{Local: 10, Anna: 5}},
+		{3, 0, searchCursor{Local: 0, Anna: 3}},
+	}
+
+	for _, tt := range tests {
+		got := cursorAt(tt.offset, tt.localTotal, "search")
+		tt.want.Search = "search"
+		if got != tt.want {
+			t.Errorf("cursorAt(%d, %d) = %+v, want %+v", tt.offset, tt.localTotal, got, tt.want)
+		}
+		if got.offset() != tt.offset {
+			t.Errorf("cursorAt(%d, %d).offset() = %d", tt.offset, tt.localTotal, got.offset())
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursors := []searchCursor{
+		{Local: 0, Anna: 0, Search: "abc"},
+		{Local: 7, Anna: 3, Search: "abc"},
+		{Local: 7, Anna: 2, AnnaPage: 3, AnnaBefore: 40, Search: "abc"},
+	}
+
+	for _, c := range cursors {
+		got, err := decodeCursor(c.encode(), "abc")
+		if err != nil {
+			t.Errorf("decodeCursor(%+v): %v", c, err)
+			continue
+		}
+		if got != c {
+			t.Errorf("decodeCursor(encode(%+v)) = %+v", c, got)
+		}
+	}
+
+	if got := (searchCursor{Local: 7, Anna: 2, AnnaBefore: 40}).offset(); got != 49 {
+		t.Errorf("offset() = %d, want 49", got)
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{"not base64", "!!!", errInvalidCursor},
+		{"not json", encode("not json"), errInvalidCursor},
+		{"negative local", encode(`{"l":-1,"a":0,"s":"abc"}`), errInvalidCursor},
+		{"negative anna", encode(`{"l":0,"a":-1,"s":"abc"}`), errInvalidCursor},
+		{"negative page", encode(`{"l":0,"a":0,"p":-1,"s":"abc"}`), errInvalidCursor},
+		{"other search", searchCursor{Local: 1, Search: "xyz"}.encode(), errCursorMismatch},
+		{"no search", encode(`{"l":1,"a":0}`), errCursorMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.raw, "abc"); !errors.Is(err, tt.want) {
+				t.Errorf("decodeCursor() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFingerprint(t *testing.T) {
+	base := func() (string, model.BookFilter, anna.SearchQuery) {
+		return "all", model.BookFilter{Query: "go programming", Sort: model.BookSortRelevance},
+			anna.SearchQuery{Query: "go programming", Page: 1, Pages: 1}
+	}
+	searchType, filter, query := base()
+	want := searchFingerprint(searchType, filter, query)
+
+	// Searches that only differ in case and spacing are the same search
+	searchType, filter, query = base()
+	filter.Query = "  Go   Programming "
+	if got := searchFingerprint(searchType, filter, query); got != want {
+		t.Errorf("fingerprint changed with case and spacing: %s != %s", got, want)
+	}
+
+	requester := int64(42)
+	changes := map[string]func(*string, *model.BookFilter, *anna.SearchQuery){
+		"query":        func(_ *string, f *model.BookFilter, _ *anna.SearchQuery) { f.Query = "rust programming" },
+		"search type":  func(s *string, _ *model.BookFilter, _ *anna.SearchQuery) { *s = "missing" },
+		"language":     func(_ *string, f *model.BookFilter, _ *anna.SearchQuery) { f.Language = "en" },
+		"format":       func(_ *string, f *model.BookFilter, _ *anna.SearchQuery) { f.Format = "epub" },
+		"source":       func(_ *string, f *model.BookFilter, _ *anna.SearchQuery) { f.Source = model.BookSourceAnna },
+		"requester":    func(_ *string, f *model.BookFilter, _ *anna.SearchQuery) { f.RequestedBy = &requester },
+		"date":         func(_ *string, f *model.BookFilter, _ *anna.SearchQuery) { f.CreatedAfter = 1 },
+		"sort":         func(_ *string, f *model.BookFilter, _ *anna.SearchQuery) { f.Sort = model.BookSortTitle },
+		"content type": func(_ *string, _ *model.BookFilter, q *anna.SearchQuery) { q.ContentType = "book_fiction" },
+		"anna page":    func(_ *string, _ *model.BookFilter, q *anna.SearchQuery) { q.Page = 2 },
+		"anna pages":   func(_ *string, _ *model.BookFilter, q *anna.SearchQuery) { q.Pages = 3 },
+	}
+	for name, change := range changes {
+		searchType, filter, query := base()
+		change(&searchType, &filter, &query)
+		if got := searchFingerprint(searchType, filter, query); got == want {
+			t.Errorf("fingerprint ignores the %s", name)
+		}
+	}
+}
@@ -3,13 +3,17 @@ package books
 import (
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/akramboussanni/marchive/internal/anna"
 	"github.com/akramboussanni/marchive/internal/api"
 	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/convert"
+	"github.com/akramboussanni/marchive/internal/events"
 	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/storage"
 	"github.com/akramboussanni/marchive/internal/utils"
 	"github.com/go-chi/chi/v5"
 )
@@ -22,6 +26,11 @@ func (br *BookRouter) HandleRequestDownload(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		return
 	}
+	// The hash names files on disk, so it must be a plain MD5
+	if !anna.IsMD5(req.Hash) {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "invalid book hash")
+		return
+	}
 
 	var canDownload bool
 
@@ -255,17 +264,81 @@ func (br *BookRouter) HandleJobStatus(w http.ResponseWriter, r *http.Request) {
 	available := err == nil && book.Status == model.BookStatusReady
 
 	response := JobStatusResponse{
-		JobID:     job.ID,
-		Status:    job.Status,
-		Progress:  job.Progress,
-		ErrorMsg:  job.ErrorMsg,
-		BookHash:  job.BookHash,
-		Available: available,
+		JobID:           job.ID,
+		Status:          job.Status,
+		Progress:        job.Progress,
+		ErrorMsg:        job.ErrorMsg,
+		BookHash:        job.BookHash,
+		Available:       available,
+		DownloadedBytes: job.DownloadedBytes,
+		TotalBytes:      job.TotalBytes,
+		BytesPerSecond:  job.BytesPerSecond,
+		Attempts:        job.Attempts,
+		MaxAttempts:     job.MaxAttempts,
+	}
+
+	// A pending job with a scheduled attempt is waiting out a retry backoff
+	if job.Status == model.DownloadStatusPending && job.NextAttemptAt > time.Now().Unix() {
+		response.NextAttemptAt = &job.NextAttemptAt
+	}
+
+	history, err := br.DownloadJobRepo.GetJobAttempts(r.Context(), job.ID)
+	if err != nil {
+		applog.Error("Failed to get job attempts:", err)
+	}
+	response.History = api.EmptyIfNil(history)
+
+	// ETA is only meaningful while bytes are actually flowing
+	if job.Status == model.DownloadStatusDownloading && job.BytesPerSecond > 0 && job.TotalBytes > job.DownloadedBytes {
+		eta := (job.TotalBytes - job.DownloadedBytes) / job.BytesPerSecond
+		response.ETASeconds = &eta
 	}
 
 	api.WriteJSON(w, http.StatusOK, response)
 }
 
+// HandleCancelJob cancels a queued or running download job. Only the job's
+// owner or an admin may cancel it.
+func (br *BookRouter) HandleCancelJob(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	jobID, err := strconv.ParseInt(chi.URLParam(r, "jobID"), 10, 64)
+	if err != nil {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "invalid job ID")
+		return
+	}
+
+	job, err := br.DownloadJobRepo.GetJobByID(r.Context(), jobID)
+	if err != nil || (job.UserID != user.ID && user.Role != "admin") {
+		api.WriteMessage(w, http.StatusNotFound, "error", "job not found")
+		return
+	}
+
+	cancelled, err := br.DownloadJobRepo.CancelJob(r.Context(), job.ID)
+	if err != nil {
+		applog.Error("Failed to cancel job:", err)
+		api.WriteInternalError(w)
+		return
+	}
+	if !cancelled {
+		api.WriteMessage(w, http.StatusConflict, "error", "job has already finished")
+		return
+	}
+
+	// Stops the transfer if no other job is waiting on the same book
+	br.Downloads.CancelJob(job.ID)
+
+	job.Status = model.DownloadStatusCancelled
+	job.BytesPerSecond = 0
+	br.Events.Publish(events.NewJobEvent(job))
+
+	api.WriteMessage(w, http.StatusOK, "success", "job cancelled")
+}
+
 func (br *BookRouter) HandleDownloadFile(w http.ResponseWriter, r *http.Request) {
 	hash := chi.URLParam(r, "hash")
 	if hash == "" {
@@ -285,12 +358,28 @@ func (br *BookRouter) HandleDownloadFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if _, err := os.Stat(book.FilePath); os.IsNotExist(err) {
-		applog.Error("Book file not found on disk:", book.FilePath)
+	if _, err := br.Storage.Stat(r.Context(), book.FilePath); err != nil {
+		applog.Error("Book file not found in storage:", book.FilePath, err)
 		api.WriteMessage(w, http.StatusNotFound, "error", "book file not available")
 		return
 	}
 
+	// Other formats are converted from the original on first request
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	key := book.FilePath
+	if format != "" && format != strings.ToLower(book.Format) {
+		if !convert.Supported(book.Format, format) {
+			api.WriteMessage(w, http.StatusBadRequest, "error", fmt.Sprintf("cannot convert %s to %s", book.Format, format))
+			return
+		}
+		key, err = br.derivedFile(r.Context(), book, format)
+		if err != nil {
+			applog.Error("Failed to convert book:", hash, err)
+			api.WriteMessage(w, http.StatusUnprocessableEntity, "error", "failed to convert book")
+			return
+		}
+	}
+
 	// Increment download count (skip if fromreader=true to avoid skewing stats)
 	fromReader := r.URL.Query().Get("fromreader") == "true"
 	if !fromReader {
@@ -298,15 +387,46 @@ func (br *BookRouter) HandleDownloadFile(w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			applog.Error("Failed to increment download count:", err)
 		}
+	} else if err := br.BookRepo.TouchLastDownloaded(r.Context(), hash); err != nil {
+		// Reading still keeps the book from being evicted
+		applog.Error("Failed to record book access:", err)
 	}
 
-	filename := filepath.Base(book.FilePath)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	// Files are stored under their hash; offer the title as the name instead
+	filename := book.OriginalFilename
+	if key != book.FilePath {
+		filename = anna.DisplayFilename(book.Title, format)
+	} else if filename == "" {
+		filename = anna.DisplayFilename(book.Title, book.Format)
+	}
 	w.Header().Set("Content-Type", "application/octet-stream")
 
 	applog.Info("User download", "book_hash", hash, "filename", filename)
 
-	http.ServeFile(w, r, book.FilePath)
+	br.serveStored(w, r, key, filename)
+}
+
+// HandleGetCover serves a cover image uploaded for the book. Covers fetched
+// from the source are URLs the client loads directly.
+func (br *BookRouter) HandleGetCover(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	if hash == "" {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "hash is required")
+		return
+	}
+
+	book, err := br.BookRepo.GetBookByHash(r.Context(), hash)
+	if err != nil {
+		api.WriteMessage(w, http.StatusNotFound, "error", "book not found")
+		return
+	}
+
+	if !storage.IsStoredCover(book.CoverData) {
+		api.WriteMessage(w, http.StatusNotFound, "error", "book has no uploaded cover")
+		return
+	}
+
+	br.serveStored(w, r, book.CoverData, "")
 }
 
 func (br *BookRouter) HandleUserDownloads(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,74 @@
+package books
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/api"
+	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/utils"
+)
+
+// eventsKeepAlive is how often a comment is sent on an idle stream so
+// proxies do not close it
+const eventsKeepAlive = 20 * time.Second
+
+// HandleJobEvents streams the user's download job changes as Server-Sent
+// Events. Each event is named "job" and carries the job's state as JSON.
+func (br *BookRouter) HandleJobEvents(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		applog.Error("Streaming not supported:", err)
+		return
+	}
+
+	sub := br.Events.Subscribe(user.ID)
+	defer br.Events.Unsubscribe(sub)
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				applog.Error("Failed to encode job event:", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: job\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/akramboussanni/marchive/internal/api"
 	"github.com/akramboussanni/marchive/internal/applog"
-	"github.com/akramboussanni/marchive/internal/model"
 	"github.com/akramboussanni/marchive/internal/utils"
 )
 
@@ -29,6 +28,12 @@ func (br *BookRouter) HandleExplore(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	filter, err := filterFromQuery(r)
+	if err != nil {
+		api.WriteMessage(w, http.StatusBadRequest, "error", err.Error())
+		return
+	}
+
 	// Get user from context if authenticated
 	user, hasUser := utils.UserFromContext(r.Context())
 	var userID int64
@@ -38,40 +43,31 @@ func (br *BookRouter) HandleExplore(w http.ResponseWriter, r *http.Request) {
 		isAdmin = user.Role == "admin"
 	}
 
-	var books []model.SavedBook
-	var total int
-	var err error
-
-	if hasUser {
-		applog.Info("Getting books for user", "userID", userID, "isAdmin", isAdmin)
-		books, err = br.BookRepo.GetBooksForUser(r.Context(), userID, isAdmin, limit, offset)
-		if err != nil {
-			applog.Error("Failed to get books:", err)
-			api.WriteInternalError(w)
-			return
-		}
-		applog.Info("Retrieved books", "count", len(books))
-
-		total, err = br.BookRepo.CountBooksForUser(r.Context(), userID, isAdmin)
-	} else {
-		books, err = br.BookRepo.GetBooks(r.Context(), limit, offset)
-		if err != nil {
-			applog.Error("Failed to get books:", err)
-			api.WriteInternalError(w)
-			return
-		}
-
-		total, err = br.BookRepo.CountBooks(r.Context())
+	books, err := br.BookRepo.FilterBooks(r.Context(), filter, userID, isAdmin, limit, offset)
+	if err != nil {
+		applog.Error("Failed to get books:", err)
+		api.WriteInternalError(w)
+		return
 	}
 
+	total, err := br.BookRepo.CountFilteredBooks(r.Context(), filter, userID, isAdmin)
 	if err != nil {
 		applog.Error("Failed to count books:", err)
 		api.WriteInternalError(w)
 		return
 	}
 
+	facets, err := br.BookRepo.GetBookFacets(r.Context(), filter, userID, isAdmin)
+	if err != nil {
+		applog.Error("Failed to count book facets:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
 	response := BookListResponse{
-		Books: make([]BookWithStats, 0, len(books)),
+		Books:  make([]BookWithStats, 0, len(books)),
+		Sort:   filter.Sort,
+		Facets: facets,
 		Pagination: Pagination{
 			Limit:   limit,
 			Offset:  offset,
@@ -0,0 +1,131 @@
+package books
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/akramboussanni/marchive/internal/model"
+)
+
+var (
+	errInvalidSource = errors.New("source must be uploaded or anna")
+	errInvalidSort   = errors.New("sort must be relevance, recent, popular or title")
+)
+
+// checkFilter normalizes the filter and rejects unknown values
+func checkFilter(f *model.BookFilter) error {
+	f.Normalize()
+	if !model.ValidBookSource(f.Source) {
+		return errInvalidSource
+	}
+	if !model.ValidBookSort(f.Sort) {
+		return errInvalidSort
+	}
+	return nil
+}
+
+// filterFromQuery reads a book filter from the URL query
+func filterFromQuery(r *http.Request) (model.BookFilter, error) {
+	q := r.URL.Query()
+	f := model.BookFilter{
+		Language: q.Get("language"),
+		Format:   q.Get("format"),
+		Source:   q.Get("source"),
+		Sort:     q.Get("sort"),
+	}
+
+	if v := q.Get("requested_by"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, errors.New("requested_by must be a user ID")
+		}
+		f.RequestedBy = &id
+	}
+
+	var err error
+	if f.CreatedAfter, err = parseUnixParam(q.Get("created_after")); err != nil {
+		return f, errors.New("created_after must be a unix timestamp")
+	}
+	if f.CreatedBefore, err = parseUnixParam(q.Get("created_before")); err != nil {
+		return f, errors.New("created_before must be a unix timestamp")
+	}
+
+	return f, checkFilter(&f)
+}
+
+func parseUnixParam(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// sortAnnaBooks orders results from Anna's Archive for the filter's sort.
+// They have no download counts or dates, so only a title sort changes the
+// order they came in.
+func sortAnnaBooks(books []*BookWithStatus, f model.BookFilter) {
+	if f.Sort != model.BookSortTitle {
+		return
+	}
+	sort.SliceStable(books, func(i, j int) bool {
+		return strings.ToLower(books[i].Title) < strings.ToLower(books[j].Title)
+	})
+}
+
+// addAnnaFacets adds results from Anna's Archive to the saved books' facet
+// counts. Like the saved books, each facet ignores its own filter.
+func addAnnaFacets(facets *model.BookFacets, books []*BookWithStatus, f model.BookFilter) {
+	anyLanguage, anyFormat, anySource := f, f, f
+	anyLanguage.Language = ""
+	anyFormat.Format = ""
+	anySource.Source = ""
+
+	var languages, formats, sources []string
+	for _, book := range books {
+		if anyLanguage.MatchesAnna(book.Language, book.Format) {
+			languages = append(languages, model.LanguageCode(book.Language))
+		}
+		if anyFormat.MatchesAnna(book.Language, book.Format) {
+			formats = append(formats, book.Format)
+		}
+		if anySource.MatchesAnna(book.Language, book.Format) {
+			sources = append(sources, model.BookSourceAnna)
+		}
+	}
+
+	facets.Languages = addFacetValues(facets.Languages, languages...)
+	facets.Formats = addFacetValues(facets.Formats, formats...)
+	facets.Sources = addFacetValues(facets.Sources, sources...)
+}
+
+// addFacetValues counts values into counts, keeping the most common first
+func addFacetValues(counts []model.FacetCount, values ...string) []model.FacetCount {
+	index := make(map[string]int, len(counts))
+	for i, c := range counts {
+		index[c.Value] = i
+	}
+
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if i, ok := index[v]; ok {
+			counts[i].Count++
+			continue
+		}
+		index[v] = len(counts)
+		counts = append(counts, model.FacetCount{Value: v, Count: 1})
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	return counts
+}
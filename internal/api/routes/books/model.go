@@ -10,6 +10,22 @@ type SearchRequest struct {
 	Limit      int    `json:"limit,omitempty" example:"20"`
 	Offset     int    `json:"offset,omitempty" example:"0"`
 	SearchType string `json:"search_type,omitempty" example:"all"` // "all", "downloaded", "missing"
+	// Filters, applied to both saved books and Anna's Archive results
+	Language      string `json:"language,omitempty" example:"english"`
+	Format        string `json:"format,omitempty" example:"epub"`
+	Source        string `json:"source,omitempty" example:"anna"` // "uploaded", "anna"
+	RequestedBy   *int64 `json:"requested_by,string,omitempty" example:"123456789"`
+	CreatedAfter  int64  `json:"created_after,omitempty" example:"1640995200"`
+	CreatedBefore int64  `json:"created_before,omitempty" example:"1672531200"`
+	Sort          string `json:"sort,omitempty" example:"relevance"` // "relevance", "recent", "popular", "title"
+	// next_cursor from the previous page; takes the place of offset
+	Cursor string `json:"cursor,omitempty"`
+	// Anna's Archive only: first result page, pages to search at once (1-5,
+	// 1 for anonymous users) and content type. Cursors carry on to the
+	// following pages.
+	AnnaPage    int    `json:"anna_page,omitempty" example:"1"`
+	AnnaPages   int    `json:"anna_pages,omitempty" example:"2"`
+	ContentType string `json:"content_type,omitempty" example:"book_fiction"`
 }
 
 // BookWithStatus extends anna.Book with availability status
@@ -24,7 +40,11 @@ type SearchResponse struct {
 	Total           int               `json:"total"`
 	Query           string            `json:"query"`
 	SearchType      string            `json:"search_type"`
+	Sort            string            `json:"sort"`
+	Facets          *model.BookFacets `json:"facets"`
 	Pagination      Pagination        `json:"pagination"`
+	// Pass as cursor to get the next page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type Pagination struct {
@@ -35,7 +55,7 @@ type Pagination struct {
 }
 
 type DownloadRequest struct {
-	Hash      string `json:"hash" binding:"required" example:"abc123def456"`
+	Hash      string `json:"hash" binding:"required" example:"d41d8cd98f00b204e9800998ecf8427e"`
 	Title     string `json:"title" binding:"required" example:"Programming in Go"`
 	Authors   string `json:"authors,omitempty" example:"John Doe"`
 	Publisher string `json:"publisher,omitempty" example:"O'Reilly"`
@@ -54,8 +74,10 @@ type DownloadResponse struct {
 }
 
 type BookListResponse struct {
-	Books      []BookWithStats `json:"books"`
-	Pagination Pagination      `json:"pagination"`
+	Books      []BookWithStats   `json:"books"`
+	Sort       string            `json:"sort"`
+	Facets     *model.BookFacets `json:"facets"`
+	Pagination Pagination        `json:"pagination"`
 }
 
 type BookWithStats struct {
@@ -75,17 +97,28 @@ type BookWithStats struct {
 	IsUploaded       bool   `json:"is_uploaded"`
 	UploadedBy       *int64 `json:"uploaded_by,string,omitempty"`
 	OriginalFilename string `json:"original_filename,omitempty"`
+	ISBN             string `json:"isbn,omitempty"`
+	Description      string `json:"description,omitempty"`
 	CreatedAt        int64  `json:"created_at,string"`
 }
 
 
 type JobStatusResponse struct {
-	JobID     int64  `json:"job_id,string"`
-	Status    string `json:"status"`
-	Progress  int    `json:"progress"`
-	ErrorMsg  string `json:"error_msg,omitempty"`
-	BookHash  string `json:"book_hash"`
-	Available bool   `json:"available"`
+	JobID           int64  `json:"job_id,string"`
+	Status          string `json:"status"`
+	Progress        int    `json:"progress"`
+	ErrorMsg        string `json:"error_msg,omitempty"`
+	BookHash        string `json:"book_hash"`
+	Available       bool   `json:"available"`
+	DownloadedBytes int64  `json:"downloaded_bytes"`
+	TotalBytes      int64  `json:"total_bytes"`
+	BytesPerSecond  int64  `json:"bytes_per_second"`
+	ETASeconds      *int64 `json:"eta_seconds,omitempty"`
+	// Retries
+	Attempts      int                        `json:"attempts"`
+	MaxAttempts   int                        `json:"max_attempts"`
+	NextAttemptAt *int64                     `json:"next_attempt_at,omitempty,string"`
+	History       []model.DownloadJobAttempt `json:"history"`
 }
 
 type ToggleFavoriteRequest struct {
@@ -127,3 +160,18 @@ type BookDetailResponse struct {
 	Book        BookWithStats `json:"book"`
 	RequestedBy *model.User   `json:"requested_by,omitempty"`
 }
+
+// InspectUploadResponse is what a book file's embedded metadata says, for
+// prefilling the upload form
+type InspectUploadResponse struct {
+	Hash        string   `json:"hash"`
+	Title       string   `json:"title"`
+	Authors     []string `json:"authors"`
+	Language    string   `json:"language"`
+	Publisher   string   `json:"publisher"`
+	ISBN        string   `json:"isbn"`
+	Description string   `json:"description"`
+	CoverData   string   `json:"cover_data,omitempty"`
+	// Set when the file is already in the library
+	ExistingBook *BookWithStats `json:"existing_book,omitempty"`
+}
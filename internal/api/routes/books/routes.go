@@ -4,8 +4,13 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/akramboussanni/marchive/config"
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/events"
 	"github.com/akramboussanni/marchive/internal/middleware"
 	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/akramboussanni/marchive/internal/services"
+	"github.com/akramboussanni/marchive/internal/storage"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -18,9 +23,15 @@ type BookRouter struct {
 	RequestCreditsRepo    *repo.RequestCreditsRepo
 	UserRepo              *repo.UserRepo
 	SettingsRepo          *repo.SettingsRepo
+	Source                anna.BookSource
+	Events                *events.Hub
+	Downloads             *services.DownloadService
+	SearchCache           *services.SearchCache
+	Storage               storage.Storage
+	PresignExpiry         time.Duration
 }
 
-func NewBookRouter(repos *repo.Repos) http.Handler {
+func NewBookRouter(repos *repo.Repos, source anna.BookSource, hub *events.Hub, downloads *services.DownloadService, searchCache *services.SearchCache, store storage.Storage) http.Handler {
 	br := &BookRouter{
 		BookRepo:              repos.Book,
 		DownloadJobRepo:       repos.DownloadJob,
@@ -30,6 +41,12 @@ func NewBookRouter(repos *repo.Repos) http.Handler {
 		RequestCreditsRepo:    repos.RequestCredits,
 		UserRepo:              repos.User,
 		SettingsRepo:          repos.Settings,
+		Source:                source,
+		Events:                hub,
+		Downloads:             downloads,
+		SearchCache:           searchCache,
+		Storage:               store,
+		PresignExpiry:         time.Duration(config.App.S3PresignExpiry) * time.Second,
 	}
 	r := chi.NewRouter()
 
@@ -39,9 +56,11 @@ func NewBookRouter(repos *repo.Repos) http.Handler {
 
 		r.Group(func(r chi.Router) {
 			middleware.AddRatelimit(r, 100, 1*time.Minute)
-			middleware.AddOptionalAuth(r, repos.User, repos.Token)
+			r.Use(middleware.ReadOnly)
+			middleware.AddOptionalAuth(r, repos.User, repos.Token, repos.PersonalToken)
 			r.Get("/explore", br.HandleExplore)
 			r.Get("/{hash}", br.HandleGetBookDetail)
+			r.Get("/{hash}/cover", br.HandleGetCover)
 			r.Post("/search", br.HandleSearch)
 		})
 
@@ -52,27 +71,37 @@ func NewBookRouter(repos *repo.Repos) http.Handler {
 
 		r.Group(func(r chi.Router) {
 			middleware.AddRatelimit(r, 30, 1*time.Minute)
+			r.Use(middleware.Downloads)
+			middleware.AddOptionalAuth(r, repos.User, repos.Token, repos.PersonalToken)
 			r.Get("/{hash}/download", br.HandleDownloadFile)
 		})
 
 		r.Group(func(r chi.Router) {
 			middleware.AddRatelimit(r, 30, 1*time.Minute)
-			middleware.AddAuth(r, repos.User, repos.Token)
+			middleware.AddAuth(r, repos.User, repos.Token, repos.PersonalToken)
 			r.Get("/downloads", br.HandleUserDownloads)
 			r.Get("/download-status", br.HandleDownloadStatus)
+			r.Post("/job/{jobID}/cancel", br.HandleCancelJob)
 			r.Get("/favorites", br.HandleGetFavorites)
 			r.Post("/favorite", br.HandleToggleFavorite)
 		})
 
+		r.Group(func(r chi.Router) {
+			middleware.AddRatelimit(r, 10, 1*time.Minute)
+			middleware.AddAuth(r, repos.User, repos.Token, repos.PersonalToken)
+			r.Get("/jobs/events", br.HandleJobEvents)
+		})
+
 		r.Group(func(r chi.Router) {
 			middleware.AddRatelimit(r, 15, 1*time.Minute)
-			middleware.AddOptionalAuth(r, repos.User, repos.Token)
+			r.Use(middleware.Downloads)
+			middleware.AddOptionalAuth(r, repos.User, repos.Token, repos.PersonalToken)
 			r.Post("/download", br.HandleRequestDownload)
 		})
 
 		r.Group(func(r chi.Router) {
 			middleware.AddRatelimit(r, 15, 1*time.Minute)
-			middleware.AddAuth(r, repos.User, repos.Token)
+			middleware.AddAuth(r, repos.User, repos.Token, repos.PersonalToken)
 			r.Post("/ghost-mode", br.HandleUpdateGhostMode)
 			r.Post("/delete", br.HandleDeleteBook)
 			r.Post("/metadata", br.HandleUpdateBookMetadata)
@@ -84,8 +113,9 @@ func NewBookRouter(repos *repo.Repos) http.Handler {
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.MaxBytesMiddleware(500 << 20)) // 500MB
 		middleware.AddRatelimit(r, 5, 1*time.Minute)
-		middleware.AddAuth(r, repos.User, repos.Token)
+		middleware.AddAuth(r, repos.User, repos.Token, repos.PersonalToken)
 		r.Post("/upload", br.HandleUploadBook)
+		r.Post("/upload/inspect", br.HandleInspectUpload)
 		r.Put("/{hash}/cover", br.HandleUpdateCover)
 	})
 
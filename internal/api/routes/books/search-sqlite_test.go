@@ -0,0 +1,217 @@
+//go:build debug
+// +build debug
+
+package books
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/db"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/akramboussanni/marchive/internal/services"
+	"github.com/akramboussanni/marchive/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// pagedSource serves fixed results for each page of any search
+type pagedSource struct {
+	pages map[int][]*anna.Book
+}
+
+func (s *pagedSource) Search(ctx context.Context, query anna.SearchQuery) ([]*anna.Book, error) {
+	first, count := query.PageRange()
+	var books []*anna.Book
+	for page := first; page < first+count; page++ {
+		books = append(books, s.pages[page]...)
+	}
+	return books, nil
+}
+
+func (s *pagedSource) Metadata(ctx context.Context, hash string) (*anna.Book, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *pagedSource) ResolveDownload(ctx context.Context, hash string) (*anna.DownloadLink, error) {
+	return nil, errors.New("not supported")
+}
+
+func testHash(kind string, n int) string {
+	return fmt.Sprintf("%s%030d", kind, n)
+}
+
+func newSearchTestRouter(t *testing.T, saved []model.SavedBook, source anna.BookSource) *BookRouter {
+	t.Helper()
+
+	if err := utils.InitSnowflake(1); err != nil {
+		t.Fatalf("init snowflake: %v", err)
+	}
+
+	conn, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	db.DB = conn
+	db.RunMigrations()
+	repos := repo.NewRepos(conn)
+
+	for i := range saved {
+		if err := repos.Book.CreateBook(context.Background(), &saved[i]); err != nil {
+			t.Fatalf("create book: %v", err)
+		}
+	}
+
+	return &BookRouter{
+		BookRepo:     repos.Book,
+		SettingsRepo: repos.Settings,
+		Source:       source,
+		SearchCache:  services.NewSearchCache(repos.SearchCache, source, 0),
+	}
+}
+
+// searchPage makes one search request as a signed in user
+func searchPage(t *testing.T, br *BookRouter, req SearchRequest) SearchResponse {
+	t.Helper()
+
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), utils.UserKey, &model.User{ID: 1, Role: "user"}))
+	w := httptest.NewRecorder()
+
+	br.HandleSearch(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search returned %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp
+}
+
+func TestSearchPagesMergedResults(t *testing.T) {
+	var saved []model.SavedBook
+	for i := 0; i < 5; i++ {
+		saved = append(saved, model.SavedBook{
+			Hash:   testHash("aa", i),
+			Title:  fmt.Sprintf("Dune Saved %d", i),
+			Status: model.BookStatusReady,
+		})
+	}
+
+	annaBook := func(hash string) *anna.Book {
+		return &anna.Book{Hash: hash, Title: "Dune " + hash[:4], Format: "epub", Language: "English [en]"}
+	}
+	source := &pagedSource{pages: map[int][]*anna.Book{
+		1: {
+			annaBook(testHash("bb", 0)),
+			// Saved already, so only listed once as a saved book
+			annaBook(testHash("aa", 1)),
+			annaBook(testHash("bb", 1)),
+			// Listed twice by Anna's Archive
+			annaBook(testHash("bb", 0)),
+			annaBook(testHash("aa", 3)),
+			annaBook(testHash("bb", 2)),
+		},
+		2: {
+			annaBook(testHash("cc", 0)),
+			annaBook(testHash("cc", 1)),
+			annaBook(testHash("aa", 4)),
+			annaBook(testHash("cc", 2)),
+		},
+	}}
+	br := newSearchTestRouter(t, saved, source)
+
+	want := map[string]bool{}
+	for _, book := range saved {
+		want[book.Hash] = true
+	}
+	for _, kind := range []string{"bb", "cc"} {
+		for i := 0; i < 3; i++ {
+			want[testHash(kind, i)] = true
+		}
+	}
+
+	for _, limit := range []int{1, 2, 3, 4, 5, 7, 50} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			seen := map[string]bool{}
+			var order []string
+			req := SearchRequest{Query: "dune", Limit: limit, AnnaPages: 1}
+
+			for page := 0; ; page++ {
+				if page > len(want)+2 {
+					t.Fatalf("still paging after %d pages", page)
+				}
+
+				resp := searchPage(t, br, req)
+				if resp.Pagination.Offset != len(order) {
+					t.Fatalf("page %d starts at offset %d, want %d", page, resp.Pagination.Offset, len(order))
+				}
+				results := append(resp.DownloadedBooks, resp.MissingBooks...)
+				if len(results) > limit {
+					t.Fatalf("page %d has %d results, limit %d", page, len(results), limit)
+				}
+				for _, book := range results {
+					if seen[book.Hash] {
+						t.Errorf("%s repeated on page %d", book.Hash, page)
+					}
+					seen[book.Hash] = true
+					order = append(order, book.Hash)
+				}
+
+				if resp.NextCursor == "" {
+					break
+				}
+				req.Cursor = resp.NextCursor
+			}
+
+			if len(seen) != len(want) {
+				t.Errorf("got %d books, want %d: %v", len(seen), len(want), order)
+			}
+			for hash := range want {
+				if !seen[hash] {
+					t.Errorf("%s never listed", hash)
+				}
+			}
+			// Saved books come before anything from Anna's Archive
+			for i, hash := range order {
+				if i < len(saved) && hash[:2] != "aa" {
+					t.Errorf("result %d is %s, want a saved book first", i, hash)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchCursorOtherSearch(t *testing.T) {
+	br := newSearchTestRouter(t, nil, &pagedSource{pages: map[int][]*anna.Book{
+		1: {{Hash: testHash("bb", 0), Title: "Dune"}, {Hash: testHash("bb", 1), Title: "Dune Messiah"}},
+	}})
+
+	resp := searchPage(t, br, SearchRequest{Query: "dune", Limit: 1})
+	if resp.NextCursor == "" {
+		t.Fatal("no cursor after the first page")
+	}
+
+	body, _ := json.Marshal(SearchRequest{Query: "dune", Limit: 1, Format: "pdf", Cursor: resp.NextCursor})
+	r := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), utils.UserKey, &model.User{ID: 1, Role: "user"}))
+	w := httptest.NewRecorder()
+	br.HandleSearch(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("cursor reused for another search returned %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -1,6 +1,7 @@
 package books
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/akramboussanni/marchive/internal/anna"
@@ -10,6 +11,10 @@ import (
 	"github.com/akramboussanni/marchive/internal/utils"
 )
 
+// anonymousSearchPages caps the Anna's Archive pages one anonymous search
+// fetches at once, since each is a scrape
+const anonymousSearchPages = 1
+
 func (br *BookRouter) HandleSearch(w http.ResponseWriter, r *http.Request) {
 	req, err := api.DecodeJSON[SearchRequest](w, r)
 	if err != nil {
@@ -33,6 +38,21 @@ func (br *BookRouter) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		req.SearchType = "all"
 	}
 
+	filter := model.BookFilter{
+		Query:         req.Query,
+		Language:      req.Language,
+		Format:        req.Format,
+		Source:        req.Source,
+		RequestedBy:   req.RequestedBy,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		Sort:          req.Sort,
+	}
+	if err := checkFilter(&filter); err != nil {
+		api.WriteMessage(w, http.StatusBadRequest, "error", err.Error())
+		return
+	}
+
 	// Get user context for filtering
 	user, hasUser := utils.UserFromContext(r.Context())
 	var userID int64
@@ -42,35 +62,82 @@ func (br *BookRouter) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		isAdmin = user.Role == "admin"
 	}
 
+	if !anna.ValidContentType(req.ContentType) {
+		api.WriteMessage(w, http.StatusBadRequest, "error", "invalid content_type")
+		return
+	}
+	if req.AnnaPage <= 0 {
+		req.AnnaPage = 1
+	}
+	maxPages := anna.MaxSearchPages
+	if !hasUser {
+		maxPages = anonymousSearchPages
+	}
+	req.AnnaPages = min(max(req.AnnaPages, 1), maxPages)
+
+	// Anna's Archive narrows results by the filters it understands too, so
+	// filtered searches don't run out after a page
+	annaQuery := anna.SearchQuery{
+		Query:       req.Query,
+		Page:        req.AnnaPage,
+		Pages:       req.AnnaPages,
+		Language:    filter.Language,
+		Extension:   filter.Format,
+		ContentType: req.ContentType,
+	}
+
+	fingerprint := searchFingerprint(req.SearchType, filter, annaQuery)
+	var cursor searchCursor
+	if req.Cursor != "" {
+		cursor, err = decodeCursor(req.Cursor, fingerprint)
+		if err != nil {
+			api.WriteMessage(w, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+		if cursor.AnnaPage > 0 {
+			annaQuery.Page = cursor.AnnaPage
+		}
+	}
+
 	downloadedBooks := []*BookWithStatus{}
 	missingBooks := []*BookWithStatus{}
+	facets := &model.BookFacets{
+		Languages: []model.FacetCount{},
+		Formats:   []model.FacetCount{},
+		Sources:   []model.FacetCount{},
+	}
 	var totalDownloaded, totalMissing int
+	// Whether later Anna pages may hold more results
+	var moreAnna bool
+
+	searchDownloaded := req.SearchType == "all" || req.SearchType == "downloaded"
+	if searchDownloaded {
+		totalDownloaded, err = br.BookRepo.CountFilteredBooks(r.Context(), filter, userID, isAdmin)
+		if err != nil {
+			applog.Error("Failed to count database books:", err)
+			api.WriteInternalError(w)
+			return
+		}
+		facets, err = br.BookRepo.GetBookFacets(r.Context(), filter, userID, isAdmin)
+		if err != nil {
+			applog.Error("Failed to count database book facets:", err)
+			api.WriteInternalError(w)
+			return
+		}
+	}
+
+	// Without a cursor, the offset counts into the merged results
+	if req.Cursor == "" {
+		cursor = cursorAt(req.Offset, totalDownloaded, fingerprint)
+	}
 
 	// Search downloaded books (from database)
-	if req.SearchType == "all" || req.SearchType == "downloaded" {
-		var dbBooks []model.SavedBook
-		var dbTotal int
-
-		if hasUser {
-			dbBooks, err = br.BookRepo.SearchBooksForUser(r.Context(), userID, isAdmin, req.Query, req.Limit, req.Offset)
-			if err != nil {
-				applog.Error("Failed to search database books:", err)
-			} else {
-				dbTotal, err = br.BookRepo.CountSearchBooks(r.Context(), req.Query)
-				if err != nil {
-					applog.Error("Failed to count database books:", err)
-				}
-			}
-		} else {
-			dbBooks, err = br.BookRepo.SearchBooks(r.Context(), req.Query, req.Limit, req.Offset)
-			if err != nil {
-				applog.Error("Failed to search database books:", err)
-			} else {
-				dbTotal, err = br.BookRepo.CountSearchBooks(r.Context(), req.Query)
-				if err != nil {
-					applog.Error("Failed to count database books:", err)
-				}
-			}
+	if searchDownloaded && cursor.Local < totalDownloaded {
+		dbBooks, err := br.BookRepo.FilterBooks(r.Context(), filter, userID, isAdmin, req.Limit, cursor.Local)
+		if err != nil {
+			applog.Error("Failed to search database books:", err)
+			api.WriteInternalError(w)
+			return
 		}
 
 		// Convert database books to BookWithStatus
@@ -95,7 +162,6 @@ func (br *BookRouter) HandleSearch(w http.ResponseWriter, r *http.Request) {
 				Status: status,
 			})
 		}
-		totalDownloaded = dbTotal
 	}
 
 	// Search missing books (from Anna) if needed
@@ -103,55 +169,37 @@ func (br *BookRouter) HandleSearch(w http.ResponseWriter, r *http.Request) {
 	anonymousAccessEnabled := br.SettingsRepo.IsAnonymousAccessEnabled(r.Context())
 	canSearchAnna := hasUser || anonymousAccessEnabled
 	if canSearchAnna && (req.SearchType == "all" || req.SearchType == "missing") {
-		annaBooks, err := anna.FindBook(req.Query)
-		if err != nil {
-			applog.Error("Failed to search Anna books:", err)
-		} else {
-			// Get all hashes from Anna results
-			hashes := make([]string, len(annaBooks))
-			for i, book := range annaBooks {
-				hashes[i] = book.Hash
-			}
-
-			// Check which books are already in database
-			existingBooks := make(map[string]bool)
-			if len(hashes) > 0 {
-				availableStatuses, err := br.BookRepo.GetBooksAvailabilityByHashes(r.Context(), hashes)
-				if err != nil {
-					applog.Error("Failed to check books availability:", err)
-				} else {
-					for _, status := range availableStatuses {
-						existingBooks[status.Hash] = true
-					}
-				}
-			}
+		missing, found := br.searchMissing(r.Context(), annaQuery, filter, facets)
+		totalMissing = len(missing)
+		moreAnna = found > 0
 
-			// Filter out books that are already in database
-			for _, book := range annaBooks {
-				if !existingBooks[book.Hash] {
-					missingBooks = append(missingBooks, &BookWithStatus{
-						Book:   book,
-						Status: "not_available",
-					})
-				}
-			}
-			totalMissing = len(missingBooks)
-
-			// Apply pagination to missing books
-			start := req.Offset
-			end := start + req.Limit
-			if start >= len(missingBooks) {
-				missingBooks = []*BookWithStatus{}
-			} else {
-				if end > len(missingBooks) {
-					end = len(missingBooks)
-				}
-				missingBooks = missingBooks[start:end]
-			}
+		// Results from Anna's Archive fill whatever the saved books left
+		// of the page
+		room := req.Limit - len(downloadedBooks)
+		if room > 0 && cursor.Anna < len(missing) {
+			end := min(cursor.Anna+room, len(missing))
+			missingBooks = missing[cursor.Anna:end]
 		}
 	}
 
-	total := totalDownloaded + totalMissing
+	total := totalDownloaded + cursor.AnnaBefore + totalMissing
+	next := searchCursor{
+		Local:      cursor.Local + len(downloadedBooks),
+		Anna:       cursor.Anna + len(missingBooks),
+		AnnaPage:   cursor.AnnaPage,
+		AnnaBefore: cursor.AnnaBefore,
+		Search:     fingerprint,
+	}
+	hasNext := next.Local < totalDownloaded || next.Anna < totalMissing
+	if !hasNext && moreAnna {
+		// These Anna pages are used up; the next page of results searches
+		// the ones after them
+		first, count := annaQuery.PageRange()
+		next.AnnaPage = first + count
+		next.AnnaBefore += totalMissing
+		next.Anna = 0
+		hasNext = true
+	}
 
 	response := SearchResponse{
 		DownloadedBooks: downloadedBooks,
@@ -159,13 +207,78 @@ func (br *BookRouter) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		Total:           total,
 		Query:           req.Query,
 		SearchType:      req.SearchType,
+		Sort:            filter.Sort,
+		Facets:          facets,
 		Pagination: Pagination{
 			Limit:   req.Limit,
-			Offset:  req.Offset,
+			Offset:  cursor.offset(),
 			Total:   total,
-			HasNext: req.Offset+req.Limit < total,
+			HasNext: hasNext,
 		},
 	}
+	if hasNext {
+		response.NextCursor = next.encode()
+	}
 
 	api.WriteJSON(w, http.StatusOK, response)
 }
+
+// searchMissing searches Anna's Archive for books that aren't saved yet and
+// pass the filter, counting them into facets. Each book appears once, in
+// the filter's sort order. found is how many results the pages held before
+// any were left out.
+func (br *BookRouter) searchMissing(ctx context.Context, query anna.SearchQuery, filter model.BookFilter, facets *model.BookFacets) (missing []*BookWithStatus, found int) {
+	// Results can't pass a filter on requester or date, but uploaded-only
+	// searches still look to count Anna's Archive in the source facet
+	anySource := filter
+	anySource.Source = ""
+	if anySource.LocalOnly() {
+		return nil, 0
+	}
+
+	annaBooks, err := br.SearchCache.Search(ctx, query)
+	if err != nil {
+		applog.Error("Failed to search Anna books:", err)
+		return nil, 0
+	}
+
+	// Get all hashes from Anna results
+	hashes := make([]string, len(annaBooks))
+	for i, book := range annaBooks {
+		hashes[i] = book.Hash
+	}
+
+	// Check which books are already in database
+	existingBooks := make(map[string]bool)
+	if len(hashes) > 0 {
+		availableStatuses, err := br.BookRepo.GetBooksAvailabilityByHashes(ctx, hashes)
+		if err != nil {
+			applog.Error("Failed to check books availability:", err)
+		} else {
+			for _, status := range availableStatuses {
+				existingBooks[status.Hash] = true
+			}
+		}
+	}
+
+	// Filter out books that are already in database, and repeats
+	var notSaved []*BookWithStatus
+	for _, book := range annaBooks {
+		if !existingBooks[book.Hash] {
+			existingBooks[book.Hash] = true
+			notSaved = append(notSaved, &BookWithStatus{
+				Book:   book,
+				Status: "not_available",
+			})
+		}
+	}
+	addAnnaFacets(facets, notSaved, filter)
+
+	for _, book := range notSaved {
+		if filter.MatchesAnna(book.Language, book.Format) {
+			missing = append(missing, book)
+		}
+	}
+	sortAnnaBooks(missing, filter)
+	return missing, len(annaBooks)
+}
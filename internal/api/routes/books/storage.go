@@ -0,0 +1,213 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/api"
+	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/bookmeta"
+	"github.com/akramboussanni/marchive/internal/storage"
+	"github.com/akramboussanni/marchive/internal/utils"
+)
+
+// hashUpload returns the hex MD5 of an uploaded file and rewinds it
+func hashUpload(file multipart.File) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// storeContent stores a book file under its content hash. An object already
+// at that key holds the same bytes and is reused; written reports whether
+// this call stored it.
+func (br *BookRouter) storeContent(ctx context.Context, file multipart.File, size int64, hash, format string) (key string, written bool, err error) {
+	key, err = anna.StoredFilename(hash, format)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := br.Storage.Stat(ctx, key); err == nil {
+		return key, false, nil
+	}
+	if err := br.Storage.Put(ctx, key, file, size); err != nil {
+		return "", false, err
+	}
+	return key, true, nil
+}
+
+// saveUpload stores an uploaded file under prefix with a unique name and
+// returns its storage key
+func (br *BookRouter) saveUpload(ctx context.Context, file multipart.File, header *multipart.FileHeader, prefix string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	key := path.Join(prefix, utils.GenerateUniqueFilename(ext))
+	if err := br.Storage.Put(ctx, key, file, header.Size); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// deleteStored removes key from storage. Failures are logged and otherwise
+// ignored; a stray file is better than a request failing halfway.
+func (br *BookRouter) deleteStored(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := br.Storage.Delete(ctx, key); err != nil {
+		applog.Error("Failed to delete stored file:", key, err)
+	}
+}
+
+// serveStored sends the object at key to the client. Backends that can hand
+// out direct links get a redirect so the file doesn't pass through this
+// server; otherwise it is streamed, with range support when possible.
+func (br *BookRouter) serveStored(w http.ResponseWriter, r *http.Request, key, filename string) {
+	if filename != "" {
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+		w.Header().Set("Content-Disposition", disposition)
+	}
+
+	url, err := br.Storage.PresignedURL(r.Context(), key, br.PresignExpiry, filename)
+	if err == nil {
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+	if !errors.Is(err, storage.ErrPresignNotSupported) {
+		applog.Warn("Failed to presign stored file, streaming instead:", key, err)
+	}
+
+	info, err := br.Storage.Stat(r.Context(), key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotExist) {
+			applog.Error("Failed to stat stored file:", key, err)
+		}
+		api.WriteMessage(w, http.StatusNotFound, "error", "file not available")
+		return
+	}
+
+	obj, err := br.Storage.Open(r.Context(), key)
+	if err != nil {
+		applog.Error("Failed to open stored file:", key, err)
+		api.WriteMessage(w, http.StatusNotFound, "error", "file not available")
+		return
+	}
+	defer obj.Close()
+
+	if seeker, ok := obj.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, seeker)
+		return
+	}
+
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, obj)
+	}
+}
+
+// storedBookExists reports whether a book already points at key. With local
+// storage, books saved before storage keys may record the same file by path.
+func (br *BookRouter) storedBookExists(ctx context.Context, key string) (bool, error) {
+	candidates := []string{key}
+	if local, ok := br.Storage.(*storage.LocalStorage); ok {
+		if legacy, err := local.Path(key); err == nil {
+			candidates = append(candidates, legacy)
+			if abs, err := filepath.Abs(legacy); err == nil {
+				candidates = append(candidates, abs)
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		exists, err := br.BookRepo.BookExistsByFilePath(ctx, candidate)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// inspectStored hashes the object at key and reads its embedded metadata.
+// Objects that can't be read at offsets are spooled to a temporary file.
+func (br *BookRouter) inspectStored(ctx context.Context, key string, size int64, format string) (string, *bookmeta.Metadata, error) {
+	obj, err := br.Storage.Open(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer obj.Close()
+
+	h := md5.New()
+	readerAt, ok := obj.(io.ReaderAt)
+	if ok {
+		if _, err := io.Copy(h, obj); err != nil {
+			return "", nil, err
+		}
+	} else {
+		tmp, err := os.CreateTemp("", "marchive-inspect-*")
+		if err != nil {
+			return "", nil, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(io.MultiWriter(tmp, h), obj); err != nil {
+			return "", nil, err
+		}
+		readerAt = tmp
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), br.extractMetadata(readerAt, size, format), nil
+}
+
+// extractMetadata reads a book's embedded metadata. Books without any, or
+// that can't be parsed, get empty metadata.
+func (br *BookRouter) extractMetadata(r io.ReaderAt, size int64, format string) *bookmeta.Metadata {
+	meta, err := bookmeta.Extract(r, size, format)
+	if err != nil {
+		if !errors.Is(err, bookmeta.ErrUnsupportedFormat) {
+			applog.Warn("Failed to read book metadata:", err)
+		}
+		return &bookmeta.Metadata{}
+	}
+	return meta
+}
+
+// saveCover stores a cover image embedded in a book and returns its key
+func (br *BookRouter) saveCover(ctx context.Context, cover *bookmeta.Cover) (string, error) {
+	key := path.Join(storage.CoversPrefix, utils.GenerateUniqueFilename(cover.Extension()))
+	if err := br.Storage.Put(ctx, key, bytes.NewReader(cover.Data), int64(len(cover.Data))); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+//go:build debug
+// +build debug
+
+package books
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/db"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/akramboussanni/marchive/internal/storage"
+	"github.com/akramboussanni/marchive/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+func newUploadTestRouter(t *testing.T) (*BookRouter, *repo.Repos) {
+	t.Helper()
+
+	if err := utils.InitSnowflake(1); err != nil {
+		t.Fatalf("init snowflake: %v", err)
+	}
+
+	dir := t.TempDir()
+	conn, err := sqlx.Open("sqlite", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	db.DB = conn
+	db.RunMigrations()
+	repos := repo.NewRepos(conn)
+
+	store, err := storage.NewLocalStorage(filepath.Join(dir, "books"))
+	if err != nil {
+		t.Fatalf("create storage: %v", err)
+	}
+
+	return &BookRouter{
+		BookRepo:        repos.Book,
+		DownloadJobRepo: repos.DownloadJob,
+		Storage:         store,
+	}, repos
+}
+
+func uploadRequest(t *testing.T, filename string, content []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("book", filename)
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	user := &model.User{ID: 1, Role: "admin"}
+	return req.WithContext(context.WithValue(req.Context(), utils.UserKey, user))
+}
+
+func TestUploadToBookBeingFetched(t *testing.T) {
+	content := []byte("the spice must flow")
+	sum := md5.Sum(content)
+	hash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name       string
+		status     string
+		queueJob   bool
+		wantStatus int
+		wantBook   string
+	}{
+		{"processing", model.BookStatusProcessing, false, http.StatusConflict, model.BookStatusProcessing},
+		{"job queued", model.BookStatusEvicted, true, http.StatusConflict, model.BookStatusEvicted},
+		{"idle", model.BookStatusEvicted, false, http.StatusOK, model.BookStatusReady},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br, repos := newUploadTestRouter(t)
+			ctx := context.Background()
+
+			book := &model.SavedBook{Hash: hash, Title: "Dune", Format: "txt", Status: tt.status}
+			if err := repos.Book.CreateBook(ctx, book); err != nil {
+				t.Fatalf("create book: %v", err)
+			}
+			if tt.queueJob {
+				if _, err := repos.DownloadJob.CreateJob(ctx, 1, hash); err != nil {
+					t.Fatalf("create job: %v", err)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			br.HandleUploadBook(rec, uploadRequest(t, "dune.txt", content))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("upload returned %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			got, err := repos.Book.GetBookByHash(ctx, hash)
+			if err != nil {
+				t.Fatalf("get book: %v", err)
+			}
+			if got.Status != tt.wantBook {
+				t.Errorf("book is %s, want %s", got.Status, tt.wantBook)
+			}
+
+			key, err := anna.StoredFilename(hash, "txt")
+			if err != nil {
+				t.Fatalf("stored key: %v", err)
+			}
+			_, statErr := br.Storage.Stat(ctx, key)
+			if stored := statErr == nil; stored != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("file stored = %v after a %d response", stored, rec.Code)
+			}
+		})
+	}
+}
@@ -14,7 +14,7 @@ type InviteRouter struct {
 	UserRepo   *repo.UserRepo
 }
 
-func NewInviteRouter(inviteRepo *repo.InviteRepo, userRepo *repo.UserRepo, tokenRepo *repo.TokenRepo) http.Handler {
+func NewInviteRouter(inviteRepo *repo.InviteRepo, userRepo *repo.UserRepo, tokenRepo *repo.TokenRepo, personalTokenRepo *repo.PersonalTokenRepo) http.Handler {
 	ir := &InviteRouter{
 		InviteRepo: inviteRepo,
 		UserRepo:   userRepo,
@@ -26,7 +26,7 @@ func NewInviteRouter(inviteRepo *repo.InviteRepo, userRepo *repo.UserRepo, token
 	// Admin-only invite management
 	r.Group(func(r chi.Router) {
 		middleware.AddRatelimit(r, 15, 1*time.Minute)
-		middleware.AddAuth(r, userRepo, tokenRepo)
+		middleware.AddAuth(r, userRepo, tokenRepo, personalTokenRepo)
 		r.Use(middleware.AdminOnly)
 		r.Post("/", ir.HandleCreateInvite)
 		r.Get("/", ir.HandleListInvites)
@@ -0,0 +1,156 @@
+package opds
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/akramboussanni/marchive/config"
+	"github.com/akramboussanni/marchive/internal/api"
+	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/middleware"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type contextKey string
+
+// baseKey holds the path catalog links are built under, which carries the
+// feed token when the reader used one
+const baseKey contextKey = "opds-base"
+
+func basePath(ctx context.Context) string {
+	if base, ok := ctx.Value(baseKey).(string); ok {
+		return base
+	}
+	return "/opds"
+}
+
+// basicAuth lets through requests that already carry a session or personal
+// token, and checks HTTP Basic credentials for the rest. Failures count towards the same
+// lockout as the login form.
+func (or *OPDSRouter) basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := utils.UserFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			challenge(w)
+			return
+		}
+
+		// Readers that only do Basic can send a personal token as the password
+		if strings.HasPrefix(password, model.PersonalTokenPrefix) {
+			user, _, err := middleware.AuthenticatePersonalToken(r.Context(), password, or.UserRepo, or.PersonalTokenRepo)
+			if err != nil || !strings.EqualFold(user.Username, username) {
+				challenge(w)
+				return
+			}
+			ctx := context.WithValue(r.Context(), utils.UserKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		user, err := or.UserRepo.GetUserByUsername(r.Context(), username)
+		if err != nil || user == nil {
+			challenge(w)
+			return
+		}
+
+		ip := utils.GetClientIP(r)
+		lockedOut, err := or.LockoutRepo.IsLockedOut(r.Context(), user.ID, ip)
+		if err != nil {
+			applog.Error("Error checking lockout:", err)
+			api.WriteInternalError(w)
+			return
+		}
+		if lockedOut {
+			api.WriteMessage(w, http.StatusLocked, "error", "account locked")
+			return
+		}
+
+		if !utils.ComparePassword(user.PasswordHash, password) {
+			or.recordFailedLogin(r.Context(), user.ID, ip)
+			challenge(w)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), utils.UserKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// feedTokenAuth authenticates with the token in the URL path
+func (or *OPDSRouter) feedTokenAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := chi.URLParam(r, "token")
+		hash, err := utils.HashRandomToken(token)
+		if err != nil {
+			api.WriteInvalidCredentials(w)
+			return
+		}
+
+		userID, ok, err := or.FeedTokenRepo.UseFeedToken(r.Context(), hash)
+		if err != nil {
+			applog.Error("Failed to look up feed token:", err)
+			api.WriteInternalError(w)
+			return
+		}
+		if !ok {
+			api.WriteInvalidCredentials(w)
+			return
+		}
+
+		user, err := or.UserRepo.GetUserByID(r.Context(), userID)
+		if err != nil {
+			api.WriteInvalidCredentials(w)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), utils.UserKey, user)
+		ctx = context.WithValue(ctx, baseKey, "/opds/token/"+token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (or *OPDSRouter) recordFailedLogin(ctx context.Context, userID int64, ip string) {
+	now := time.Now().UTC().Unix()
+	nowMicro := time.Now().UTC().UnixMicro()
+	err := or.LockoutRepo.AddFailedLogin(ctx, model.FailedLogin{ID: nowMicro, UserID: userID, IPAddress: ip, AttemptedAt: now, Active: true})
+	if err != nil {
+		applog.Error("Failed to add failed login:", err)
+		return
+	}
+
+	count, err := or.LockoutRepo.CountRecentFailures(ctx, userID, ip)
+	if err != nil {
+		applog.Error("Failed to count recent failures:", err)
+		return
+	}
+
+	if count > config.App.LockoutCount {
+		err := or.LockoutRepo.AddLockout(ctx, model.Lockout{
+			ID:          nowMicro,
+			UserID:      userID,
+			IPAddress:   ip,
+			LockedUntil: now + config.App.LockoutDuration,
+			Reason:      "failed logins",
+			Active:      true,
+		})
+		if err != nil {
+			applog.Error("Failed to add lockout:", err)
+			return
+		}
+		applog.Warn("User locked out due to failed OPDS logins", "userID:", userID, "ip:", ip)
+	}
+}
+
+func challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="marchive", charset="UTF-8"`)
+	api.WriteInvalidCredentials(w)
+}
@@ -0,0 +1,219 @@
+package opds
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/convert"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/storage"
+)
+
+// Media types from the OPDS 1.2 spec
+const (
+	navigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	acquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	openSearchType  = "application/opensearchdescription+xml"
+
+	relAcquisition = "http://opds-spec.org/acquisition"
+	relImage       = "http://opds-spec.org/image"
+	relThumbnail   = "http://opds-spec.org/image/thumbnail"
+	relSortNew     = "http://opds-spec.org/sort/new"
+	relSortPopular = "http://opds-spec.org/sort/popular"
+)
+
+type feed struct {
+	XMLName         xml.Name `xml:"feed"`
+	Xmlns           string   `xml:"xmlns,attr"`
+	XmlnsDC         string   `xml:"xmlns:dc,attr"`
+	XmlnsOpenSearch string   `xml:"xmlns:opensearch,attr"`
+	XmlnsOPDS       string   `xml:"xmlns:opds,attr"`
+	ID              string   `xml:"id"`
+	Title           string   `xml:"title"`
+	Updated         string   `xml:"updated"`
+	Author          *author  `xml:"author,omitempty"`
+	Links           []link   `xml:"link"`
+	TotalResults    int      `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage    int      `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex      int      `xml:"opensearch:startIndex,omitempty"`
+	Entries         []entry  `xml:"entry"`
+}
+
+type author struct {
+	Name string `xml:"name"`
+}
+
+type link struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type text struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type entry struct {
+	Title      string   `xml:"title"`
+	ID         string   `xml:"id"`
+	Updated    string   `xml:"updated"`
+	Authors    []author `xml:"author,omitempty"`
+	Language   string   `xml:"dc:language,omitempty"`
+	Publisher  string   `xml:"dc:publisher,omitempty"`
+	Identifier string   `xml:"dc:identifier,omitempty"`
+	Issued     string   `xml:"dc:issued,omitempty"`
+	Summary    *text    `xml:"summary,omitempty"`
+	Content    *text    `xml:"content,omitempty"`
+	Links      []link   `xml:"link"`
+}
+
+func newFeed(r *http.Request, id, title, kind string) *feed {
+	base := basePath(r.Context())
+	return &feed{
+		Xmlns:           "http://www.w3.org/2005/Atom",
+		XmlnsDC:         "http://purl.org/dc/terms/",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		XmlnsOPDS:       "http://opds-spec.org/2010/catalog",
+		ID:              "urn:marchive:" + id,
+		Title:           title,
+		Updated:         time.Now().UTC().Format(time.RFC3339),
+		Author:          &author{Name: "marchive"},
+		Links: []link{
+			{Rel: "self", Href: r.URL.RequestURI(), Type: kind},
+			{Rel: "start", Href: base + "/", Type: navigationType},
+			{Rel: "search", Href: base + "/opensearch.xml", Type: openSearchType},
+			{Rel: "search", Href: base + "/search?q={searchTerms}", Type: acquisitionType},
+		},
+	}
+}
+
+// navigationEntry links to another feed of the catalog
+func navigationEntry(id, title, summary, href, rel string) entry {
+	return entry{
+		Title:   title,
+		ID:      "urn:marchive:" + id,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Content: &text{Type: "text", Value: summary},
+		Links:   []link{{Rel: rel, Href: href, Type: acquisitionType}},
+	}
+}
+
+// bookEntry describes a book with links to download it in its own format
+// and in every format it can be converted to
+func bookEntry(book *model.SavedBook) entry {
+	updated := book.UpdatedAt
+	if updated == 0 {
+		updated = book.CreatedAt
+	}
+
+	e := entry{
+		Title:     book.Title,
+		ID:        "urn:marchive:book:" + book.Hash,
+		Updated:   time.Unix(updated, 0).UTC().Format(time.RFC3339),
+		Language:  book.Language,
+		Publisher: book.Publisher,
+	}
+	if book.Authors != "" {
+		e.Authors = []author{{Name: book.Authors}}
+	}
+	if book.ISBN != "" {
+		e.Identifier = "urn:isbn:" + book.ISBN
+	}
+	if book.Description != "" {
+		e.Summary = &text{Type: "text", Value: book.Description}
+	}
+
+	download := "/api/books/" + url.PathEscape(book.Hash) + "/download"
+	e.Links = append(e.Links, link{Rel: relAcquisition, Href: download, Type: mediaType(book.Format)})
+	for _, format := range convert.Targets(book.Format) {
+		e.Links = append(e.Links, link{
+			Rel:   relAcquisition,
+			Href:  download + "?format=" + url.QueryEscape(format),
+			Type:  mediaType(format),
+			Title: strings.ToUpper(format) + " (converted)",
+		})
+	}
+
+	if cover := coverHref(book); cover != "" {
+		e.Links = append(e.Links,
+			link{Rel: relImage, Href: cover},
+			link{Rel: relThumbnail, Href: cover},
+		)
+	}
+	return e
+}
+
+func coverHref(book *model.SavedBook) string {
+	if storage.IsStoredCover(book.CoverData) {
+		return "/api/books/" + url.PathEscape(book.Hash) + "/cover"
+	}
+	return book.CoverURL
+}
+
+// paginate adds next and previous links to an acquisition feed, keeping the
+// request's other query parameters
+func paginate(f *feed, r *http.Request, page int, hasNext bool) {
+	pageHref := func(page int) string {
+		q := r.URL.Query()
+		q.Set("page", strconv.Itoa(page))
+		return r.URL.Path + "?" + q.Encode()
+	}
+
+	if page > 1 {
+		f.Links = append(f.Links,
+			link{Rel: "first", Href: pageHref(1), Type: acquisitionType},
+			link{Rel: "previous", Href: pageHref(page - 1), Type: acquisitionType},
+		)
+	}
+	if hasNext {
+		f.Links = append(f.Links, link{Rel: "next", Href: pageHref(page + 1), Type: acquisitionType})
+	}
+	f.ItemsPerPage = pageSize
+	f.StartIndex = (page-1)*pageSize + 1
+}
+
+func pageParam(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+func writeXML(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType+";charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(v)
+}
+
+func mediaType(format string) string {
+	switch strings.ToLower(format) {
+	case "epub":
+		return "application/epub+zip"
+	case "pdf":
+		return "application/pdf"
+	case "mobi":
+		return "application/x-mobipocket-ebook"
+	case "azw3", "azw":
+		return "application/vnd.amazon.ebook"
+	case "fb2":
+		return "application/x-fictionbook+xml"
+	case "txt":
+		return "text/plain"
+	case "djvu":
+		return "image/vnd.djvu"
+	case "cbz":
+		return "application/vnd.comicbook+zip"
+	case "cbr":
+		return "application/vnd.comicbook-rar"
+	default:
+		return "application/octet-stream"
+	}
+}
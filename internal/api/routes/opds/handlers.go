@@ -0,0 +1,163 @@
+package opds
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/akramboussanni/marchive/internal/api"
+	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/utils"
+)
+
+// HandleRoot serves the navigation feed readers start from
+func (or *OPDSRouter) HandleRoot(w http.ResponseWriter, r *http.Request) {
+	base := basePath(r.Context())
+	f := newFeed(r, "root", "marchive", navigationType)
+	f.Entries = []entry{
+		navigationEntry("recent", "Recently added", "The newest books in the library", base+"/recent", relSortNew),
+		navigationEntry("popular", "Popular", "The most downloaded books", base+"/popular", relSortPopular),
+		navigationEntry("favorites", "Favorites", "Books you marked as favorite", base+"/favorites", "subsection"),
+	}
+	writeXML(w, navigationType, f)
+}
+
+func (or *OPDSRouter) HandleRecent(w http.ResponseWriter, r *http.Request) {
+	or.writeBookList(w, r, "recent", "Recently added", false)
+}
+
+func (or *OPDSRouter) HandlePopular(w http.ResponseWriter, r *http.Request) {
+	or.writeBookList(w, r, "popular", "Popular", true)
+}
+
+func (or *OPDSRouter) writeBookList(w http.ResponseWriter, r *http.Request, id, title string, popular bool) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	page := pageParam(r)
+	isAdmin := user.Role == "admin"
+	books, err := or.BookRepo.GetReadyBooksForUser(r.Context(), user.ID, isAdmin, popular, pageSize, (page-1)*pageSize)
+	if err != nil {
+		applog.Error("Failed to get books for OPDS feed:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	total, err := or.BookRepo.CountReadyBooksForUser(r.Context(), user.ID, isAdmin)
+	if err != nil {
+		applog.Error("Failed to count books for OPDS feed:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	f := newFeed(r, id, title, acquisitionType)
+	for i := range books {
+		f.Entries = append(f.Entries, bookEntry(&books[i]))
+	}
+	paginate(f, r, page, page*pageSize < total)
+	f.TotalResults = total
+	writeXML(w, acquisitionType, f)
+}
+
+func (or *OPDSRouter) HandleFavorites(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	page := pageParam(r)
+	favorites, err := or.FavoriteRepo.GetUserFavorites(r.Context(), user.ID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		applog.Error("Failed to get user favorites:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	total, err := or.FavoriteRepo.CountUserFavorites(r.Context(), user.ID)
+	if err != nil {
+		applog.Error("Failed to count user favorites:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	f := newFeed(r, "favorites", "Favorites", acquisitionType)
+	for _, fav := range favorites {
+		book, err := or.BookRepo.GetBookByHash(r.Context(), fav.BookHash)
+		if err != nil || !downloadable(book) {
+			continue
+		}
+		f.Entries = append(f.Entries, bookEntry(book))
+	}
+	paginate(f, r, page, page*pageSize < total)
+	f.TotalResults = total
+	writeXML(w, acquisitionType, f)
+}
+
+// HandleSearch searches the local library. Books still being fetched have
+// nothing to download and are left out.
+func (or *OPDSRouter) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	f := newFeed(r, "search", "Search results for "+query, acquisitionType)
+	if query == "" {
+		writeXML(w, acquisitionType, f)
+		return
+	}
+
+	page := pageParam(r)
+	books, err := or.BookRepo.SearchBooksForUser(r.Context(), user.ID, user.Role == "admin", query, pageSize, (page-1)*pageSize)
+	if err != nil {
+		applog.Error("Failed to search books for OPDS feed:", err)
+		api.WriteInternalError(w)
+		return
+	}
+
+	for i := range books {
+		if downloadable(&books[i]) {
+			f.Entries = append(f.Entries, bookEntry(&books[i]))
+		}
+	}
+	paginate(f, r, page, len(books) == pageSize)
+	writeXML(w, acquisitionType, f)
+}
+
+type openSearchDescription struct {
+	XMLName        xml.Name `xml:"OpenSearchDescription"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	ShortName      string   `xml:"ShortName"`
+	Description    string   `xml:"Description"`
+	InputEncoding  string   `xml:"InputEncoding"`
+	OutputEncoding string   `xml:"OutputEncoding"`
+	URL            struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Url"`
+}
+
+// HandleOpenSearch describes how readers build search URLs
+func (or *OPDSRouter) HandleOpenSearch(w http.ResponseWriter, r *http.Request) {
+	desc := openSearchDescription{
+		Xmlns:          "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:      "marchive",
+		Description:    "Search the marchive library",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+	}
+	desc.URL.Type = acquisitionType
+	desc.URL.Template = basePath(r.Context()) + "/search?q={searchTerms}&page={startPage?}"
+	writeXML(w, openSearchType, desc)
+}
+
+func downloadable(book *model.SavedBook) bool {
+	return book.Status == model.BookStatusReady && book.FilePath != ""
+}
@@ -0,0 +1,62 @@
+// Package opds serves the library as an OPDS 1.2 catalog for e-reader apps.
+// Readers authenticate with HTTP Basic or a per-user feed token in the URL,
+// since they can't hold the session cookie.
+package opds
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/middleware"
+	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/go-chi/chi/v5"
+)
+
+// pageSize is how many entries an acquisition feed holds per page
+const pageSize = 30
+
+type OPDSRouter struct {
+	BookRepo          *repo.BookRepo
+	FavoriteRepo      *repo.FavoriteRepo
+	UserRepo          *repo.UserRepo
+	LockoutRepo       *repo.LockoutRepo
+	FeedTokenRepo     *repo.FeedTokenRepo
+	PersonalTokenRepo *repo.PersonalTokenRepo
+}
+
+func NewOPDSRouter(repos *repo.Repos) http.Handler {
+	or := &OPDSRouter{
+		BookRepo:          repos.Book,
+		FavoriteRepo:      repos.Favorite,
+		UserRepo:          repos.User,
+		LockoutRepo:       repos.Lockout,
+		FeedTokenRepo:     repos.FeedToken,
+		PersonalTokenRepo: repos.PersonalToken,
+	}
+	r := chi.NewRouter()
+
+	r.Use(middleware.MaxBytesMiddleware(1 << 20))
+	middleware.AddRatelimit(r, 60, 1*time.Minute)
+
+	r.Group(func(r chi.Router) {
+		middleware.AddOptionalAuth(r, repos.User, repos.Token, repos.PersonalToken)
+		r.Use(or.basicAuth)
+		or.catalogRoutes(r)
+	})
+
+	r.Route("/token/{token}", func(r chi.Router) {
+		r.Use(or.feedTokenAuth)
+		or.catalogRoutes(r)
+	})
+
+	return r
+}
+
+func (or *OPDSRouter) catalogRoutes(r chi.Router) {
+	r.Get("/", or.HandleRoot)
+	r.Get("/recent", or.HandleRecent)
+	r.Get("/popular", or.HandlePopular)
+	r.Get("/favorites", or.HandleFavorites)
+	r.Get("/search", or.HandleSearch)
+	r.Get("/opensearch.xml", or.HandleOpenSearch)
+}
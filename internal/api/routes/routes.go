@@ -4,21 +4,25 @@ import (
 	"net/http"
 
 	"github.com/akramboussanni/marchive/config"
+	"github.com/akramboussanni/marchive/internal/anna"
 	"github.com/akramboussanni/marchive/internal/api"
 	"github.com/akramboussanni/marchive/internal/api/routes/admin"
 	"github.com/akramboussanni/marchive/internal/api/routes/auth"
 	"github.com/akramboussanni/marchive/internal/api/routes/books"
 	"github.com/akramboussanni/marchive/internal/api/routes/invites"
+	"github.com/akramboussanni/marchive/internal/api/routes/opds"
+	"github.com/akramboussanni/marchive/internal/events"
 	"github.com/akramboussanni/marchive/internal/middleware"
 	"github.com/akramboussanni/marchive/internal/model"
 	"github.com/akramboussanni/marchive/internal/services"
+	"github.com/akramboussanni/marchive/internal/storage"
 
 	"github.com/akramboussanni/marchive/internal/repo"
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
-func SetupRouter(repos *repo.Repos) http.Handler {
+func SetupRouter(repos *repo.Repos, source anna.BookSource, hub *events.Hub, downloadService *services.DownloadService, searchCache *services.SearchCache, store storage.Storage) http.Handler {
 	r := chi.NewRouter()
 
 	if config.App.TrustIpHeaders {
@@ -34,10 +38,11 @@ func SetupRouter(repos *repo.Repos) http.Handler {
 	userService := services.NewUserService(repos.User)
 
 	api.AddSwaggerRoutes(r)
-	r.Mount("/api/auth", auth.NewAuthRouter(repos.User, repos.Token, repos.Lockout, repos.RequestCredits))
-	r.Mount("/api/books", books.NewBookRouter(repos))
-	r.Mount("/api/admin", admin.NewAdminRouter(repos, userService))
-	r.Mount("/api/invites", invites.NewInviteRouter(repos.Invite, repos.User, repos.Token))
+	r.Mount("/api/auth", auth.NewAuthRouter(repos.User, repos.Token, repos.Lockout, repos.RequestCredits, repos.FeedToken, repos.PersonalToken))
+	r.Mount("/api/books", books.NewBookRouter(repos, source, hub, downloadService, searchCache, store))
+	r.Mount("/api/admin", admin.NewAdminRouter(repos, userService, source, searchCache, store))
+	r.Mount("/api/invites", invites.NewInviteRouter(repos.Invite, repos.User, repos.Token, repos.PersonalToken))
+	r.Mount("/opds", opds.NewOPDSRouter(repos))
 
 	// Public settings endpoint (for frontend to check anonymous access)
 	r.Get("/api/settings/public", func(w http.ResponseWriter, r *http.Request) {
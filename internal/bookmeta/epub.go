@@ -0,0 +1,217 @@
+package bookmeta
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Covers larger than this are ignored rather than read into memory
+const maxCoverSize = 10 << 20
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfPackage struct {
+	Metadata struct {
+		Titles      []string        `xml:"title"`
+		Creators    []opfCreator    `xml:"creator"`
+		Languages   []string        `xml:"language"`
+		Publishers  []string        `xml:"publisher"`
+		Identifiers []opfIdentifier `xml:"identifier"`
+		Description []string        `xml:"description"`
+		Meta        []struct {
+			Name    string `xml:"name,attr"`
+			Content string `xml:"content,attr"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+type opfCreator struct {
+	Name string `xml:",chardata"`
+	Role string `xml:"role,attr"`
+}
+
+type opfIdentifier struct {
+	Value  string `xml:",chardata"`
+	Scheme string `xml:"scheme,attr"`
+}
+
+func extractEPUB(r io.ReaderAt, size int64) (*Metadata, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("bookmeta: not a valid EPUB: %w", err)
+	}
+
+	var container epubContainer
+	if err := decodeZipXML(zr, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+
+	opfPath := ""
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+			opfPath = rootfile.FullPath
+			break
+		}
+	}
+	if opfPath == "" {
+		return nil, errors.New("bookmeta: EPUB has no package document")
+	}
+
+	var pkg opfPackage
+	if err := decodeZipXML(zr, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	md := pkg.Metadata
+	meta := &Metadata{
+		Title:       first(md.Titles),
+		Language:    first(md.Languages),
+		Publisher:   first(md.Publishers),
+		Description: stripTags(first(md.Description)),
+	}
+
+	// Creators without a role, or marked as authors, are the authors
+	for _, creator := range md.Creators {
+		if creator.Role == "" || creator.Role == "aut" {
+			meta.Authors = append(meta.Authors, creator.Name)
+		}
+	}
+
+	for _, id := range md.Identifiers {
+		if strings.EqualFold(id.Scheme, "isbn") || strings.HasPrefix(strings.ToLower(strings.TrimSpace(id.Value)), "urn:isbn:") {
+			meta.ISBN = id.Value
+			break
+		}
+	}
+	if meta.ISBN == "" {
+		for _, id := range md.Identifiers {
+			if isbn := normalizeISBN(id.Value); isbn != "" {
+				meta.ISBN = isbn
+				break
+			}
+		}
+	}
+
+	meta.Cover = epubCover(zr, &pkg, path.Dir(opfPath))
+	return meta, nil
+}
+
+// epubCover finds the cover image from the EPUB 3 cover-image property, the
+// EPUB 2 cover meta element or, failing both, an image whose id says cover
+func epubCover(zr *zip.Reader, pkg *opfPackage, opfDir string) *Cover {
+	coverID := ""
+	for _, meta := range pkg.Metadata.Meta {
+		if meta.Name == "cover" {
+			coverID = meta.Content
+		}
+	}
+
+	href, mediaType := "", ""
+	for _, item := range pkg.Manifest {
+		if strings.Contains(" "+item.Properties+" ", " cover-image ") {
+			href, mediaType = item.Href, item.MediaType
+			break
+		}
+	}
+	if href == "" && coverID != "" {
+		for _, item := range pkg.Manifest {
+			if item.ID == coverID {
+				href, mediaType = item.Href, item.MediaType
+				break
+			}
+		}
+	}
+	if href == "" {
+		for _, item := range pkg.Manifest {
+			if strings.HasPrefix(item.MediaType, "image/") && strings.Contains(strings.ToLower(item.ID), "cover") {
+				href, mediaType = item.Href, item.MediaType
+				break
+			}
+		}
+	}
+	if href == "" || !strings.HasPrefix(mediaType, "image/") {
+		return nil
+	}
+
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	data, err := readZipFile(zr, path.Join(opfDir, href), maxCoverSize)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return &Cover{Data: data, MediaType: mediaType}
+}
+
+func decodeZipXML(zr *zip.Reader, name string, v any) error {
+	data, err := readZipFile(zr, name, 8<<20)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("bookmeta: failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+func readZipFile(zr *zip.Reader, name string, limit int64) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name && !strings.EqualFold(f.Name, name) {
+			continue
+		}
+		if int64(f.UncompressedSize64) > limit {
+			return nil, fmt.Errorf("bookmeta: %s is too large", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, limit))
+	}
+	return nil, fmt.Errorf("bookmeta: EPUB is missing %s", name)
+}
+
+func first(values []string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// stripTags removes markup from descriptions, which are often HTML
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, c := range s {
+		switch {
+		case c == '<':
+			inTag = true
+		case c == '>' && inTag:
+			inTag = false
+			b.WriteRune(' ')
+		case !inTag:
+			b.WriteRune(c)
+		}
+	}
+	return collapseSpace(b.String())
+}
@@ -0,0 +1,104 @@
+package bookmeta
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestExtractEPUB(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		want      Metadata
+		coverType string
+		coverData string
+	}{
+		{
+			// EPUB 2: cover named by <meta name="cover">, escaped href,
+			// illustrator dropped from the authors
+			fixture: "epub2.epub",
+			want: Metadata{
+				Title:       "The Left Hand of Darkness",
+				Authors:     []string{"Ursula K. Le Guin"},
+				Language:    "en",
+				Publisher:   "Ace Books",
+				ISBN:        "9780441478125",
+				Description: "A human envoy on Gethen .",
+			},
+			coverType: "image/jpeg",
+			coverData: "\xff\xd8\xff\xe0\x00\x10JFIF\x00cover",
+		},
+		{
+			// EPUB 3: cover-image manifest property, urn:isbn identifier,
+			// duplicate creator
+			fixture: "epub3.epub",
+			want: Metadata{
+				Title:    "Dune",
+				Authors:  []string{"Frank Herbert"},
+				Language: "en-US",
+				ISBN:     "9780441172719",
+			},
+			coverType: "image/png",
+			coverData: "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDRcover",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			meta, err := extractBytes(readFixture(t, tt.fixture), "epub")
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			checkMetadata(t, meta, &tt.want)
+
+			if meta.Cover == nil {
+				t.Fatal("no cover found")
+			}
+			if meta.Cover.MediaType != tt.coverType {
+				t.Errorf("cover type = %q, want %q", meta.Cover.MediaType, tt.coverType)
+			}
+			if string(meta.Cover.Data) != tt.coverData {
+				t.Errorf("cover data = %q, want %q", meta.Cover.Data, tt.coverData)
+			}
+		})
+	}
+}
+
+func TestExtractEPUBInvalid(t *testing.T) {
+	zipOf := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			w, _ := zw.Create(name)
+			w.Write([]byte(content))
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	epub2 := readFixture(t, "epub2.epub")
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a zip", []byte("PK but not really")},
+		{"truncated", epub2[:len(epub2)/2]},
+		{"no container", zipOf(map[string]string{"mimetype": "application/epub+zip"})},
+		{"no rootfile", zipOf(map[string]string{"META-INF/container.xml": "<container><rootfiles/></container>"})},
+		{"missing package", zipOf(map[string]string{
+			"META-INF/container.xml": `<container><rootfiles><rootfile full-path="content.opf"/></rootfiles></container>`,
+		})},
+		{"broken package", zipOf(map[string]string{
+			"META-INF/container.xml": `<container><rootfiles><rootfile full-path="content.opf"/></rootfiles></container>`,
+			"content.opf":            "<package><metadata>",
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if meta, err := extractBytes(tt.data, "epub"); err == nil {
+				t.Errorf("Extract returned %+v, want an error", meta)
+			}
+		})
+	}
+}
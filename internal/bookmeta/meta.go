@@ -0,0 +1,133 @@
+// Package bookmeta reads the metadata embedded in book files: the OPF
+// package document of EPUBs, the Info dictionary and XMP packet of PDFs and
+// the EXTH header of MOBI/AZW3 files.
+package bookmeta
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrUnsupportedFormat is returned for formats without embedded metadata
+var ErrUnsupportedFormat = errors.New("bookmeta: unsupported format")
+
+// Metadata is what a book file says about itself. Any field may be empty.
+type Metadata struct {
+	Title       string   `json:"title"`
+	Authors     []string `json:"authors"`
+	Language    string   `json:"language"`
+	Publisher   string   `json:"publisher"`
+	ISBN        string   `json:"isbn"`
+	Description string   `json:"description"`
+	Cover       *Cover   `json:"-"`
+}
+
+// Cover is an image embedded in the book
+type Cover struct {
+	Data      []byte
+	MediaType string
+}
+
+// Extension returns the file extension for the cover's media type
+func (c *Cover) Extension() string {
+	switch c.MediaType {
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	default:
+		return ".jpg"
+	}
+}
+
+// AuthorList joins the authors the way savedbooks stores them
+func (m *Metadata) AuthorList() string {
+	return strings.Join(m.Authors, ", ")
+}
+
+// Extract reads the metadata of a book of the given format ("epub", "pdf",
+// "mobi", "azw3", ...) from r, which holds size bytes
+func Extract(r io.ReaderAt, size int64, format string) (*Metadata, error) {
+	var meta *Metadata
+	var err error
+
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "epub":
+		meta, err = extractEPUB(r, size)
+	case "pdf":
+		meta, err = extractPDF(r, size)
+	case "mobi", "azw", "azw3", "prc":
+		meta, err = extractMOBI(r, size)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta.clean()
+	return meta, nil
+}
+
+// clean trims whitespace and drops empty authors
+func (m *Metadata) clean() {
+	m.Title = collapseSpace(m.Title)
+	m.Language = strings.TrimSpace(m.Language)
+	m.Publisher = collapseSpace(m.Publisher)
+	m.ISBN = normalizeISBN(m.ISBN)
+	m.Description = strings.TrimSpace(m.Description)
+
+	authors := m.Authors[:0]
+	seen := make(map[string]bool)
+	for _, author := range m.Authors {
+		author = collapseSpace(author)
+		if author == "" || seen[author] {
+			continue
+		}
+		seen[author] = true
+		authors = append(authors, author)
+	}
+	m.Authors = authors
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// normalizeISBN strips prefixes and separators, returning "" unless what is
+// left looks like an ISBN-10 or ISBN-13
+func normalizeISBN(s string) string {
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	for _, prefix := range []string{"urn:isbn:", "isbn:", "isbn"} {
+		if strings.HasPrefix(lower, prefix) {
+			s = s[len(prefix):]
+			break
+		}
+	}
+
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == 'X' || c == 'x':
+			b.WriteRune('X')
+		case c == '-' || c == ' ':
+		default:
+			return ""
+		}
+	}
+
+	isbn := b.String()
+	if len(isbn) == 13 && !strings.Contains(isbn, "X") {
+		return isbn
+	}
+	if len(isbn) == 10 && !strings.Contains(isbn[:9], "X") {
+		return isbn
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package bookmeta
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return data
+}
+
+func extractBytes(data []byte, format string) (*Metadata, error) {
+	return Extract(bytes.NewReader(data), int64(len(data)), format)
+}
+
+// checkMetadata compares everything but the cover
+func checkMetadata(t *testing.T, got, want *Metadata) {
+	t.Helper()
+	if got.Title != want.Title {
+		t.Errorf("title = %q, want %q", got.Title, want.Title)
+	}
+	if !reflect.DeepEqual(got.Authors, want.Authors) {
+		t.Errorf("authors = %q, want %q", got.Authors, want.Authors)
+	}
+	if got.Language != want.Language {
+		t.Errorf("language = %q, want %q", got.Language, want.Language)
+	}
+	if got.Publisher != want.Publisher {
+		t.Errorf("publisher = %q, want %q", got.Publisher, want.Publisher)
+	}
+	if got.ISBN != want.ISBN {
+		t.Errorf("isbn = %q, want %q", got.ISBN, want.ISBN)
+	}
+	if got.Description != want.Description {
+		t.Errorf("description = %q, want %q", got.Description, want.Description)
+	}
+}
+
+func TestExtractUnsupportedFormat(t *testing.T) {
+	for _, format := range []string{"txt", "fb2", "djvu", ""} {
+		if _, err := extractBytes([]byte("text"), format); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("Extract(%q) error = %v, want ErrUnsupportedFormat", format, err)
+		}
+	}
+}
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"978-0-441-17271-9", "9780441172719"},
+		{"urn:isbn:9780441172719", "9780441172719"},
+		{"ISBN 0-399-12593-x", "039912593X"},
+		{"uuid:1234", ""},
+		{"97804411727", ""},
+		{"X780441172719", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeISBN(tt.in); got != tt.want {
+			t.Errorf("normalizeISBN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
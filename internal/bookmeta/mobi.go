@@ -0,0 +1,169 @@
+package bookmeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// EXTH record types
+const (
+	exthAuthor      = 100
+	exthPublisher   = 101
+	exthDescription = 103
+	exthISBN        = 104
+	exthCoverOffset = 201
+	exthTitle       = 503
+	exthLanguage    = 524
+)
+
+const (
+	palmHeaderSize  = 78
+	mobiEncodingUTF = 65001
+	noImageIndex    = 0xFFFFFFFF
+)
+
+// mobiLanguages maps the main language code of a MOBI locale, the low byte
+// of the field, to an ISO 639-1 code for books without an EXTH language
+var mobiLanguages = map[uint32]string{
+	0x07: "de", 0x09: "en", 0x0a: "es", 0x0c: "fr", 0x10: "it", 0x11: "ja",
+	0x13: "nl", 0x15: "pl", 0x16: "pt", 0x19: "ru", 0x1d: "sv", 0x04: "zh",
+}
+
+func extractMOBI(r io.ReaderAt, size int64) (*Metadata, error) {
+	header := make([]byte, palmHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("bookmeta: not a valid MOBI: %w", err)
+	}
+	if string(header[60:68]) != "BOOKMOBI" {
+		return nil, errors.New("bookmeta: not a MOBI file")
+	}
+
+	// Record list: 8 bytes per record, the first 4 being its offset
+	count := int(binary.BigEndian.Uint16(header[76:78]))
+	if count == 0 {
+		return nil, errors.New("bookmeta: MOBI has no records")
+	}
+	list := make([]byte, count*8)
+	if _, err := r.ReadAt(list, palmHeaderSize); err != nil {
+		return nil, fmt.Errorf("bookmeta: truncated MOBI record list: %w", err)
+	}
+	offsets := make([]int64, count)
+	for i := range offsets {
+		offsets[i] = int64(binary.BigEndian.Uint32(list[i*8:]))
+	}
+
+	record := func(i int) ([]byte, error) {
+		if i < 0 || i >= count {
+			return nil, fmt.Errorf("bookmeta: MOBI record %d out of range", i)
+		}
+		end := size
+		if i+1 < count {
+			end = offsets[i+1]
+		}
+		if offsets[i] > end || end > size || end-offsets[i] > maxCoverSize {
+			return nil, fmt.Errorf("bookmeta: invalid MOBI record %d", i)
+		}
+		data := make([]byte, end-offsets[i])
+		_, err := r.ReadAt(data, offsets[i])
+		return data, err
+	}
+
+	rec0, err := record(0)
+	if err != nil {
+		return nil, err
+	}
+	// A 16 byte PalmDOC header, then the MOBI header
+	if len(rec0) < 132 || string(rec0[16:20]) != "MOBI" {
+		return nil, errors.New("bookmeta: missing MOBI header")
+	}
+
+	mobiLength := int(binary.BigEndian.Uint32(rec0[20:24]))
+	encoding := binary.BigEndian.Uint32(rec0[28:32])
+	decode := func(b []byte) string {
+		if encoding == mobiEncodingUTF {
+			return string(b)
+		}
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(b)
+		if err != nil {
+			return string(b)
+		}
+		return string(decoded)
+	}
+
+	meta := &Metadata{}
+	nameOffset := int(binary.BigEndian.Uint32(rec0[84:88]))
+	nameLength := int(binary.BigEndian.Uint32(rec0[88:92]))
+	if nameOffset+nameLength <= len(rec0) {
+		meta.Title = decode(rec0[nameOffset : nameOffset+nameLength])
+	}
+	locale := binary.BigEndian.Uint32(rec0[92:96])
+	firstImage := binary.BigEndian.Uint32(rec0[108:112])
+	hasEXTH := binary.BigEndian.Uint32(rec0[128:132])&0x40 != 0
+
+	coverOffset := uint32(noImageIndex)
+	exthStart := 16 + mobiLength
+	if hasEXTH && exthStart+12 <= len(rec0) && string(rec0[exthStart:exthStart+4]) == "EXTH" {
+		records := int(binary.BigEndian.Uint32(rec0[exthStart+8:]))
+		pos := exthStart + 12
+		for i := 0; i < records && pos+8 <= len(rec0); i++ {
+			kind := binary.BigEndian.Uint32(rec0[pos:])
+			length := int(binary.BigEndian.Uint32(rec0[pos+4:]))
+			if length < 8 || pos+length > len(rec0) {
+				break
+			}
+			value := rec0[pos+8 : pos+length]
+			pos += length
+
+			switch kind {
+			case exthAuthor:
+				meta.Authors = append(meta.Authors, decode(value))
+			case exthPublisher:
+				meta.Publisher = decode(value)
+			case exthDescription:
+				meta.Description = stripTags(decode(value))
+			case exthISBN:
+				meta.ISBN = decode(value)
+			case exthTitle:
+				meta.Title = decode(value)
+			case exthLanguage:
+				meta.Language = decode(value)
+			case exthCoverOffset:
+				if len(value) >= 4 {
+					coverOffset = binary.BigEndian.Uint32(value)
+				}
+			}
+		}
+	}
+
+	if meta.Language == "" {
+		meta.Language = mobiLanguages[locale&0xFF]
+	}
+
+	if firstImage != noImageIndex && coverOffset != noImageIndex {
+		if data, err := record(int(firstImage + coverOffset)); err == nil {
+			if mediaType := imageType(data); mediaType != "" {
+				meta.Cover = &Cover{Data: data, MediaType: mediaType}
+			}
+		}
+	}
+
+	return meta, nil
+}
+
+// imageType sniffs the image formats MOBI files embed
+func imageType(data []byte) string {
+	switch {
+	case len(data) > 3 && data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF:
+		return "image/jpeg"
+	case len(data) > 8 && string(data[:8]) == "\x89PNG\r\n\x1a\n":
+		return "image/png"
+	case len(data) > 6 && (string(data[:6]) == "GIF87a" || string(data[:6]) == "GIF89a"):
+		return "image/gif"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,224 @@
+package bookmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// dune.mobi holds three records: the header record with an EXTH block and
+// the full name, a text record and a JPEG cover. Its locale is en-US and it
+// has no EXTH language.
+var duneMOBI = Metadata{
+	Title:       "Dune – Messiah",
+	Authors:     []string{"Frank Herbert", "Brian Herbert"},
+	Language:    "en",
+	Publisher:   "Chilton Books",
+	ISBN:        "9780441172719",
+	Description: "A desert planet",
+}
+
+// mobiRecord0 returns the offset of the header record in a MOBI file
+func mobiRecord0(data []byte) int {
+	return int(binary.BigEndian.Uint32(data[palmHeaderSize:]))
+}
+
+// exthRecord returns the offset of the i-th EXTH record in a MOBI file
+func exthRecord(t *testing.T, data []byte, i int) int {
+	t.Helper()
+	pos := bytes.Index(data, []byte("EXTH"))
+	if pos < 0 {
+		t.Fatal("fixture has no EXTH block")
+	}
+	pos += 12
+	for ; i > 0; i-- {
+		pos += int(binary.BigEndian.Uint32(data[pos+4:]))
+	}
+	return pos
+}
+
+func TestExtractMOBI(t *testing.T) {
+	meta, err := extractBytes(readFixture(t, "dune.mobi"), "azw3")
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	checkMetadata(t, meta, &duneMOBI)
+
+	if meta.Cover == nil {
+		t.Fatal("no cover found")
+	}
+	if meta.Cover.MediaType != "image/jpeg" {
+		t.Errorf("cover type = %q, want image/jpeg", meta.Cover.MediaType)
+	}
+}
+
+func TestExtractMOBICorrupt(t *testing.T) {
+	put32 := func(data []byte, at int, v uint32) { binary.BigEndian.PutUint32(data[at:], v) }
+
+	titleOnly := Metadata{Title: "DUNE_FULL_NAME", Language: "en"}
+	tests := []struct {
+		name      string
+		corrupt   func(t *testing.T, data []byte) []byte
+		wantErr   bool
+		want      Metadata
+		wantCover bool
+	}{
+		{
+			name: "not a mobi",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				copy(data[60:], "TEXtREAd")
+				return data
+			},
+			wantErr: true,
+		},
+		{
+			name:    "shorter than the palm header",
+			corrupt: func(t *testing.T, data []byte) []byte { return data[:40] },
+			wantErr: true,
+		},
+		{
+			name: "no records",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				binary.BigEndian.PutUint16(data[76:], 0)
+				return data
+			},
+			wantErr: true,
+		},
+		{
+			name: "record list past the end",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				binary.BigEndian.PutUint16(data[76:], 0xFFFF)
+				return data
+			},
+			wantErr: true,
+		},
+		{
+			name: "records out of order",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, palmHeaderSize+8, 10)
+				return data
+			},
+			wantErr: true,
+		},
+		{
+			name: "header record cut short",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				return data[:mobiRecord0(data)+100]
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing MOBI header",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				copy(data[mobiRecord0(data)+16:], "XXXX")
+				return data
+			},
+			wantErr: true,
+		},
+		{
+			name: "no EXTH flag",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, mobiRecord0(data)+128, 0)
+				return data
+			},
+			want: titleOnly,
+		},
+		{
+			name: "EXTH past the record",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, mobiRecord0(data)+20, 0xFFFFFF00)
+				return data
+			},
+			want: titleOnly,
+		},
+		{
+			name: "EXTH record overruns the block",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, exthRecord(t, data, 2)+4, 0xFFFF)
+				return data
+			},
+			want: Metadata{Title: "DUNE_FULL_NAME", Authors: []string{"Frank Herbert", "Brian Herbert"}, Language: "en"},
+		},
+		{
+			name: "EXTH record shorter than its header",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, exthRecord(t, data, 1)+4, 3)
+				return data
+			},
+			want: Metadata{Title: "DUNE_FULL_NAME", Authors: []string{"Frank Herbert"}, Language: "en"},
+		},
+		{
+			name: "EXTH record count too high",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, bytes.Index(data, []byte("EXTH"))+8, 0xFFFFFFFF)
+				return data
+			},
+			want:      duneMOBI,
+			wantCover: true,
+		},
+		{
+			name: "full name past the record",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				rec0 := mobiRecord0(data)
+				put32(data, rec0+84, 0xFFFFFFF0)
+				put32(data, rec0+128, 0)
+				return data
+			},
+			want: Metadata{Language: "en"},
+		},
+		{
+			name: "cover record out of range",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, mobiRecord0(data)+108, 50)
+				return data
+			},
+			want: duneMOBI,
+		},
+		{
+			name: "cover index overflows",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, mobiRecord0(data)+108, 0xFFFFFFFE)
+				put32(data, exthRecord(t, data, 6)+8, 1)
+				return data
+			},
+			want: duneMOBI,
+		},
+		{
+			name: "cover is not an image",
+			corrupt: func(t *testing.T, data []byte) []byte {
+				put32(data, mobiRecord0(data)+108, 1)
+				return data
+			},
+			want: duneMOBI,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.corrupt(t, readFixture(t, "dune.mobi"))
+			meta, err := extractBytes(data, "mobi")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Extract returned %+v, want an error", meta)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			checkMetadata(t, meta, &tt.want)
+			if hasCover := meta.Cover != nil; hasCover != tt.wantCover {
+				t.Errorf("cover found = %v, want %v", hasCover, tt.wantCover)
+			}
+		})
+	}
+}
+
+// Cutting the file anywhere must give an error or partial metadata, never
+// a panic
+func TestExtractMOBITruncated(t *testing.T) {
+	data := readFixture(t, "dune.mobi")
+	for n := 0; n <= len(data); n++ {
+		extractBytes(data[:n], "mobi")
+	}
+}
@@ -0,0 +1,247 @@
+package bookmeta
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// PDFs are not parsed in full. The Info dictionary normally sits near the
+// trailer and the XMP packet near the start, so only both ends are read.
+const pdfScanWindow = 2 << 20
+
+var (
+	pdfInfoKey = regexp.MustCompile(`/(Title|Author|Subject)\s*(\(|<[0-9A-Fa-f\s]*>)`)
+	xmpPacket  = regexp.MustCompile(`(?s)<x:xmpmeta.*?</x:xmpmeta>`)
+)
+
+type xmpMeta struct {
+	Descriptions []struct {
+		Title       xmpAlt  `xml:"title"`
+		Creator     xmpList `xml:"creator"`
+		Description xmpAlt  `xml:"description"`
+		Publisher   xmpList `xml:"publisher"`
+		Language    xmpList `xml:"language"`
+		Identifier  xmpList `xml:"identifier"`
+	} `xml:"RDF>Description"`
+}
+
+type xmpAlt struct {
+	Items []string `xml:"Alt>li"`
+}
+
+type xmpList struct {
+	Seq []string `xml:"Seq>li"`
+	Bag []string `xml:"Bag>li"`
+}
+
+func (l xmpList) values() []string {
+	return append(append([]string(nil), l.Seq...), l.Bag...)
+}
+
+func extractPDF(r io.ReaderAt, size int64) (*Metadata, error) {
+	head := make([]byte, min(size, pdfScanWindow))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimLeft(head, "\x00\r\n\t "), []byte("%PDF-")) {
+		return nil, errors.New("bookmeta: not a PDF file")
+	}
+
+	data := head
+	if size > pdfScanWindow {
+		tailStart := max(size-pdfScanWindow, int64(len(head)))
+		tail := make([]byte, size-tailStart)
+		if _, err := r.ReadAt(tail, tailStart); err != nil && err != io.EOF {
+			return nil, err
+		}
+		data = append(head, tail...)
+	}
+
+	meta := &Metadata{}
+	parseXMP(data, meta)
+	parsePDFInfo(data, meta)
+	return meta, nil
+}
+
+// parseXMP fills in metadata from the first readable XMP packet
+func parseXMP(data []byte, meta *Metadata) {
+	for _, packet := range xmpPacket.FindAll(data, -1) {
+		var x xmpMeta
+		if xml.Unmarshal(packet, &x) != nil {
+			continue
+		}
+		for _, d := range x.Descriptions {
+			if meta.Title == "" {
+				meta.Title = first(d.Title.Items)
+			}
+			if len(meta.Authors) == 0 {
+				meta.Authors = d.Creator.values()
+			}
+			if meta.Description == "" {
+				meta.Description = first(d.Description.Items)
+			}
+			if meta.Publisher == "" {
+				meta.Publisher = first(d.Publisher.values())
+			}
+			if meta.Language == "" {
+				meta.Language = first(d.Language.values())
+			}
+			if meta.ISBN == "" {
+				for _, id := range d.Identifier.values() {
+					if isbn := normalizeISBN(id); isbn != "" {
+						meta.ISBN = isbn
+						break
+					}
+				}
+			}
+		}
+		if meta.Title != "" {
+			return
+		}
+	}
+}
+
+// parsePDFInfo fills whatever XMP left empty from the document Info
+// dictionary. Later occurrences win, as incremental updates append newer
+// dictionaries to the end of the file.
+func parsePDFInfo(data []byte, meta *Metadata) {
+	var title, author, subject string
+	for _, match := range pdfInfoKey.FindAllSubmatchIndex(data, -1) {
+		key := string(data[match[2]:match[3]])
+		var value string
+		if data[match[4]] == '(' {
+			value = readPDFLiteral(data[match[4]+1:])
+		} else {
+			value = readPDFHex(data[match[4]:match[5]])
+		}
+		if value == "" {
+			continue
+		}
+		switch key {
+		case "Title":
+			title = value
+		case "Author":
+			author = value
+		case "Subject":
+			subject = value
+		}
+	}
+
+	if meta.Title == "" {
+		meta.Title = title
+	}
+	if len(meta.Authors) == 0 && author != "" {
+		meta.Authors = splitAuthors(author)
+	}
+	if meta.Description == "" {
+		meta.Description = subject
+	}
+}
+
+// readPDFLiteral decodes a literal string whose opening parenthesis has
+// already been consumed
+func readPDFLiteral(data []byte) string {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(data) && i < 4096; i++ {
+		c := data[i]
+		switch {
+		case c == '\\' && i+1 < len(data):
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					end := i + 1
+					for end < len(data) && end < i+3 && data[end] >= '0' && data[end] <= '7' {
+						end++
+					}
+					n, _ := strconv.ParseUint(string(data[i:end]), 8, 8)
+					out = append(out, byte(n))
+					i = end - 1
+				} else {
+					out = append(out, e)
+				}
+			}
+		case c == '(':
+			depth++
+			out = append(out, c)
+		case c == ')':
+			if depth == 0 {
+				return decodePDFText(out)
+			}
+			depth--
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return ""
+}
+
+func readPDFHex(data []byte) string {
+	digits := bytes.Map(func(r rune) rune {
+		if r == '<' || r == '>' || r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+			return -1
+		}
+		return r
+	}, data)
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	raw, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return ""
+	}
+	return decodePDFText(raw)
+}
+
+// decodePDFText decodes a PDF text string, which is UTF-16BE when it starts
+// with a byte order mark and PDFDocEncoding (close to Windows-1252) otherwise
+func decodePDFText(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if len(raw) >= 3 && raw[0] == 0xEF && raw[1] == 0xBB && raw[2] == 0xBF {
+		return string(raw[3:])
+	}
+	decoded, err := charmap.Windows1252.NewDecoder().Bytes(raw)
+	if err != nil {
+		return string(raw)
+	}
+	return string(decoded)
+}
+
+// splitAuthors splits a free form author field on the separators PDFs use
+func splitAuthors(s string) []string {
+	for _, sep := range []string{";", " & ", " and "} {
+		if strings.Contains(s, sep) {
+			return strings.Split(s, sep)
+		}
+	}
+	return []string{s}
+}
@@ -0,0 +1,112 @@
+package bookmeta
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExtractPDF(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    Metadata
+	}{
+		{
+			// Literal strings with escapes, octal PDFDocEncoding bytes, a
+			// line continuation and nested parentheses. The later Info
+			// dictionary wins.
+			fixture: "literal.pdf",
+			want: Metadata{
+				Title:       "Children of Dune (Book 3) - Café edition",
+				Authors:     []string{"Frank Herbert", "Brian Herbert"},
+				Description: "The (nested) story\nof Leto",
+			},
+		},
+		{
+			// Hex strings with whitespace and an odd number of digits
+			fixture: "hex.pdf",
+			want: Metadata{
+				Title:       "Dune Messiah",
+				Authors:     []string{"Frank Herbert"},
+				Description: "@",
+			},
+		},
+		{
+			// UTF-16BE with a byte order mark, as hex and as a literal
+			fixture: "utf16.pdf",
+			want: Metadata{
+				Title:   "デューン",
+				Authors: []string{"Anna", "Bob"},
+			},
+		},
+		{
+			// XMP takes precedence; the Info dictionary fills the gaps
+			fixture: "xmp.pdf",
+			want: Metadata{
+				Title:       "God Emperor of Dune",
+				Authors:     []string{"Frank Herbert"},
+				Language:    "en",
+				Publisher:   "Putnam",
+				ISBN:        "039912593X",
+				Description: "Only in the Info dictionary",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			meta, err := extractBytes(readFixture(t, tt.fixture), "pdf")
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			checkMetadata(t, meta, &tt.want)
+			if meta.Cover != nil {
+				t.Errorf("unexpected cover")
+			}
+		})
+	}
+}
+
+// Files larger than the scan window are read from both ends
+func TestExtractPDFLargeFile(t *testing.T) {
+	head := []byte("%PDF-1.4\n<< /Title (Old Title) >>\n")
+	tail := []byte("<< /Title (New Title) /Author (Frank Herbert) >>\n%%EOF\n")
+	padding := bytes.Repeat([]byte("0"), 2*pdfScanWindow)
+
+	data := append(append(append([]byte(nil), head...), padding...), tail...)
+	meta, err := extractBytes(data, "pdf")
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	checkMetadata(t, meta, &Metadata{Title: "New Title", Authors: []string{"Frank Herbert"}})
+}
+
+func TestExtractPDFInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		want    Metadata
+	}{
+		{name: "not a pdf", data: "<html>not a pdf</html>", wantErr: true},
+		{name: "empty", data: "", wantErr: true},
+		{name: "unterminated literal", data: "%PDF-1.4\n<< /Title (Dune"},
+		{name: "bad hex", data: "%PDF-1.4\n<< /Title <zz> /Author <4672616E6B> >>", want: Metadata{Authors: []string{"Frank"}}},
+		{name: "broken xmp", data: "%PDF-1.4\n<x:xmpmeta><rdf:RDF></x:xmpmeta>\n<< /Title (Dune) >>", want: Metadata{Title: "Dune"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := extractBytes([]byte(tt.data), "pdf")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Extract returned %+v, want an error", meta)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			checkMetadata(t, meta, &tt.want)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package convert produces derived formats of books: plain text from EPUB
+// and EPUB from FB2 and plain text, all in pure Go.
+package convert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+)
+
+// ErrUnsupported is returned when there is no conversion between two formats
+var ErrUnsupported = errors.New("convert: conversion not supported")
+
+// DerivedPrefix is the storage prefix derived files are cached under
+const DerivedPrefix = "derived/"
+
+// Info describes the book being converted. Formats that carry no metadata
+// of their own, such as plain text, take their title and authors from here.
+type Info struct {
+	Hash     string
+	Title    string
+	Authors  string
+	Language string
+}
+
+type converter func(ctx context.Context, in io.ReaderAt, size int64, out io.Writer, info Info) error
+
+// conversions maps a source format to the formats it converts to
+var conversions = map[string]map[string]converter{
+	"epub": {"txt": epubToText},
+	"fb2":  {"epub": fb2ToEPUB, "txt": fb2ToText},
+	"txt":  {"epub": textToEPUB},
+}
+
+// Targets returns the formats a book in format can be converted to, sorted
+func Targets(format string) []string {
+	var targets []string
+	for target := range conversions[normalize(format)] {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Supported reports whether a book in format from can be converted to to
+func Supported(from, to string) bool {
+	_, ok := conversions[normalize(from)][normalize(to)]
+	return ok
+}
+
+// Convert writes the book read from in, which holds size bytes in format
+// from, to out in format to
+func Convert(ctx context.Context, from, to string, in io.ReaderAt, size int64, out io.Writer, info Info) error {
+	convert, ok := conversions[normalize(from)][normalize(to)]
+	if !ok {
+		return ErrUnsupported
+	}
+	return convert(ctx, in, size, out, info)
+}
+
+// DerivedKey is the storage key a book's copy in format is cached under.
+// Only books keyed by an MD5 have one.
+func DerivedKey(hash, format string) (string, error) {
+	name, err := anna.StoredFilename(hash, normalize(format))
+	if err != nil {
+		return "", err
+	}
+	return path.Join(DerivedPrefix, name), nil
+}
+
+// DerivedKeys returns the keys every possible derivative of a book would be
+// cached under, whatever its format, for cleaning them up when the original
+// or its metadata changes
+func DerivedKeys(hash string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, targets := range conversions {
+		for target := range targets {
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+			if key, err := DerivedKey(hash, target); err == nil {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func normalize(format string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+}
@@ -0,0 +1,48 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTargets(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"epub", []string{"txt"}},
+		{".FB2", []string{"epub", "txt"}},
+		{" txt ", []string{"epub"}},
+		{"pdf", nil},
+	}
+	for _, tt := range tests {
+		if got := Targets(tt.format); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Targets(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	if Supported("pdf", "epub") || Supported("epub", "epub") {
+		t.Error("Supported reports a conversion that does not exist")
+	}
+	var out bytes.Buffer
+	err := Convert(context.Background(), "pdf", "epub", bytes.NewReader(nil), 0, &out, Info{})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Convert error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestDerivedKeys(t *testing.T) {
+	hash := "0123456789ABCDEF0123456789ABCDEF"
+	want := []string{"derived/0123456789abcdef0123456789abcdef.epub", "derived/0123456789abcdef0123456789abcdef.txt"}
+	if got := DerivedKeys(hash); !reflect.DeepEqual(got, want) {
+		t.Errorf("DerivedKeys = %q, want %q", got, want)
+	}
+	if got := DerivedKeys("../../etc/passwd"); got != nil {
+		t.Errorf("DerivedKeys of an invalid hash = %q, want none", got)
+	}
+}
@@ -0,0 +1,214 @@
+package convert
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// chapter is one XHTML document of a generated EPUB. Body is already
+// escaped markup.
+type chapter struct {
+	Title string
+	Body  string
+}
+
+// resource is an image carried in a generated EPUB
+type resource struct {
+	ID        string
+	Href      string
+	MediaType string
+	Data      []byte
+}
+
+// epubBook is an EPUB 3 file to be written, with an NCX table of contents
+// as well for older readers
+type epubBook struct {
+	Info     Info
+	Chapters []chapter
+	Images   []resource
+	CoverID  string
+}
+
+func (b *epubBook) write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	// The mimetype entry must come first and be stored uncompressed
+	mt, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mt, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"META-INF/container.xml", containerXML},
+		{"OEBPS/content.opf", b.opf()},
+		{"OEBPS/nav.xhtml", b.nav()},
+		{"OEBPS/toc.ncx", b.ncx()},
+		{"OEBPS/style.css", styleCSS},
+	}
+	for i, ch := range b.Chapters {
+		files = append(files, struct {
+			name    string
+			content string
+		}{"OEBPS/" + chapterHref(i), b.chapterXHTML(ch)})
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range b.Images {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: "OEBPS/" + img.Href, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(img.Data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (b *epubBook) language() string {
+	if b.Info.Language != "" {
+		return b.Info.Language
+	}
+	return "en"
+}
+
+func (b *epubBook) identifier() string {
+	return "urn:marchive:" + b.Info.Hash
+}
+
+func (b *epubBook) opf() string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&sb, "    <dc:identifier id=\"book-id\">%s</dc:identifier>\n", esc(b.identifier()))
+	fmt.Fprintf(&sb, "    <dc:title>%s</dc:title>\n", esc(b.Info.Title))
+	for _, author := range splitList(b.Info.Authors) {
+		fmt.Fprintf(&sb, "    <dc:creator>%s</dc:creator>\n", esc(author))
+	}
+	fmt.Fprintf(&sb, "    <dc:language>%s</dc:language>\n", esc(b.language()))
+	fmt.Fprintf(&sb, "    <meta property=\"dcterms:modified\">%s</meta>\n", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	if b.CoverID != "" {
+		fmt.Fprintf(&sb, "    <meta name=\"cover\" content=\"%s\"/>\n", esc(b.CoverID))
+	}
+	sb.WriteString("  </metadata>\n  <manifest>\n")
+	sb.WriteString("    <item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	sb.WriteString("    <item id=\"ncx\" href=\"toc.ncx\" media-type=\"application/x-dtbncx+xml\"/>\n")
+	sb.WriteString("    <item id=\"style\" href=\"style.css\" media-type=\"text/css\"/>\n")
+	for i := range b.Chapters {
+		fmt.Fprintf(&sb, "    <item id=\"chapter%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, chapterHref(i))
+	}
+	for _, img := range b.Images {
+		properties := ""
+		if img.ID == b.CoverID {
+			properties = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&sb, "    <item id=\"%s\" href=\"%s\" media-type=\"%s\"%s/>\n", esc(img.ID), esc(img.Href), esc(img.MediaType), properties)
+	}
+	sb.WriteString("  </manifest>\n  <spine toc=\"ncx\">\n")
+	for i := range b.Chapters {
+		fmt.Fprintf(&sb, "    <itemref idref=\"chapter%d\"/>\n", i+1)
+	}
+	sb.WriteString("  </spine>\n</package>\n")
+	return sb.String()
+}
+
+func (b *epubBook) nav() string {
+	var sb strings.Builder
+	sb.WriteString(xhtmlHeader(b.language(), b.Info.Title))
+	sb.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n<ol>\n")
+	for i, ch := range b.Chapters {
+		fmt.Fprintf(&sb, "<li><a href=\"%s\">%s</a></li>\n", chapterHref(i), esc(ch.Title))
+	}
+	sb.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return sb.String()
+}
+
+func (b *epubBook) ncx() string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+`)
+	fmt.Fprintf(&sb, "    <meta name=\"dtb:uid\" content=\"%s\"/>\n", esc(b.identifier()))
+	fmt.Fprintf(&sb, "  </head>\n  <docTitle><text>%s</text></docTitle>\n  <navMap>\n", esc(b.Info.Title))
+	for i, ch := range b.Chapters {
+		fmt.Fprintf(&sb, "    <navPoint id=\"nav%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"%s\"/></navPoint>\n",
+			i+1, i+1, esc(ch.Title), chapterHref(i))
+	}
+	sb.WriteString("  </navMap>\n</ncx>\n")
+	return sb.String()
+}
+
+func (b *epubBook) chapterXHTML(ch chapter) string {
+	return xhtmlHeader(b.language(), ch.Title) + ch.Body + "\n</body>\n</html>\n"
+}
+
+func xhtmlHeader(lang, title string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">
+<head>
+<title>%s</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+`, esc(lang), esc(lang), esc(title))
+}
+
+func chapterHref(i int) string {
+	return fmt.Sprintf("chapter%d.xhtml", i+1)
+}
+
+// esc escapes text for XHTML content and attributes
+func esc(s string) string {
+	return html.EscapeString(s)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const styleCSS = `body { margin: 0 5%; line-height: 1.4; }
+h1, h2, h3 { text-align: center; }
+p { margin: 0 0 0.6em 0; text-indent: 1.2em; }
+blockquote { margin: 1em 2em; font-style: italic; }
+.poem { margin: 1em 2em; }
+.poem p { text-indent: 0; }
+img { max-width: 100%; }
+`
@@ -0,0 +1,402 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// fb2Node is an element of a FictionBook document. FB2 mixes text and
+// markup freely, so the document is kept as a tree in document order.
+type fb2Node struct {
+	Name     string
+	Attrs    map[string]string
+	Children []*fb2Node
+	Text     string
+	IsText   bool
+}
+
+func (n *fb2Node) child(name string) *fb2Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *fb2Node) childrenNamed(name string) []*fb2Node {
+	var nodes []*fb2Node
+	for _, c := range n.Children {
+		if c.Name == name {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// text returns the node's text content with whitespace collapsed
+func (n *fb2Node) text() string {
+	var sb strings.Builder
+	var walk func(*fb2Node)
+	walk = func(n *fb2Node) {
+		if n.IsText {
+			sb.WriteString(n.Text)
+			return
+		}
+		for _, c := range n.Children {
+			walk(c)
+			if c.Name == "p" || c.Name == "v" {
+				sb.WriteByte(' ')
+			}
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// href returns the target of an l:href or xlink:href attribute
+func (n *fb2Node) href() string {
+	return strings.TrimPrefix(n.Attrs["href"], "#")
+}
+
+func parseFB2(in io.ReaderAt, size int64) (*fb2Node, error) {
+	if size > maxTextSize {
+		return nil, fmt.Errorf("convert: FB2 file too large (%d bytes)", size)
+	}
+
+	dec := xml.NewDecoder(io.NewSectionReader(in, 0, size))
+	dec.Strict = false
+	dec.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(input), nil
+	}
+
+	root := &fb2Node{Name: "#document"}
+	stack := []*fb2Node{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("convert: invalid FB2: %w", err)
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &fb2Node{Name: t.Name.Local, Attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				node.Attrs[a.Name.Local] = a.Value
+			}
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.Children = append(parent.Children, &fb2Node{IsText: true, Text: string(t)})
+		}
+	}
+
+	book := root.child("FictionBook")
+	if book == nil {
+		return nil, errors.New("convert: not a FictionBook document")
+	}
+	return book, nil
+}
+
+// fb2ToEPUB renders each top level section of the main body as a chapter,
+// with notes bodies appended at the end
+func fb2ToEPUB(ctx context.Context, in io.ReaderAt, size int64, out io.Writer, info Info) error {
+	doc, err := parseFB2(in, size)
+	if err != nil {
+		return err
+	}
+
+	book := &epubBook{Info: info}
+	r := &fb2Renderer{images: make(map[string]string)}
+
+	// Images first, so the renderer knows which references it can resolve
+	for _, bin := range doc.childrenNamed("binary") {
+		id := bin.Attrs["id"]
+		mediaType := bin.Attrs["content-type"]
+		if id == "" || !strings.HasPrefix(mediaType, "image/") {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(bin.text()), ""))
+		if err != nil {
+			continue
+		}
+		href := path.Join("images", fmt.Sprintf("img%d%s", len(book.Images)+1, imageExt(mediaType)))
+		book.Images = append(book.Images, resource{
+			ID:        fmt.Sprintf("img%d", len(book.Images)+1),
+			Href:      href,
+			MediaType: mediaType,
+			Data:      data,
+		})
+		r.images[id] = book.Images[len(book.Images)-1].ID
+		r.hrefs = append(r.hrefs, href)
+	}
+
+	if titleInfo := fb2TitleInfo(doc); titleInfo != nil {
+		if book.Info.Title == "" {
+			if title := titleInfo.child("book-title"); title != nil {
+				book.Info.Title = title.text()
+			}
+		}
+		if book.Info.Authors == "" {
+			var authors []string
+			for _, author := range titleInfo.childrenNamed("author") {
+				var parts []string
+				for _, field := range []string{"first-name", "middle-name", "last-name"} {
+					if f := author.child(field); f != nil && f.text() != "" {
+						parts = append(parts, f.text())
+					}
+				}
+				if len(parts) == 0 {
+					if nick := author.child("nickname"); nick != nil {
+						parts = append(parts, nick.text())
+					}
+				}
+				if len(parts) > 0 {
+					authors = append(authors, strings.Join(parts, " "))
+				}
+			}
+			book.Info.Authors = strings.Join(authors, ", ")
+		}
+		if book.Info.Language == "" {
+			if lang := titleInfo.child("lang"); lang != nil {
+				book.Info.Language = lang.text()
+			}
+		}
+		if cover := titleInfo.child("coverpage"); cover != nil {
+			if img := cover.child("image"); img != nil {
+				book.CoverID = r.images[img.href()]
+			}
+		}
+	}
+	if book.Info.Title == "" {
+		book.Info.Title = "Untitled"
+	}
+
+	for _, body := range doc.childrenNamed("body") {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if body.Attrs["name"] != "" {
+			// Notes and comments go in one chapter of their own
+			title := "Notes"
+			if t := body.child("title"); t != nil && t.text() != "" {
+				title = t.text()
+			}
+			book.Chapters = append(book.Chapters, chapter{Title: title, Body: r.render(body, 1)})
+			continue
+		}
+
+		var intro []*fb2Node
+		for _, c := range body.Children {
+			if c.Name != "section" {
+				intro = append(intro, c)
+			}
+		}
+		if len(intro) > 0 {
+			content := r.renderAll(intro, 1)
+			if strings.TrimSpace(content) != "" {
+				book.Chapters = append(book.Chapters, chapter{Title: book.Info.Title, Body: content})
+			}
+		}
+		for i, section := range body.childrenNamed("section") {
+			title := fmt.Sprintf("Chapter %d", i+1)
+			if t := section.child("title"); t != nil && t.text() != "" {
+				title = t.text()
+			}
+			book.Chapters = append(book.Chapters, chapter{Title: title, Body: r.render(section, 2)})
+		}
+	}
+
+	if len(book.Chapters) == 0 {
+		return errors.New("convert: FB2 has no content")
+	}
+	return book.write(out)
+}
+
+// fb2ToText converts through EPUB, which already knows how to flatten markup
+func fb2ToText(ctx context.Context, in io.ReaderAt, size int64, out io.Writer, info Info) error {
+	var epub bytes.Buffer
+	if err := fb2ToEPUB(ctx, in, size, &epub, info); err != nil {
+		return err
+	}
+	return epubToText(ctx, bytes.NewReader(epub.Bytes()), int64(epub.Len()), out, info)
+}
+
+func fb2TitleInfo(doc *fb2Node) *fb2Node {
+	if desc := doc.child("description"); desc != nil {
+		return desc.child("title-info")
+	}
+	return nil
+}
+
+// fb2Renderer turns FB2 elements into XHTML
+type fb2Renderer struct {
+	images map[string]string // FB2 binary id to EPUB image id
+	hrefs  []string
+}
+
+func (r *fb2Renderer) imageHref(id string) string {
+	epubID, ok := r.images[id]
+	if !ok {
+		return ""
+	}
+	var n int
+	fmt.Sscanf(epubID, "img%d", &n)
+	if n < 1 || n > len(r.hrefs) {
+		return ""
+	}
+	return r.hrefs[n-1]
+}
+
+func (r *fb2Renderer) renderAll(nodes []*fb2Node, depth int) string {
+	var sb strings.Builder
+	for _, n := range nodes {
+		r.block(&sb, n, depth)
+	}
+	return sb.String()
+}
+
+func (r *fb2Renderer) render(n *fb2Node, depth int) string {
+	return r.renderAll(n.Children, depth)
+}
+
+// block renders block level elements
+func (r *fb2Renderer) block(sb *strings.Builder, n *fb2Node, depth int) {
+	if n.IsText {
+		if text := strings.TrimSpace(n.Text); text != "" {
+			sb.WriteString("<p>" + esc(text) + "</p>\n")
+		}
+		return
+	}
+
+	switch n.Name {
+	case "p":
+		sb.WriteString("<p>" + r.inline(n) + "</p>\n")
+	case "title":
+		level := min(depth, 6)
+		var lines []string
+		for _, p := range n.childrenNamed("p") {
+			lines = append(lines, r.inline(p))
+		}
+		if len(lines) == 0 {
+			lines = append(lines, esc(n.text()))
+		}
+		fmt.Fprintf(sb, "<h%d>%s</h%d>\n", level, strings.Join(lines, "<br/>"), level)
+	case "subtitle":
+		fmt.Fprintf(sb, "<h%d>%s</h%d>\n", min(depth+1, 6), r.inline(n), min(depth+1, 6))
+	case "empty-line":
+		sb.WriteString("<p>&#160;</p>\n")
+	case "image":
+		if href := r.imageHref(n.href()); href != "" {
+			sb.WriteString(`<div><img src="` + esc(href) + `" alt=""/></div>` + "\n")
+		}
+	case "section":
+		sb.WriteString("<div>\n")
+		for _, c := range n.Children {
+			r.block(sb, c, depth+1)
+		}
+		sb.WriteString("</div>\n")
+	case "epigraph", "cite", "annotation":
+		sb.WriteString("<blockquote>\n")
+		for _, c := range n.Children {
+			r.block(sb, c, depth)
+		}
+		sb.WriteString("</blockquote>\n")
+	case "poem":
+		sb.WriteString(`<div class="poem">` + "\n")
+		for _, c := range n.Children {
+			r.block(sb, c, depth)
+		}
+		sb.WriteString("</div>\n")
+	case "stanza":
+		var lines []string
+		for _, v := range n.childrenNamed("v") {
+			lines = append(lines, r.inline(v))
+		}
+		sb.WriteString("<p>" + strings.Join(lines, "<br/>") + "</p>\n")
+	case "text-author", "date":
+		sb.WriteString("<p><em>" + r.inline(n) + "</em></p>\n")
+	case "table":
+		for _, row := range n.childrenNamed("tr") {
+			var cells []string
+			for _, cell := range row.Children {
+				if !cell.IsText {
+					cells = append(cells, r.inline(cell))
+				}
+			}
+			sb.WriteString("<p>" + strings.Join(cells, " | ") + "</p>\n")
+		}
+	default:
+		for _, c := range n.Children {
+			r.block(sb, c, depth)
+		}
+	}
+}
+
+// inline renders the contents of a paragraph
+func (r *fb2Renderer) inline(n *fb2Node) string {
+	var sb strings.Builder
+	for _, c := range n.Children {
+		if c.IsText {
+			sb.WriteString(esc(c.Text))
+			continue
+		}
+		var tag string
+		switch c.Name {
+		case "emphasis":
+			tag = "em"
+		case "strong":
+			tag = "strong"
+		case "strikethrough":
+			tag = "del"
+		case "sub", "sup", "code":
+			tag = c.Name
+		case "image":
+			if href := r.imageHref(c.href()); href != "" {
+				sb.WriteString(`<img src="` + esc(href) + `" alt=""/>`)
+			}
+			continue
+		}
+		if tag == "" {
+			sb.WriteString(r.inline(c))
+			continue
+		}
+		sb.WriteString("<" + tag + ">" + r.inline(c) + "</" + tag + ">")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func imageExt(mediaType string) string {
+	switch mediaType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
@@ -0,0 +1,113 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akramboussanni/marchive/internal/bookmeta"
+)
+
+func TestFB2ToEPUB(t *testing.T) {
+	epub := convertBytes(t, "fb2", "epub", readFixture(t, "dune.fb2"), Info{Hash: "0123456789abcdef0123456789abcdef"})
+
+	// The intro before the first section gets the book's title, untitled
+	// sections are numbered and the notes body comes last
+	if got, want := epubChapters(t, epub), []string{"Dune", "Book One Dune", "Chapter 2", "Notes"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chapters = %q, want %q", got, want)
+	}
+
+	meta, err := bookmeta.Extract(bytes.NewReader(epub), int64(len(epub)), "epub")
+	if err != nil {
+		t.Fatalf("read EPUB metadata: %v", err)
+	}
+	if meta.Title != "Dune" {
+		t.Errorf("title = %q, want Dune", meta.Title)
+	}
+	if want := []string{"Frank Herbert", "The Editor"}; !reflect.DeepEqual(meta.Authors, want) {
+		t.Errorf("authors = %q, want %q", meta.Authors, want)
+	}
+	if meta.Language != "en" {
+		t.Errorf("language = %q, want en", meta.Language)
+	}
+	if meta.Cover == nil {
+		t.Fatal("cover missing")
+	}
+	if want := "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDRcover"; meta.Cover.MediaType != "image/png" || string(meta.Cover.Data) != want {
+		t.Errorf("cover = %s %q, want image/png %q", meta.Cover.MediaType, meta.Cover.Data, want)
+	}
+}
+
+func TestFB2ToText(t *testing.T) {
+	text := string(convertBytes(t, "fb2", "txt", readFixture(t, "dune.fb2"), Info{Title: "Dune", Authors: "Frank Herbert"}))
+	want := strings.Join([]string{
+		"Dune",
+		"Frank Herbert",
+		"A beginning is the time for taking the most delicate care.",
+		"Princess Irulan",
+		"Book One\nDune",
+		"In the week before their departure to Arrakis.",
+		"Fear is the mind-killer.[1]",
+		"A section without a title.",
+		"First line\nSecond line",
+		"1",
+		"The litany against fear.",
+	}, "\n\n") + "\n"
+	if text != want {
+		t.Errorf("text:\n%s\nwant:\n%s", text, want)
+	}
+}
+
+func TestFB2InfoOverrides(t *testing.T) {
+	info := Info{Title: "Dune (Anniversary Edition)", Authors: "F. Herbert", Language: "fr"}
+	epub := convertBytes(t, "fb2", "epub", readFixture(t, "dune.fb2"), info)
+
+	meta, err := bookmeta.Extract(bytes.NewReader(epub), int64(len(epub)), "epub")
+	if err != nil {
+		t.Fatalf("read EPUB metadata: %v", err)
+	}
+	if meta.Title != info.Title || meta.AuthorList() != info.Authors || meta.Language != info.Language {
+		t.Errorf("metadata = %q by %q in %q, want %q by %q in %q",
+			meta.Title, meta.AuthorList(), meta.Language, info.Title, info.Authors, info.Language)
+	}
+}
+
+func TestFB2Encoding(t *testing.T) {
+	// "Дюна" in Windows-1251
+	doc := "<?xml version=\"1.0\" encoding=\"windows-1251\"?>\n" +
+		"<FictionBook><description><title-info><book-title>\xc4\xfe\xed\xe0</book-title></title-info></description>" +
+		"<body><section><p>\xc4\xfe\xed\xe0</p></section></body></FictionBook>"
+
+	text := string(convertBytes(t, "fb2", "txt", []byte(doc), Info{}))
+	if want := "Дюна\n"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	epub := convertBytes(t, "fb2", "epub", []byte(doc), Info{})
+	if got := epubChapters(t, epub); !reflect.DeepEqual(got, []string{"Chapter 1"}) {
+		t.Errorf("chapters = %q, want [Chapter 1]", got)
+	}
+}
+
+func TestFB2Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"not xml", "plain text"},
+		{"not fictionbook", "<html><body><p>Dune</p></body></html>"},
+		{"no content", "<FictionBook><description/></FictionBook>"},
+		{"unknown charset", `<?xml version="1.0" encoding="x-unknown"?><FictionBook/>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Convert(context.Background(), "fb2", "epub", strings.NewReader(tt.doc), int64(len(tt.doc)), &out, Info{})
+			if err == nil {
+				t.Error("Convert succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package convert
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Plain text input is capped so a stray huge file can't exhaust memory
+const maxTextSize = 64 << 20
+
+// Chapters of converted plain text are split once they pass this size
+const maxChapterSize = 200 << 10
+
+type opfSpine struct {
+	Manifest []struct {
+		ID   string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"manifest>item"`
+	Itemrefs []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+type epubRootfiles struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubToText writes the text of every document in the EPUB's reading
+// order, one paragraph per line with blank lines between
+func epubToText(ctx context.Context, in io.ReaderAt, size int64, out io.Writer, info Info) error {
+	zr, err := zip.NewReader(in, size)
+	if err != nil {
+		return fmt.Errorf("convert: not a valid EPUB: %w", err)
+	}
+
+	var container epubRootfiles
+	if err := unmarshalZipXML(zr, "META-INF/container.xml", &container); err != nil {
+		return err
+	}
+	if len(container.Rootfiles) == 0 {
+		return errors.New("convert: EPUB has no package document")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var spine opfSpine
+	if err := unmarshalZipXML(zr, opfPath, &spine); err != nil {
+		return err
+	}
+
+	hrefs := make(map[string]string, len(spine.Manifest))
+	for _, item := range spine.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+
+	w := bufio.NewWriter(out)
+	tw := &textWriter{w: w}
+	if info.Title != "" {
+		tw.paragraph(info.Title)
+		if info.Authors != "" {
+			tw.paragraph(info.Authors)
+		}
+	}
+
+	// Documents are decompressed, so their total is capped like plain text
+	// input; a small EPUB could otherwise inflate into gigabytes of markup
+	budget := int64(maxTextSize)
+
+	for _, ref := range spine.Itemrefs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+
+		f := findZipFile(zr, path.Join(path.Dir(opfPath), href))
+		if f == nil {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		lr := &io.LimitedReader{R: rc, N: budget + 1}
+		doc, err := html.Parse(lr)
+		rc.Close()
+		if budget -= budget + 1 - lr.N; budget < 0 {
+			return fmt.Errorf("convert: EPUB text larger than %d bytes", maxTextSize)
+		}
+		if err != nil {
+			continue
+		}
+		tw.node(doc)
+		tw.flush()
+	}
+
+	if tw.err != nil {
+		return tw.err
+	}
+	return w.Flush()
+}
+
+// textWriter renders HTML as paragraphs of plain text
+type textWriter struct {
+	w       *bufio.Writer
+	current strings.Builder
+	wrote   bool
+	err     error
+}
+
+func (t *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		// Line breaks in markup are whitespace; <br> is the real one
+		t.current.WriteString(strings.ReplaceAll(n.Data, "\n", " "))
+		return
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Head, atom.Script, atom.Style:
+			return
+		case atom.Br:
+			t.current.WriteByte('\n')
+			return
+		case atom.Img:
+			if alt := attr(n, "alt"); alt != "" {
+				t.current.WriteString(alt)
+			}
+			return
+		}
+	}
+
+	block := n.Type == html.ElementNode && isBlock(n.DataAtom)
+	if block {
+		t.flush()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.node(c)
+	}
+	if block {
+		t.flush()
+	}
+}
+
+func (t *textWriter) flush() {
+	var lines []string
+	for _, line := range strings.Split(t.current.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	text := strings.Join(lines, "\n")
+	t.current.Reset()
+	if text != "" {
+		t.paragraph(text)
+	}
+}
+
+func (t *textWriter) paragraph(text string) {
+	if t.err != nil {
+		return
+	}
+	if t.wrote {
+		_, t.err = t.w.WriteString("\n")
+	}
+	if t.err == nil {
+		_, t.err = t.w.WriteString(text + "\n")
+	}
+	t.wrote = true
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Li, atom.Tr, atom.Blockquote, atom.Section, atom.Article, atom.Pre,
+		atom.Dt, atom.Dd, atom.Figcaption, atom.Hr, atom.Table, atom.Ul, atom.Ol:
+		return true
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func findZipFile(zr *zip.Reader, name string) *zip.File {
+	for _, f := range zr.File {
+		if f.Name == name || strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func unmarshalZipXML(zr *zip.Reader, name string, v any) error {
+	f := findZipFile(zr, name)
+	if f == nil {
+		return fmt.Errorf("convert: EPUB is missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(io.LimitReader(rc, 8<<20)).Decode(v); err != nil {
+		return fmt.Errorf("convert: failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// chapterHeading matches lines that start a new chapter in plain text. \b
+// only knows ASCII word characters, so the end of the word is spelled out.
+var chapterHeading = regexp.MustCompile(`(?i)^(chapter|part|book|prologue|epilogue|preface|introduction|glava|глава|часть)([^\p{L}\p{N}_].{0,79})?$|^[IVXLC]{1,7}\.?$|^\d{1,3}\.?$`)
+
+// textToEPUB turns plain text into an EPUB. Paragraphs are separated by
+// blank lines, or by line breaks when the text has no blank lines at all.
+// Lines that look like chapter headings start new chapters.
+func textToEPUB(ctx context.Context, in io.ReaderAt, size int64, out io.Writer, info Info) error {
+	if size > maxTextSize {
+		return fmt.Errorf("convert: text file too large (%d bytes)", size)
+	}
+	raw := make([]byte, size)
+	if _, err := in.ReadAt(raw, 0); err != nil && err != io.EOF {
+		return err
+	}
+
+	text := decodeText(raw)
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+
+	var paragraphs []string
+	if strings.Contains(text, "\n\n") {
+		for _, block := range strings.Split(text, "\n\n") {
+			if p := strings.Join(strings.Fields(block), " "); p != "" {
+				paragraphs = append(paragraphs, p)
+			}
+		}
+	} else {
+		for _, line := range strings.Split(text, "\n") {
+			if p := strings.TrimSpace(line); p != "" {
+				paragraphs = append(paragraphs, p)
+			}
+		}
+	}
+
+	book := &epubBook{Info: info}
+	if book.Info.Title == "" {
+		book.Info.Title = "Untitled"
+	}
+
+	current := chapter{Title: book.Info.Title}
+	heading := current.Title
+	var body strings.Builder
+	part := 1
+	finish := func() {
+		if body.Len() > 0 {
+			current.Body = body.String()
+			book.Chapters = append(book.Chapters, current)
+		}
+		body.Reset()
+	}
+
+	for _, p := range paragraphs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if chapterHeading.MatchString(p) {
+			finish()
+			current = chapter{Title: p}
+			heading, part = p, 1
+			body.WriteString("<h2>" + esc(p) + "</h2>\n")
+			continue
+		}
+		if body.Len() > maxChapterSize {
+			finish()
+			part++
+			current = chapter{Title: fmt.Sprintf("%s (%d)", heading, part)}
+		}
+		body.WriteString("<p>" + esc(p) + "</p>\n")
+	}
+	finish()
+
+	if len(book.Chapters) == 0 {
+		book.Chapters = []chapter{{Title: book.Info.Title, Body: "<p></p>"}}
+	}
+	return book.write(out)
+}
+
+// decodeText returns text as UTF-8, treating input that isn't valid UTF-8
+// as Windows-1252
+func decodeText(raw []byte) string {
+	raw = bytes.TrimPrefix(raw, []byte("\xEF\xBB\xBF"))
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	decoded, err := charmap.Windows1252.NewDecoder().Bytes(raw)
+	if err != nil {
+		return string(raw)
+	}
+	return string(decoded)
+}
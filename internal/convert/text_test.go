@@ -0,0 +1,237 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return data
+}
+
+func convertBytes(t *testing.T, from, to string, data []byte, info Info) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := Convert(context.Background(), from, to, bytes.NewReader(data), int64(len(data)), &out, info); err != nil {
+		t.Fatalf("convert %s to %s: %v", from, to, err)
+	}
+	return out.Bytes()
+}
+
+var xhtmlTitle = regexp.MustCompile(`<title>(.*?)</title>`)
+
+// epubChapters returns the title of every document in a generated EPUB's
+// spine, after checking the container is laid out as readers expect
+func epubChapters(t *testing.T, data []byte) []string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open EPUB: %v", err)
+	}
+	if len(zr.File) == 0 || zr.File[0].Name != "mimetype" || zr.File[0].Method != zip.Store {
+		t.Fatal("EPUB does not start with an uncompressed mimetype entry")
+	}
+
+	var container epubRootfiles
+	if err := unmarshalZipXML(zr, "META-INF/container.xml", &container); err != nil {
+		t.Fatal(err)
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	var spine opfSpine
+	if err := unmarshalZipXML(zr, opfPath, &spine); err != nil {
+		t.Fatal(err)
+	}
+
+	hrefs := make(map[string]string)
+	for _, item := range spine.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+	var titles []string
+	for _, ref := range spine.Itemrefs {
+		f := findZipFile(zr, path.Join(path.Dir(opfPath), hrefs[ref.IDRef]))
+		if f == nil {
+			t.Fatalf("spine item %s is missing", ref.IDRef)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		match := xhtmlTitle.FindSubmatch(doc)
+		if match == nil {
+			t.Fatalf("spine item %s has no title", ref.IDRef)
+		}
+		titles = append(titles, html.UnescapeString(string(match[1])))
+	}
+	return titles
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	info := Info{Hash: "0123456789abcdef0123456789abcdef", Title: "Dune", Authors: "Frank Herbert"}
+
+	epub := convertBytes(t, "txt", "epub", readFixture(t, "dune.txt"), info)
+	if got, want := epubChapters(t, epub), []string{"Dune", "Chapter 1", "II"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chapters = %q, want %q", got, want)
+	}
+
+	text := string(convertBytes(t, "epub", "txt", epub, info))
+	want := strings.Join([]string{
+		"Dune",
+		"Frank Herbert",
+		"A beginning is the time for taking the most delicate care that the balances are correct.",
+		"Chapter 1",
+		"In the week before their departure to Arrakis, when all the final scurrying about had reached a nearly unbearable frenzy, an old crone came to visit the mother of the boy, Paul.",
+		`"Fear is the mind-killer" & other sayings <litany>.`,
+		"II",
+		"Paul Muad'Dib — the Kwisatz Haderach.",
+	}, "\n\n") + "\n"
+	if text != want {
+		t.Errorf("round trip text:\n%s\nwant:\n%s", text, want)
+	}
+}
+
+func TestTextToEPUBChapters(t *testing.T) {
+	long := strings.Repeat(strings.Repeat("spice ", 1000)+"\n\n", 2*maxChapterSize/6000)
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"no headings", "One.\n\nTwo.", []string{"Dune"}},
+		{"empty", "", []string{"Dune"}},
+		{"leading heading", "Chapter One\n\nText.\n\nChapter Two\n\nMore.", []string{"Chapter One", "Chapter Two"}},
+		{"numbered", "Intro.\n\n1.\n\nText.\n\nXIV\n\nMore.", []string{"Dune", "1.", "XIV"}},
+		{"other languages", "Пролог.\n\nГлава 1\n\nТекст.\n\nЧасть вторая\n\nЕщё.", []string{"Dune", "Глава 1", "Часть вторая"}},
+		{"line per paragraph", "Opening line.\nPrologue\nA line.\nEpilogue\nThe end.", []string{"Dune", "Prologue", "Epilogue"}},
+		{"heading too long", "Chapter " + strings.Repeat("x", 90) + "\n\nText.", []string{"Dune"}},
+		{"heading inside a paragraph", "Text mentions\nchapter 2 here.\n\nMore.", []string{"Dune"}},
+		{"heading word prefix", "Chapters of my life\n\nText.", []string{"Dune"}},
+		{"long chapter", "Chapter 1\n\n" + long + "Chapter 2\n\nShort.", []string{"Chapter 1", "Chapter 1 (2)", "Chapter 2"}},
+		{"long text", long, []string{"Dune", "Dune (2)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			epub := convertBytes(t, "txt", "epub", []byte(tt.text), Info{Title: "Dune"})
+			if got := epubChapters(t, epub); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chapters = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextToEPUBWindows1252(t *testing.T) {
+	epub := convertBytes(t, "txt", "epub", []byte("Caf\xe9 \x93quoted\x94"), Info{})
+	text := string(convertBytes(t, "epub", "txt", epub, Info{}))
+	if want := "Café “quoted”\n"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	if got := epubChapters(t, epub); !reflect.DeepEqual(got, []string{"Untitled"}) {
+		t.Errorf("chapters = %q, want the Untitled default", got)
+	}
+}
+
+// A few kilobytes of EPUB can inflate into far more markup than any book
+// has; the text extraction must give up instead of parsing all of it
+func TestEPUBToTextZipBomb(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name, content string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+
+	// Each document fits the budget on its own, together they do not
+	const documents = 5
+	chunk := strings.Repeat("spice ", 1<<16)
+	chunks := maxTextSize / documents / len(chunk)
+
+	write("META-INF/container.xml", containerXML)
+	var manifest, itemrefs strings.Builder
+	for i := range documents {
+		fmt.Fprintf(&manifest, `<item id="c%d" href="c%d.xhtml"/>`, i, i)
+		fmt.Fprintf(&itemrefs, `<itemref idref="c%d"/>`, i)
+	}
+	write("OEBPS/content.opf", `<package><manifest>`+manifest.String()+`</manifest><spine>`+itemrefs.String()+`</spine></package>`)
+	for i := range documents {
+		w, err := zw.Create(fmt.Sprintf("OEBPS/c%d.xhtml", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range chunks + 1 {
+			io.WriteString(w, chunk)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := Convert(context.Background(), "epub", "txt", bytes.NewReader(buf.Bytes()), int64(buf.Len()), &out, Info{})
+	want := fmt.Sprintf("convert: EPUB text larger than %d bytes", maxTextSize)
+	if err == nil || err.Error() != want {
+		t.Fatalf("error = %v, want %q", err, want)
+	}
+}
+
+func TestEPUBToTextInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a zip", []byte("plain text")},
+		{"no container", zipOf(t, map[string]string{"mimetype": "application/epub+zip"})},
+		{"no rootfile", zipOf(t, map[string]string{"META-INF/container.xml": "<container><rootfiles/></container>"})},
+		{"missing package", zipOf(t, map[string]string{"META-INF/container.xml": containerXML})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Convert(context.Background(), "epub", "txt", bytes.NewReader(tt.data), int64(len(tt.data)), &out, Info{}); err == nil {
+				t.Error("Convert succeeded, want an error")
+			}
+		})
+	}
+}
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -5,7 +5,6 @@ package db
 
 import (
 	"embed"
-	"io/fs"
 	"log"
 
 	"github.com/akramboussanni/marchive/internal/applog"
@@ -16,7 +15,7 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/postgres/*.sql
 var migrationsFS embed.FS
 
 var DB *sqlx.DB
@@ -40,12 +39,7 @@ func RunMigrations() {
 		log.Fatalf("failed to create postgres driver: %v", err)
 	}
 
-	migrationsSub, err := fs.Sub(migrationsFS, "migrations")
-	if err != nil {
-		log.Fatalf("failed to get migrations subdir: %v", err)
-	}
-
-	d, err := iofs.New(migrationsSub, ".")
+	d, err := iofs.New(newMigrationSource(migrationsFS, "postgres"), ".")
 	if err != nil {
 		log.Fatalf("failed to create iofs driver: %v", err)
 	}
@@ -5,7 +5,6 @@ package db
 
 import (
 	"embed"
-	"io/fs"
 	"log"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -16,7 +15,7 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/sqlite/*.sql
 var migrationsFS embed.FS
 
 var DB *sqlx.DB
@@ -46,12 +45,7 @@ func RunMigrations() {
 		log.Fatalf("failed to create sqlite driver: %v", err)
 	}
 
-	migrationsSub, err := fs.Sub(migrationsFS, "migrations")
-	if err != nil {
-		log.Fatalf("failed to get migrations subdir: %v", err)
-	}
-
-	d, err := iofs.New(migrationsSub, ".")
+	d, err := iofs.New(newMigrationSource(migrationsFS, "sqlite"), ".")
 	if err != nil {
 		log.Fatalf("failed to create iofs driver: %v", err)
 	}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// migrationSource serves the shared migrations together with those written
+// for one database. Migrations that need database-specific SQL, like
+// full-text search, live in a subdirectory named after the database and
+// take their own sequence numbers in the shared series. A file there with
+// the same name as a shared one replaces it for that database.
+type migrationSource struct {
+	fsys    fs.FS
+	dialect string
+}
+
+func newMigrationSource(fsys fs.FS, dialect string) migrationSource {
+	return migrationSource{fsys: fsys, dialect: dialect}
+}
+
+func (m migrationSource) Open(name string) (fs.File, error) {
+	if name != "." {
+		if f, err := m.fsys.Open(path.Join("migrations", m.dialect, name)); err == nil {
+			return f, nil
+		}
+	}
+	return m.fsys.Open(path.Join("migrations", name))
+}
+
+func (m migrationSource) ReadDir(name string) ([]fs.DirEntry, error) {
+	shared, err := fs.ReadDir(m.fsys, path.Join("migrations", name))
+	if err != nil {
+		return nil, err
+	}
+	specific, err := fs.ReadDir(m.fsys, path.Join("migrations", m.dialect, name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	replaced := make(map[string]bool, len(specific))
+	for _, entry := range specific {
+		replaced[entry.Name()] = true
+	}
+
+	var entries []fs.DirEntry
+	for _, entry := range specific {
+		if !entry.IsDir() {
+			entries = append(entries, entry)
+		}
+	}
+	for _, entry := range shared {
+		if !entry.IsDir() && !replaced[entry.Name()] {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
@@ -0,0 +1,4 @@
+-- Remove transfer progress columns from downloadjobs
+ALTER TABLE downloadjobs DROP COLUMN IF EXISTS bytes_per_second;
+ALTER TABLE downloadjobs DROP COLUMN IF EXISTS total_bytes;
+ALTER TABLE downloadjobs DROP COLUMN IF EXISTS downloaded_bytes;
@@ -0,0 +1,5 @@
+-- Track real transfer progress on download jobs
+-- Compatible with both SQLite and PostgreSQL
+ALTER TABLE downloadjobs ADD COLUMN downloaded_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE downloadjobs ADD COLUMN total_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE downloadjobs ADD COLUMN bytes_per_second BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Remove download retry tracking
+DROP TABLE IF EXISTS downloadjob_attempts;
+ALTER TABLE downloadjobs DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE downloadjobs DROP COLUMN IF EXISTS max_attempts;
+ALTER TABLE downloadjobs DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,19 @@
+-- Retry failed download jobs with backoff and keep a history of attempts
+-- Compatible with both SQLite and PostgreSQL
+ALTER TABLE downloadjobs ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE downloadjobs ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 5;
+ALTER TABLE downloadjobs ADD COLUMN next_attempt_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE downloadjob_attempts (
+    id BIGINT PRIMARY KEY,
+    job_id BIGINT NOT NULL,
+    attempt INTEGER NOT NULL,
+    error_msg TEXT NOT NULL DEFAULT '',
+    transient BOOLEAN NOT NULL DEFAULT false,
+    started_at BIGINT NOT NULL,
+    finished_at BIGINT NOT NULL,
+    FOREIGN KEY (job_id) REFERENCES downloadjobs(id) ON DELETE CASCADE
+);
+
+-- Indexes for downloadjob_attempts
+CREATE INDEX idx_downloadjob_attempts_job_id ON downloadjob_attempts(job_id);
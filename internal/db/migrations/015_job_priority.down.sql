@@ -0,0 +1,3 @@
+-- Remove download job priority
+DROP INDEX IF EXISTS idx_downloadjobs_queue;
+ALTER TABLE downloadjobs DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,5 @@
+-- Let admins prioritize download jobs
+-- Compatible with both SQLite and PostgreSQL
+ALTER TABLE downloadjobs ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_downloadjobs_queue ON downloadjobs(status, priority, created_at);
@@ -0,0 +1,2 @@
+-- Remove API key usage tracking
+DROP TABLE IF EXISTS api_key_usage;
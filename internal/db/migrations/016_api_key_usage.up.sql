@@ -0,0 +1,15 @@
+-- Track daily fast download usage per Anna API key
+-- Compatible with both SQLite and PostgreSQL
+CREATE TABLE api_key_usage (
+    key_id TEXT NOT NULL,
+    day TEXT NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0,
+    daily_quota INTEGER NOT NULL DEFAULT 0,
+    exhausted BOOLEAN NOT NULL DEFAULT false,
+    last_error TEXT NOT NULL DEFAULT '',
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (key_id, day)
+);
+
+-- Indexes for api_key_usage
+CREATE INDEX idx_api_key_usage_day ON api_key_usage(day);
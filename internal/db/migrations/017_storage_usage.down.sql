@@ -0,0 +1,5 @@
+-- Remove storage accounting columns
+DROP INDEX IF EXISTS idx_savedbooks_last_downloaded;
+ALTER TABLE savedbooks DROP COLUMN IF EXISTS last_downloaded_at;
+ALTER TABLE savedbooks DROP COLUMN IF EXISTS cover_size;
+ALTER TABLE savedbooks DROP COLUMN IF EXISTS file_size;
@@ -0,0 +1,7 @@
+-- Record stored file sizes and last download time for storage accounting and eviction
+-- Compatible with both SQLite and PostgreSQL
+ALTER TABLE savedbooks ADD COLUMN file_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE savedbooks ADD COLUMN cover_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE savedbooks ADD COLUMN last_downloaded_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_savedbooks_last_downloaded ON savedbooks(last_downloaded_at);
@@ -0,0 +1,3 @@
+-- Remove book ISBN and description
+ALTER TABLE savedbooks DROP COLUMN IF EXISTS description;
+ALTER TABLE savedbooks DROP COLUMN IF EXISTS isbn;
@@ -0,0 +1,4 @@
+-- Store the ISBN and description read from uploaded book files
+-- Compatible with both SQLite and PostgreSQL
+ALTER TABLE savedbooks ADD COLUMN isbn TEXT NOT NULL DEFAULT '';
+ALTER TABLE savedbooks ADD COLUMN description TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Remove OPDS feed tokens
+DROP TABLE IF EXISTS feed_tokens;
@@ -0,0 +1,9 @@
+-- Per-user tokens for OPDS feeds, for e-readers that can't log in
+-- Compatible with both SQLite and PostgreSQL
+CREATE TABLE feed_tokens (
+    user_id BIGINT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at BIGINT NOT NULL,
+    last_used_at BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Remove personal access tokens
+DROP TABLE IF EXISTS personal_tokens;
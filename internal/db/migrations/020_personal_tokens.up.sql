@@ -0,0 +1,17 @@
+-- Long-lived personal access tokens for scripts and other non-browser clients
+-- Compatible with both SQLite and PostgreSQL
+CREATE TABLE personal_tokens (
+    id BIGINT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_hint TEXT NOT NULL DEFAULT '',
+    scope TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    last_used_at BIGINT NOT NULL DEFAULT 0,
+    expires_at BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Indexes for personal_tokens
+CREATE INDEX idx_personal_tokens_user_id ON personal_tokens(user_id);
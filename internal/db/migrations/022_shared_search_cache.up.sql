@@ -0,0 +1,15 @@
+-- Share cached search results between users, keyed by the normalized query
+-- Compatible with both SQLite and PostgreSQL
+DROP TABLE IF EXISTS search_cache;
+
+CREATE TABLE search_cache (
+    id BIGINT PRIMARY KEY,
+    query TEXT NOT NULL UNIQUE,
+    results TEXT NOT NULL, -- JSON encoded search results
+    total_results INTEGER NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL
+);
+
+-- Index for search cache cleanup
+CREATE INDEX idx_search_cache_expires_at ON search_cache(expires_at);
@@ -0,0 +1,3 @@
+-- Remove book language codes
+DROP INDEX IF EXISTS idx_savedbooks_language_code;
+ALTER TABLE savedbooks DROP COLUMN IF EXISTS language_code;
@@ -0,0 +1,4 @@
+-- Record each book's language as a code so filters match however it was written
+-- Compatible with both SQLite and PostgreSQL
+ALTER TABLE savedbooks ADD COLUMN language_code TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_savedbooks_language_code ON savedbooks(language_code);
@@ -0,0 +1,7 @@
+-- Remove full-text search over savedbooks
+DROP INDEX IF EXISTS idx_savedbooks_search;
+DROP TRIGGER IF EXISTS savedbooks_search_update ON savedbooks;
+DROP FUNCTION IF EXISTS savedbooks_search_update();
+ALTER TABLE savedbooks DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS savedbooks_search_vector(TEXT, TEXT, TEXT);
+DROP FUNCTION IF EXISTS marchive_fold(TEXT);
@@ -0,0 +1,45 @@
+-- Full-text search over savedbooks with weighted title, author and publisher
+-- PostgreSQL only; see migrations/sqlite for the FTS5 version
+
+-- Accent folding needs the unaccent extension, which managed databases may
+-- not allow. Search still works without it, only without folding.
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS unaccent;
+EXCEPTION WHEN OTHERS THEN
+    RAISE NOTICE 'unaccent extension unavailable, search will not fold accents';
+END $$;
+
+CREATE OR REPLACE FUNCTION marchive_fold(value TEXT) RETURNS TEXT AS $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'unaccent') THEN
+        RETURN unaccent(COALESCE(value, ''));
+    END IF;
+    RETURN COALESCE(value, '');
+END
+$$ LANGUAGE plpgsql STABLE;
+
+CREATE OR REPLACE FUNCTION savedbooks_search_vector(title TEXT, authors TEXT, publisher TEXT) RETURNS tsvector AS $$
+BEGIN
+    RETURN setweight(to_tsvector('simple', marchive_fold(title)), 'A')
+        || setweight(to_tsvector('simple', marchive_fold(authors)), 'B')
+        || setweight(to_tsvector('simple', marchive_fold(publisher)), 'C');
+END
+$$ LANGUAGE plpgsql STABLE;
+
+ALTER TABLE savedbooks ADD COLUMN search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION savedbooks_search_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := savedbooks_search_vector(NEW.title, NEW.authors, NEW.publisher);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER savedbooks_search_update
+    BEFORE INSERT OR UPDATE OF title, authors, publisher ON savedbooks
+    FOR EACH ROW EXECUTE FUNCTION savedbooks_search_update();
+
+UPDATE savedbooks SET search_vector = savedbooks_search_vector(title, authors, publisher);
+
+CREATE INDEX idx_savedbooks_search ON savedbooks USING GIN (search_vector);
@@ -0,0 +1,9 @@
+-- SQLite has no EXTRACT or :: casts, so the shared version can't run here
+CREATE TABLE app_settings (
+    key VARCHAR(255) PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at BIGINT NOT NULL DEFAULT (CAST(strftime('%s', 'now') AS INTEGER))
+);
+
+-- Insert default setting for anonymous access (disabled by default)
+INSERT INTO app_settings (key, value, updated_at) VALUES ('anonymous_access_enabled', 'false', CAST(strftime('%s', 'now') AS INTEGER));
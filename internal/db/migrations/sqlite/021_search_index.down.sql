@@ -0,0 +1,5 @@
+-- Remove full-text search over savedbooks
+DROP TRIGGER IF EXISTS savedbooks_fts_update;
+DROP TRIGGER IF EXISTS savedbooks_fts_delete;
+DROP TRIGGER IF EXISTS savedbooks_fts_insert;
+DROP TABLE IF EXISTS savedbooks_fts;
@@ -0,0 +1,29 @@
+-- Full-text search over savedbooks with weighted title, author and publisher
+-- SQLite only; see migrations/postgres for the tsvector version
+CREATE VIRTUAL TABLE savedbooks_fts USING fts5(
+    title,
+    authors,
+    publisher,
+    content='savedbooks',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER savedbooks_fts_insert AFTER INSERT ON savedbooks BEGIN
+    INSERT INTO savedbooks_fts(rowid, title, authors, publisher)
+    VALUES (new.id, new.title, new.authors, new.publisher);
+END;
+
+CREATE TRIGGER savedbooks_fts_delete AFTER DELETE ON savedbooks BEGIN
+    INSERT INTO savedbooks_fts(savedbooks_fts, rowid, title, authors, publisher)
+    VALUES ('delete', old.id, old.title, old.authors, old.publisher);
+END;
+
+CREATE TRIGGER savedbooks_fts_update AFTER UPDATE OF title, authors, publisher ON savedbooks BEGIN
+    INSERT INTO savedbooks_fts(savedbooks_fts, rowid, title, authors, publisher)
+    VALUES ('delete', old.id, old.title, old.authors, old.publisher);
+    INSERT INTO savedbooks_fts(rowid, title, authors, publisher)
+    VALUES (new.id, new.title, new.authors, new.publisher);
+END;
+
+INSERT INTO savedbooks_fts(savedbooks_fts) VALUES ('rebuild');
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/akramboussanni/marchive/internal/model"
+)
+
+// subscriberBuffer is how many events a slow subscriber can fall behind
+// before new ones are dropped for it
+const subscriberBuffer = 32
+
+// JobEvent is a snapshot of a download job after a status, progress or
+// error change
+type JobEvent struct {
+	JobID           int64  `json:"job_id,string"`
+	UserID          int64  `json:"-"`
+	BookHash        string `json:"book_hash"`
+	Status          string `json:"status"`
+	Progress        int    `json:"progress"`
+	ErrorMsg        string `json:"error_msg,omitempty"`
+	DownloadedBytes int64  `json:"downloaded_bytes"`
+	TotalBytes      int64  `json:"total_bytes"`
+	BytesPerSecond  int64  `json:"bytes_per_second"`
+	Attempts        int    `json:"attempts"`
+	MaxAttempts     int    `json:"max_attempts"`
+	NextAttemptAt   int64  `json:"next_attempt_at,omitempty,string"`
+}
+
+// NewJobEvent builds an event from the current state of a job
+func NewJobEvent(job *model.DownloadJob) JobEvent {
+	return JobEvent{
+		JobID:           job.ID,
+		UserID:          job.UserID,
+		BookHash:        job.BookHash,
+		Status:          job.Status,
+		Progress:        job.Progress,
+		ErrorMsg:        job.ErrorMsg,
+		DownloadedBytes: job.DownloadedBytes,
+		TotalBytes:      job.TotalBytes,
+		BytesPerSecond:  job.BytesPerSecond,
+		Attempts:        job.Attempts,
+		MaxAttempts:     job.MaxAttempts,
+		NextAttemptAt:   job.NextAttemptAt,
+	}
+}
+
+// Subscription receives the job events of one user
+type Subscription struct {
+	userID int64
+	Events chan JobEvent
+}
+
+// Hub fans job events out to the subscribers of the job's owner. Publishing
+// never blocks; a subscriber whose buffer is full misses the event.
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[int64]map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[int64]map[*Subscription]struct{})}
+}
+
+func (h *Hub) Subscribe(userID int64) *Subscription {
+	sub := &Subscription{userID: userID, Events: make(chan JobEvent, subscriberBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Streams opened while shutting down end straight away
+	if h.closed {
+		close(sub.Events)
+		return sub
+	}
+
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userSubs := h.subs[sub.userID]
+	if _, ok := userSubs[sub]; !ok {
+		return
+	}
+	delete(userSubs, sub)
+	if len(userSubs) == 0 {
+		delete(h.subs, sub.userID)
+	}
+	close(sub.Events)
+}
+
+func (h *Hub) Publish(event JobEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[event.UserID] {
+		select {
+		case sub.Events <- event:
+		default:
+		}
+	}
+}
+
+// Close ends every subscription so open streams return, and ends any made
+// afterwards straight away. It's called when the server shuts down, which
+// otherwise waits on streams that never finish by themselves.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for userID, userSubs := range h.subs {
+		for sub := range userSubs {
+			close(sub.Events)
+		}
+		delete(h.subs, userID)
+	}
+}
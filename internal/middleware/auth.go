@@ -13,21 +13,27 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
-func AddAuth(r chi.Router, ur *repo.UserRepo, tr *repo.TokenRepo) {
+func AddAuth(r chi.Router, ur *repo.UserRepo, tr *repo.TokenRepo, ptr *repo.PersonalTokenRepo) {
 	r.Use(func(next http.Handler) http.Handler {
-		return JWTAuth(config.JwtSecretBytes, ur, tr, model.CredentialJwt)(next)
+		return JWTAuth(config.JwtSecretBytes, ur, tr, ptr, model.CredentialJwt)(next)
 	})
 }
 
-func AddOptionalAuth(r chi.Router, ur *repo.UserRepo, tr *repo.TokenRepo) {
+func AddOptionalAuth(r chi.Router, ur *repo.UserRepo, tr *repo.TokenRepo, ptr *repo.PersonalTokenRepo) {
 	r.Use(func(next http.Handler) http.Handler {
-		return OptionalJWTAuth(config.JwtSecretBytes, ur, tr, model.CredentialJwt)(next)
+		return OptionalJWTAuth(config.JwtSecretBytes, ur, tr, ptr, model.CredentialJwt)(next)
 	})
 }
 
-func OptionalJWTAuth(secret []byte, ur *repo.UserRepo, tr *repo.TokenRepo, expectedType model.JwtType) func(http.Handler) http.Handler {
+func OptionalJWTAuth(secret []byte, ur *repo.UserRepo, tr *repo.TokenRepo, ptr *repo.PersonalTokenRepo, expectedType model.JwtType) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// A personal token that was sent has to be valid
+			if raw, ok := bearerToken(r); ok {
+				servePersonalToken(w, r, next, raw, ur, ptr)
+				return
+			}
+
 			// Try to get session cookie, but don't fail if not present
 			sessionCookie, err := r.Cookie("session")
 			if err != nil {
@@ -73,9 +79,14 @@ func OptionalJWTAuth(secret []byte, ur *repo.UserRepo, tr *repo.TokenRepo, expec
 	}
 }
 
-func JWTAuth(secret []byte, ur *repo.UserRepo, tr *repo.TokenRepo, expectedType model.JwtType) func(http.Handler) http.Handler {
+func JWTAuth(secret []byte, ur *repo.UserRepo, tr *repo.TokenRepo, ptr *repo.PersonalTokenRepo, expectedType model.JwtType) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if raw, ok := bearerToken(r); ok {
+				servePersonalToken(w, r, next, raw, ur, ptr)
+				return
+			}
+
 			claims := GetClaimsFromCookie(w, r, secret, ur, tr)
 			if claims == nil {
 				return
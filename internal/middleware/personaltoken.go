@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/akramboussanni/marchive/internal/api"
+	"github.com/akramboussanni/marchive/internal/applog"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/akramboussanni/marchive/internal/utils"
+)
+
+var errInvalidPersonalToken = errors.New("invalid personal token")
+
+type contextKey string
+
+const (
+	readOnlyKey  contextKey = "read-only"
+	downloadsKey contextKey = "downloads"
+)
+
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// AuthenticatePersonalToken returns the user a raw personal token belongs to.
+// Tokens without the admin scope act as a regular user whatever the
+// account's role, so admin checks further down refuse them.
+func AuthenticatePersonalToken(ctx context.Context, raw string, ur *repo.UserRepo, ptr *repo.PersonalTokenRepo) (*model.User, *model.PersonalToken, error) {
+	if !strings.HasPrefix(raw, model.PersonalTokenPrefix) {
+		return nil, nil, errInvalidPersonalToken
+	}
+
+	hash, err := utils.HashRandomToken(strings.TrimPrefix(raw, model.PersonalTokenPrefix))
+	if err != nil {
+		return nil, nil, errInvalidPersonalToken
+	}
+
+	token, err := ptr.GetTokenByHash(ctx, hash)
+	if err != nil {
+		return nil, nil, errInvalidPersonalToken
+	}
+
+	user, err := ur.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token.Scope != model.TokenScopeAdmin && user.Role == "admin" {
+		user.Role = "user"
+	}
+
+	if err := ptr.TouchToken(ctx, token.ID); err != nil {
+		applog.Warn("Failed to record personal token use:", err)
+	}
+	return user, token, nil
+}
+
+// servePersonalToken authenticates a request that carries a bearer token
+func servePersonalToken(w http.ResponseWriter, r *http.Request, next http.Handler, raw string, ur *repo.UserRepo, ptr *repo.PersonalTokenRepo) {
+	user, token, err := AuthenticatePersonalToken(r.Context(), raw, ur, ptr)
+	if err != nil {
+		api.WriteInvalidCredentials(w)
+		return
+	}
+
+	if !scopeAllows(token.Scope, r) {
+		api.WriteMessage(w, http.StatusForbidden, "error", "token scope does not allow this request")
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), utils.UserKey, user)
+	ctx = context.WithValue(ctx, utils.TokenScopeKey, token.Scope)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// scopeAllows reports whether a token with scope may make the request.
+// Read tokens are limited to safe methods and routes marked ReadOnly, short
+// of routes marked Downloads; download tokens may also use those.
+func scopeAllows(scope string, r *http.Request) bool {
+	downloads, _ := r.Context().Value(downloadsKey).(bool)
+
+	switch scope {
+	case model.TokenScopeAdmin:
+		return true
+	case model.TokenScopeDownload:
+		return downloads || readOnlyRequest(r)
+	case model.TokenScopeRead:
+		return !downloads && readOnlyRequest(r)
+	}
+	return false
+}
+
+func readOnlyRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	readOnly, _ := r.Context().Value(readOnlyKey).(bool)
+	return readOnly
+}
+
+// ReadOnly marks routes that change nothing even though they aren't GETs,
+// like search, so read-only tokens can use them. Add it before the auth
+// middleware.
+func ReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), readOnlyKey, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Downloads marks routes that hand out or request book files, which need a
+// download token. Add it before the auth middleware.
+func Downloads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), downloadsKey, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SessionOnly refuses requests authenticated with a personal token, for
+// routes like token management that need the user to be logged in
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := utils.TokenScopeFromContext(r.Context()); ok {
+			api.WriteMessage(w, http.StatusForbidden, "error", "this endpoint requires logging in")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,13 @@
+package model
+
+// APIKeyUsage is how many fast downloads an Anna API key used on a day.
+// Keys are stored by ID, never in the clear.
+type APIKeyUsage struct {
+	KeyID      string `db:"key_id" json:"key_id"`
+	Day        string `db:"day" json:"day"`
+	Used       int    `db:"used" json:"used"`
+	DailyQuota int    `db:"daily_quota" json:"daily_quota"`
+	Exhausted  bool   `db:"exhausted" json:"exhausted"`
+	LastError  string `db:"last_error" json:"last_error"`
+	UpdatedAt  int64  `db:"updated_at" json:"updated_at"`
+}
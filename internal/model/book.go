@@ -7,6 +7,8 @@ type SavedBook struct {
 	Authors          string `db:"authors" safe:"true" json:"authors"`
 	Publisher        string `db:"publisher" safe:"true" json:"publisher"`
 	Language         string `db:"language" safe:"true" json:"language"`
+	// Language as an ISO 639-1 code where known, for filtering
+	LanguageCode     string `db:"language_code" safe:"true" json:"language_code"`
 	Format           string `db:"format" safe:"true" json:"format"`
 	Size             string `db:"size" safe:"true" json:"size"`
 	CoverURL         string `db:"cover_url" safe:"true" json:"cover_url"`
@@ -21,6 +23,13 @@ type SavedBook struct {
 	OriginalFilename string `db:"original_filename" safe:"true" json:"original_filename,omitempty"`
 	CreatedAt        int64  `db:"created_at" safe:"true" json:"created_at,string"`
 	UpdatedAt        int64  `db:"updated_at" safe:"true" json:"updated_at,string"`
+	// Storage accounting, sizes in bytes
+	FileSize         int64 `db:"file_size" safe:"true" json:"file_size"`
+	CoverSize        int64 `db:"cover_size" safe:"true" json:"cover_size"`
+	LastDownloadedAt int64 `db:"last_downloaded_at" safe:"true" json:"last_downloaded_at,string"`
+	// Read from the file's embedded metadata
+	ISBN        string `db:"isbn" safe:"true" json:"isbn,omitempty"`
+	Description string `db:"description" safe:"true" json:"description,omitempty"`
 }
 
 
@@ -34,6 +43,27 @@ type DownloadJob struct {
 	FilePath  string `db:"file_path" json:"-"`
 	CreatedAt int64  `db:"created_at" safe:"true" json:"created_at,string"`
 	UpdatedAt int64  `db:"updated_at" safe:"true" json:"updated_at,string"`
+	// Transfer progress
+	DownloadedBytes int64 `db:"downloaded_bytes" safe:"true" json:"downloaded_bytes"`
+	TotalBytes      int64 `db:"total_bytes" safe:"true" json:"total_bytes"`
+	BytesPerSecond  int64 `db:"bytes_per_second" safe:"true" json:"bytes_per_second"`
+	// Retries
+	Attempts      int   `db:"attempts" safe:"true" json:"attempts"`
+	MaxAttempts   int   `db:"max_attempts" safe:"true" json:"max_attempts"`
+	NextAttemptAt int64 `db:"next_attempt_at" safe:"true" json:"next_attempt_at,string"`
+	// Queue order, higher runs first
+	Priority int `db:"priority" safe:"true" json:"priority"`
+}
+
+// DownloadJobAttempt records the outcome of one try at a download job
+type DownloadJobAttempt struct {
+	ID         int64  `db:"id" safe:"true" json:"id,string"`
+	JobID      int64  `db:"job_id" safe:"true" json:"job_id,string"`
+	Attempt    int    `db:"attempt" safe:"true" json:"attempt"`
+	ErrorMsg   string `db:"error_msg" safe:"true" json:"error_msg"`
+	Transient  bool   `db:"transient" safe:"true" json:"transient"`
+	StartedAt  int64  `db:"started_at" safe:"true" json:"started_at,string"`
+	FinishedAt int64  `db:"finished_at" safe:"true" json:"finished_at,string"`
 }
 
 type DownloadJobWithMetadata struct {
@@ -46,6 +76,16 @@ type DownloadJobWithMetadata struct {
 	FilePath  string `db:"file_path" json:"-"`
 	CreatedAt int64  `db:"created_at" safe:"true" json:"created_at,string"`
 	UpdatedAt int64  `db:"updated_at" safe:"true" json:"updated_at,string"`
+	// Transfer progress
+	DownloadedBytes int64 `db:"downloaded_bytes" safe:"true" json:"downloaded_bytes"`
+	TotalBytes      int64 `db:"total_bytes" safe:"true" json:"total_bytes"`
+	BytesPerSecond  int64 `db:"bytes_per_second" safe:"true" json:"bytes_per_second"`
+	// Retries
+	Attempts      int   `db:"attempts" safe:"true" json:"attempts"`
+	MaxAttempts   int   `db:"max_attempts" safe:"true" json:"max_attempts"`
+	NextAttemptAt int64 `db:"next_attempt_at" safe:"true" json:"next_attempt_at,string"`
+	// Queue order, higher runs first
+	Priority int `db:"priority" safe:"true" json:"priority"`
 	// Book metadata
 	Title     string `db:"title" safe:"true" json:"title"`
 	Authors   string `db:"authors" safe:"true" json:"authors"`
@@ -61,9 +101,14 @@ const (
 	BookStatusProcessing = "processing"
 	BookStatusReady      = "ready"
 	BookStatusError      = "error"
+	// The file was removed to free space; requesting the book fetches it again
+	BookStatusEvicted = "evicted"
 
 	DownloadStatusPending     = "pending"
 	DownloadStatusDownloading = "downloading"
 	DownloadStatusCompleted   = "completed"
 	DownloadStatusFailed      = "failed"
+	DownloadStatusCancelled   = "cancelled"
+
+	DefaultDownloadMaxAttempts = 5
 )
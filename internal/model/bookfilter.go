@@ -0,0 +1,92 @@
+package model
+
+import "strings"
+
+const (
+	BookSourceUploaded = "uploaded"
+	BookSourceAnna     = "anna"
+
+	BookSortRelevance = "relevance"
+	BookSortRecent    = "recent"
+	BookSortPopular   = "popular"
+	BookSortTitle     = "title"
+)
+
+// BookFilter narrows a book listing. Zero fields don't filter.
+type BookFilter struct {
+	// Words to search for; listings without a query can't sort by relevance
+	Query string
+	// Matched by language code, see LanguageCode
+	Language    string
+	Format      string
+	Source      string
+	RequestedBy *int64
+	// Unix seconds, inclusive
+	CreatedAfter  int64
+	CreatedBefore int64
+	Sort          string
+}
+
+// Normalize lowercases the filter values, turns the language into its code
+// and fills in the default sort
+func (f *BookFilter) Normalize() {
+	f.Language = LanguageCode(f.Language)
+	f.Format = strings.ToLower(strings.TrimSpace(f.Format))
+	f.Source = strings.ToLower(strings.TrimSpace(f.Source))
+	f.Sort = strings.ToLower(strings.TrimSpace(f.Sort))
+
+	if f.Sort == "" || (f.Sort == BookSortRelevance && f.Query == "") {
+		if f.Query != "" {
+			f.Sort = BookSortRelevance
+		} else {
+			f.Sort = BookSortRecent
+		}
+	}
+}
+
+func ValidBookSource(source string) bool {
+	return source == "" || source == BookSourceUploaded || source == BookSourceAnna
+}
+
+func ValidBookSort(sort string) bool {
+	switch sort {
+	case BookSortRelevance, BookSortRecent, BookSortPopular, BookSortTitle:
+		return true
+	}
+	return false
+}
+
+// LocalOnly reports whether the filter can only match books saved here.
+// Results straight from Anna's Archive have no requester or date.
+func (f *BookFilter) LocalOnly() bool {
+	return f.Source == BookSourceUploaded || f.RequestedBy != nil || f.CreatedAfter > 0 || f.CreatedBefore > 0
+}
+
+// MatchesAnna reports whether a result from Anna's Archive with the given
+// language and format passes the filter
+func (f *BookFilter) MatchesAnna(language, format string) bool {
+	if f.LocalOnly() {
+		return false
+	}
+	if f.Language != "" && LanguageCode(language) != f.Language {
+		return false
+	}
+	if f.Format != "" && strings.ToLower(strings.TrimSpace(format)) != f.Format {
+		return false
+	}
+	return true
+}
+
+type FacetCount struct {
+	Value string `db:"value" json:"value"`
+	Count int    `db:"count" json:"count"`
+}
+
+// BookFacets counts the books for each value of a filter. Each facet applies
+// every other filter but its own, so the counts show what choosing another
+// value would return.
+type BookFacets struct {
+	Languages []FacetCount `json:"languages"`
+	Formats   []FacetCount `json:"formats"`
+	Sources   []FacetCount `json:"sources"`
+}
@@ -0,0 +1,10 @@
+package model
+
+// FeedToken lets a user's e-reader read the OPDS catalog without a session.
+// Only the hash of the token is stored.
+type FeedToken struct {
+	UserID     int64  `db:"user_id" json:"user_id,string"`
+	TokenHash  string `db:"token_hash" json:"-"`
+	CreatedAt  int64  `db:"created_at" json:"created_at,string"`
+	LastUsedAt int64  `db:"last_used_at" json:"last_used_at,string"`
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+var (
+	languageNamesOnce sync.Once
+	// English language names, lowercased, to their codes
+	languageNames map[string]string
+)
+
+// LanguageCode returns the ISO 639-1 code of a language however it was
+// written: as Anna's Archive lists it ("English [en]"), as a code or tag
+// ("en", "eng", "en-US") or by its English name ("English"). Books and
+// filters are matched on this code. Values that name no known language are
+// returned lowercased, so they still match themselves.
+func LanguageCode(lang string) string {
+	lang = strings.TrimSpace(lang)
+	if lang == "" {
+		return ""
+	}
+
+	if start, end := strings.LastIndex(lang, "["), strings.LastIndex(lang, "]"); start >= 0 && end > start {
+		if code := languageTagCode(lang[start+1 : end]); code != "" {
+			return code
+		}
+	}
+	if code := languageTagCode(lang); code != "" {
+		return code
+	}
+
+	languageNamesOnce.Do(loadLanguageNames)
+	lower := strings.ToLower(lang)
+	if code, ok := languageNames[lower]; ok {
+		return code
+	}
+	return lower
+}
+
+// ISOLanguageCode is LanguageCode for values that name a known language. It
+// returns "" for anything else, where LanguageCode would return the value.
+func ISOLanguageCode(lang string) string {
+	code := LanguageCode(lang)
+	if code == "" || languageTagCode(code) != code {
+		return ""
+	}
+	return code
+}
+
+// languageTagCode returns the base language of a BCP 47 tag or ISO 639
+// code, or "" when tag isn't one
+func languageTagCode(tag string) string {
+	t, err := language.Parse(strings.TrimSpace(tag))
+	if err != nil || t == language.Und {
+		return ""
+	}
+	base, confidence := t.Base()
+	if confidence != language.Exact {
+		return ""
+	}
+	return base.String()
+}
+
+func loadLanguageNames() {
+	names := display.English.Languages()
+	languageNames = make(map[string]string)
+	for _, tag := range display.Supported.Tags() {
+		base, _ := tag.Base()
+		if name := names.Name(base); name != "" {
+			languageNames[strings.ToLower(name)] = base.String()
+		}
+	}
+}
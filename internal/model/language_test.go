@@ -0,0 +1,81 @@
+package model
+
+import "testing"
+
+func TestLanguageCode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"  ", ""},
+		// As Anna's Archive lists languages
+		{"English [en]", "en"},
+		{"French [fr]", "fr"},
+		{"Chinese [zh-Hans]", "zh"},
+		// As read from book files or typed in
+		{"en", "en"},
+		{"EN", "en"},
+		{"en-US", "en"},
+		{"pt_BR", "pt"},
+		{"eng", "en"},
+		{"fre", "fr"},
+		{"deu", "de"},
+		{"English", "en"},
+		{"german", "de"},
+		{" Russian ", "ru"},
+		// Unknown languages still match themselves
+		{"Klingon", "klingon"},
+		{"Elvish [qya-x]", "elvish [qya-x]"},
+	}
+
+	for _, tt := range tests {
+		if got := LanguageCode(tt.in); got != tt.want {
+			t.Errorf("LanguageCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestISOLanguageCode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"English [en]", "en"},
+		{"eng", "en"},
+		{"German", "de"},
+		{"Klingon", ""},
+		{"Elvish [qya-x]", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ISOLanguageCode(tt.in); got != tt.want {
+			t.Errorf("ISOLanguageCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBookFilterLanguage(t *testing.T) {
+	tests := []struct {
+		filter string
+		// Languages of results from Anna's Archive
+		language string
+		want     bool
+	}{
+		{"en", "English [en]", true},
+		{"English", "English [en]", true},
+		{"eng", "English [en]", true},
+		{"en", "French [fr]", false},
+		{"fr", "", false},
+		{"", "French [fr]", true},
+	}
+
+	for _, tt := range tests {
+		f := BookFilter{Language: tt.filter}
+		f.Normalize()
+		if got := f.MatchesAnna(tt.language, "epub"); got != tt.want {
+			t.Errorf("filter %q matching %q = %v, want %v", tt.filter, tt.language, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package model
+
+// PersonalToken is a long-lived token a user creates for API clients that
+// can't hold the session cookie. Only the hash of the token is stored.
+type PersonalToken struct {
+	ID         int64  `db:"id" safe:"true" json:"id,string"`
+	UserID     int64  `db:"user_id" safe:"true" json:"user_id,string"`
+	Name       string `db:"name" safe:"true" json:"name"`
+	TokenHash  string `db:"token_hash" json:"-"`
+	TokenHint  string `db:"token_hint" safe:"true" json:"token_hint"`
+	Scope      string `db:"scope" safe:"true" json:"scope"`
+	CreatedAt  int64  `db:"created_at" safe:"true" json:"created_at,string"`
+	LastUsedAt int64  `db:"last_used_at" safe:"true" json:"last_used_at,string"`
+	// Zero for tokens that never expire
+	ExpiresAt int64 `db:"expires_at" safe:"true" json:"expires_at,string"`
+}
+
+// Personal token scopes, each allowing everything the previous one does
+const (
+	// TokenScopeRead allows browsing and searching, but not downloading
+	TokenScopeRead = "read"
+	// TokenScopeDownload also allows downloading book files and requesting
+	// downloads, and nothing else that changes anything
+	TokenScopeDownload = "download"
+	// TokenScopeAdmin allows everything the account can do, including admin
+	// endpoints for admin accounts
+	TokenScopeAdmin = "admin"
+
+	// PersonalTokenPrefix marks personal tokens so they are easy to spot
+	PersonalTokenPrefix = "mat_"
+)
+
+// ValidTokenScope reports whether scope is a known personal token scope
+func ValidTokenScope(scope string) bool {
+	switch scope {
+	case TokenScopeRead, TokenScopeDownload, TokenScopeAdmin:
+		return true
+	}
+	return false
+}
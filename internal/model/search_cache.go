@@ -2,12 +2,12 @@ package model
 
 import "github.com/akramboussanni/marchive/internal/anna"
 
-// SearchCache represents a cached search result
+// SearchCache represents a cached search result, shared by everyone who
+// makes the same search
 type SearchCache struct {
 	ID           int64  `db:"id" json:"id,string"`
-	UserID       int64  `db:"user_id" json:"user_id,string"`
-	Query        string `db:"query" json:"query"`
-	Results      string `db:"results" json:"-"` // JSON encoded
+	Query        string `db:"query" json:"query"` // Normalized
+	Results      string `db:"results" json:"-"`   // JSON encoded
 	TotalResults int    `db:"total_results" json:"total_results"`
 	CreatedAt    int64  `db:"created_at" json:"created_at"`
 	ExpiresAt    int64  `db:"expires_at" json:"expires_at"`
@@ -37,3 +37,13 @@ type Pagination struct {
 	Total   int  `json:"total"`
 	HasNext bool `json:"has_next"`
 }
+
+// SearchCacheStats reports how often searches were answered from the cache
+// since the server started
+type SearchCacheStats struct {
+	Entries    int     `json:"entries"`
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	HitRate    float64 `json:"hit_rate"`
+	TTLSeconds int64   `json:"ttl_seconds"`
+}
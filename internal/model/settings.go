@@ -10,4 +10,8 @@ type AppSetting struct {
 // Setting keys
 const (
 	SettingAnonymousAccessEnabled = "anonymous_access_enabled"
+
+	// Internal markers, not editable through the admin API
+	SettingFilePathsReconciled = "file_paths_reconciled"
+	SettingOutsideFilesMoved   = "outside_files_moved"
 )
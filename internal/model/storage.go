@@ -0,0 +1,18 @@
+package model
+
+// StorageUsage breaks down the bytes held in storage
+type StorageUsage struct {
+	BookBytes    int64 `db:"book_bytes" json:"book_bytes"`
+	UploadBytes  int64 `db:"upload_bytes" json:"upload_bytes"`
+	CoverBytes   int64 `db:"cover_bytes" json:"cover_bytes"`
+	StoredBooks  int   `db:"stored_books" json:"stored_books"`
+	EvictedBooks int   `db:"evicted_books" json:"evicted_books"`
+	// Cached conversions, which the database doesn't track
+	DerivedBytes int64 `db:"-" json:"derived_bytes"`
+	DerivedFiles int   `db:"-" json:"derived_files"`
+}
+
+// TotalBytes is everything counted against the storage cap
+func (u *StorageUsage) TotalBytes() int64 {
+	return u.BookBytes + u.UploadBytes + u.CoverBytes + u.DerivedBytes
+}
@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// APIKeyUsageRepo persists daily Anna API key usage. It implements
+// anna.KeyUsageStore.
+type APIKeyUsageRepo struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyUsageRepo(db *sqlx.DB) *APIKeyUsageRepo {
+	return &APIKeyUsageRepo{db: db}
+}
+
+func (r *APIKeyUsageRepo) LoadKeyUsage(ctx context.Context, day string) ([]anna.KeyUsage, error) {
+	var rows []model.APIKeyUsage
+	query := `SELECT key_id, day, used, daily_quota, exhausted, last_error, updated_at FROM api_key_usage WHERE day = $1`
+	if err := r.db.SelectContext(ctx, &rows, query, day); err != nil {
+		return nil, err
+	}
+
+	usage := make([]anna.KeyUsage, 0, len(rows))
+	for _, row := range rows {
+		usage = append(usage, anna.KeyUsage{
+			KeyID:      row.KeyID,
+			Used:       row.Used,
+			DailyQuota: row.DailyQuota,
+			Exhausted:  row.Exhausted,
+			LastError:  row.LastError,
+		})
+	}
+	return usage, nil
+}
+
+func (r *APIKeyUsageRepo) SaveKeyUsage(ctx context.Context, day string, usage anna.KeyUsage) error {
+	query := `
+		INSERT INTO api_key_usage (key_id, day, used, daily_quota, exhausted, last_error, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (key_id, day) DO UPDATE SET
+			used = $3, daily_quota = $4, exhausted = $5, last_error = $6, updated_at = $7
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		usage.KeyID, day, usage.Used, usage.DailyQuota, usage.Exhausted, usage.LastError, time.Now().Unix())
+	return err
+}
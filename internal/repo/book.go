@@ -8,6 +8,7 @@ import (
 
 	"github.com/akramboussanni/marchive/internal/anna"
 	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/search"
 	"github.com/akramboussanni/marchive/internal/utils"
 	"github.com/jmoiron/sqlx"
 )
@@ -27,6 +28,7 @@ func (r *BookRepo) CreateBook(ctx context.Context, book *model.SavedBook) error
 	book.ID = utils.GenerateSnowflakeID()
 	book.CreatedAt = time.Now().Unix()
 	book.UpdatedAt = time.Now().Unix()
+	book.LanguageCode = model.LanguageCode(book.Language)
 
 	query := fmt.Sprintf(
 		"INSERT INTO savedbooks (%s) VALUES (%s)",
@@ -60,7 +62,16 @@ func (r *BookRepo) GetBookByHashForUser(ctx context.Context, hash string, userID
 }
 
 func (r *BookRepo) IncrementDownloadCount(ctx context.Context, hash string) error {
-	query := `UPDATE savedbooks SET download_count = download_count + 1, updated_at = $1 WHERE hash = $2`
+	now := time.Now().Unix()
+	query := `UPDATE savedbooks SET download_count = download_count + 1, last_downloaded_at = $1, updated_at = $2 WHERE hash = $3`
+	_, err := r.db.ExecContext(ctx, query, now, now, hash)
+	return err
+}
+
+// TouchLastDownloaded records a read of the book's file without counting it
+// as a download
+func (r *BookRepo) TouchLastDownloaded(ctx context.Context, hash string) error {
+	query := `UPDATE savedbooks SET last_downloaded_at = $1 WHERE hash = $2`
 	_, err := r.db.ExecContext(ctx, query, time.Now().Unix(), hash)
 	return err
 }
@@ -77,94 +88,56 @@ func (r *BookRepo) UpdateBookStatus(ctx context.Context, hash, status, filePath
 	return err
 }
 
+// FailBook marks a book whose download failed for good. An evicted stub
+// stays evicted: its metadata is still good and it can be requested again.
+func (r *BookRepo) FailBook(ctx context.Context, hash string) error {
+	query := `UPDATE savedbooks SET status = $1, file_path = '', updated_at = $2 WHERE hash = $3 AND status != $4`
+	_, err := r.db.ExecContext(ctx, query, model.BookStatusError, time.Now().Unix(), hash, model.BookStatusEvicted)
+	return err
+}
+
 func (r *BookRepo) UpdateBookWithMetadata(ctx context.Context, hash, status, filePath string, book *anna.Book) error {
 	query := `UPDATE savedbooks SET 
 		title = $1, authors = $2, publisher = $3, language = $4, format = $5, size = $6,
-		cover_url = $7, cover_data = $8, status = $9, file_path = $10, updated_at = $11 
-		WHERE hash = $12`
+		cover_url = $7, cover_data = $8, status = $9, file_path = $10, updated_at = $11,
+		language_code = $12
+		WHERE hash = $13`
 	_, err := r.db.ExecContext(ctx, query,
 		book.Title, book.Authors, book.Publisher, book.Language, book.Format, book.Size,
-		book.CoverURL, book.CoverData, status, filePath, time.Now().Unix(), hash)
+		book.CoverURL, book.CoverData, status, filePath, time.Now().Unix(),
+		model.LanguageCode(book.Language), hash)
 	return err
 }
 
-func (r *BookRepo) GetBooks(ctx context.Context, limit, offset int) ([]model.SavedBook, error) {
-	var books []model.SavedBook
-	query := fmt.Sprintf(`
-		SELECT %s FROM savedbooks 
-		WHERE is_ghost = false
-		ORDER BY created_at DESC 
-		LIMIT $1 OFFSET $2
-	`, r.AllRaw)
-	err := r.db.SelectContext(ctx, &books, query, limit, offset)
-	return books, err
-}
-
-func (r *BookRepo) GetBooksForUser(ctx context.Context, userID int64, isAdmin bool, limit, offset int) ([]model.SavedBook, error) {
-	var books []model.SavedBook
-	var query string
-
-	if isAdmin {
-		// Admins see all books
-		query = fmt.Sprintf(`
-			SELECT %s FROM savedbooks 
-			ORDER BY created_at DESC 
-			LIMIT $1 OFFSET $2
-		`, r.AllRaw)
-		err := r.db.SelectContext(ctx, &books, query, limit, offset)
-		return books, err
+func (r *BookRepo) SearchBooksForUser(ctx context.Context, userID int64, isAdmin bool, searchQuery string, limit, offset int) ([]model.SavedBook, error) {
+	terms := search.Terms(searchQuery)
+	if len(terms) == 0 {
+		return nil, nil
 	}
 
-	// Regular users see only non-ghost books or their own ghost books
-	query = fmt.Sprintf(`
-		SELECT %s FROM savedbooks 
-		WHERE (is_ghost = false OR (is_ghost = true AND requested_by IS NOT NULL AND requested_by = $1))
-		ORDER BY created_at DESC 
-		LIMIT $2 OFFSET $3
-	`, r.AllRaw)
-	err := r.db.SelectContext(ctx, &books, query, userID, limit, offset)
-	return books, err
-}
-
-func (r *BookRepo) SearchBooks(ctx context.Context, searchQuery string, limit, offset int) ([]model.SavedBook, error) {
 	var books []model.SavedBook
-	query := fmt.Sprintf(`
-		SELECT %s FROM savedbooks 
-		WHERE (LOWER(title) LIKE LOWER($1) OR LOWER(authors) LIKE LOWER($1) OR LOWER(publisher) LIKE LOWER($1))
-		AND is_ghost = false
-		ORDER BY created_at DESC 
-		LIMIT $2 OFFSET $3
-	`, r.AllRaw)
-	searchPattern := "%" + searchQuery + "%"
-	err := r.db.SelectContext(ctx, &books, query, searchPattern, limit, offset)
-	return books, err
-}
-
-func (r *BookRepo) SearchBooksForUser(ctx context.Context, userID int64, isAdmin bool, searchQuery string, limit, offset int) ([]model.SavedBook, error) {
-	var books []model.SavedBook
-	searchPattern := "%" + searchQuery + "%"
 
 	if isAdmin {
 		// Admins see all books
 		query := fmt.Sprintf(`
-			SELECT %s FROM savedbooks 
-			WHERE LOWER(title) LIKE LOWER($1) OR LOWER(authors) LIKE LOWER($1) OR LOWER(publisher) LIKE LOWER($1)
-			ORDER BY created_at DESC 
+			SELECT %s FROM savedbooks
+			JOIN %s matches ON matches.match_id = savedbooks.id
+			ORDER BY matches.match_rank, created_at DESC
 			LIMIT $2 OFFSET $3
-		`, r.AllRaw)
-		err := r.db.SelectContext(ctx, &books, query, searchPattern, limit, offset)
+		`, r.AllRaw, searchMatches)
+		err := r.db.SelectContext(ctx, &books, query, matchQuery(terms), limit, offset)
 		return books, err
 	}
 
 	// Regular users see only non-ghost books or their own ghost books
 	query := fmt.Sprintf(`
-		SELECT %s FROM savedbooks 
-		WHERE (LOWER(title) LIKE LOWER($1) OR LOWER(authors) LIKE LOWER($1) OR LOWER(publisher) LIKE LOWER($1))
-		AND (is_ghost = false OR (is_ghost = true AND requested_by IS NOT NULL AND requested_by = $2))
-		ORDER BY created_at DESC 
+		SELECT %s FROM savedbooks
+		JOIN %s matches ON matches.match_id = savedbooks.id
+		WHERE (is_ghost = false OR (is_ghost = true AND requested_by IS NOT NULL AND requested_by = $2))
+		ORDER BY matches.match_rank, created_at DESC
 		LIMIT $3 OFFSET $4
-	`, r.AllRaw)
-	err := r.db.SelectContext(ctx, &books, query, searchPattern, userID, limit, offset)
+	`, r.AllRaw, searchMatches)
+	err := r.db.SelectContext(ctx, &books, query, matchQuery(terms), userID, limit, offset)
 	return books, err
 }
 
@@ -174,27 +147,6 @@ func (r *BookRepo) CountBooks(ctx context.Context) (int, error) {
 	return count, err
 }
 
-func (r *BookRepo) CountBooksForUser(ctx context.Context, userID int64, isAdmin bool) (int, error) {
-	var count int
-
-	if isAdmin {
-		err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM savedbooks")
-		return count, err
-	}
-
-	err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM savedbooks WHERE (is_ghost = false OR (is_ghost = true AND requested_by IS NOT NULL AND requested_by = $1))", userID)
-	return count, err
-}
-
-func (r *BookRepo) CountSearchBooks(ctx context.Context, searchQuery string) (int, error) {
-	var count int
-	searchPattern := "%" + searchQuery + "%"
-	err := r.db.GetContext(ctx, &count,
-		"SELECT COUNT(*) FROM savedbooks WHERE LOWER(title) LIKE LOWER($1) OR LOWER(authors) LIKE LOWER($1) OR LOWER(publisher) LIKE LOWER($1)",
-		searchPattern)
-	return count, err
-}
-
 func (r *BookRepo) GetBooksWithDownloadCount(ctx context.Context, limit, offset int) ([]model.SavedBook, error) {
 	// Select all columns from savedbooks, but override download_count with the actual count from downloadrequests
 	query := `
@@ -269,9 +221,19 @@ func (r *BookRepo) GetBooksAvailabilityByHashes(ctx context.Context, hashes []st
 	return results, nil
 }
 
+// DeleteFailedBooks removes books that last errored before cutoffTime,
+// except those with a download job still queued for a retry
 func (r *BookRepo) DeleteFailedBooks(ctx context.Context, cutoffTime int64) (int64, error) {
-	query := `DELETE FROM savedbooks WHERE status = $1 AND created_at < $2`
-	result, err := r.db.ExecContext(ctx, query, model.BookStatusError, cutoffTime)
+	query := `
+		DELETE FROM savedbooks
+		WHERE status = $1 AND updated_at < $2
+		AND NOT EXISTS (
+			SELECT 1 FROM downloadjobs
+			WHERE downloadjobs.book_hash = savedbooks.hash AND downloadjobs.status IN ($3, $4)
+		)
+	`
+	result, err := r.db.ExecContext(ctx, query, model.BookStatusError, cutoffTime,
+		model.DownloadStatusPending, model.DownloadStatusDownloading)
 	if err != nil {
 		return 0, err
 	}
@@ -303,6 +265,7 @@ func (r *BookRepo) CreateUploadedBook(ctx context.Context, book *model.SavedBook
 	book.UpdatedAt = time.Now().Unix()
 	book.IsUploaded = true
 	book.Status = model.BookStatusReady
+	book.LanguageCode = model.LanguageCode(book.Language)
 
 	query := fmt.Sprintf(
 		"INSERT INTO savedbooks (%s) VALUES (%s)",
@@ -369,3 +332,148 @@ func (r *BookRepo) BookExistsByFilePath(ctx context.Context, filePath string) (b
 	}
 	return count > 0, nil
 }
+
+// GetStoredBooks returns every ready book that has a file on disk
+func (r *BookRepo) GetStoredBooks(ctx context.Context) ([]model.SavedBook, error) {
+	var books []model.SavedBook
+	query := fmt.Sprintf(`
+		SELECT %s FROM savedbooks
+		WHERE status = $1 AND file_path != ''
+		ORDER BY created_at ASC
+	`, r.AllRaw)
+	err := r.db.SelectContext(ctx, &books, query, model.BookStatusReady)
+	return books, err
+}
+
+// UpdateFileSize records the stored size in bytes of a book's file
+func (r *BookRepo) UpdateFileSize(ctx context.Context, hash string, size int64) error {
+	query := `UPDATE savedbooks SET file_size = $1 WHERE hash = $2`
+	_, err := r.db.ExecContext(ctx, query, size, hash)
+	return err
+}
+
+// UpdateCoverSize records the stored size in bytes of a book's uploaded cover
+func (r *BookRepo) UpdateCoverSize(ctx context.Context, hash string, size int64) error {
+	query := `UPDATE savedbooks SET cover_size = $1 WHERE hash = $2`
+	_, err := r.db.ExecContext(ctx, query, size, hash)
+	return err
+}
+
+// GetBooksMissingSizes returns books with a stored file or cover whose size
+// has not been recorded
+func (r *BookRepo) GetBooksMissingSizes(ctx context.Context) ([]model.SavedBook, error) {
+	var books []model.SavedBook
+	query := fmt.Sprintf(`
+		SELECT %s FROM savedbooks
+		WHERE (status = $1 AND file_path != '' AND file_size = 0)
+		OR (cover_data != '' AND cover_size = 0)
+	`, r.AllRaw)
+	err := r.db.SelectContext(ctx, &books, query, model.BookStatusReady)
+	return books, err
+}
+
+// GetBooksMissingLanguageCodes returns books with a language saved before
+// language codes were recorded
+func (r *BookRepo) GetBooksMissingLanguageCodes(ctx context.Context) ([]model.SavedBook, error) {
+	var books []model.SavedBook
+	query := fmt.Sprintf(`SELECT %s FROM savedbooks WHERE language != '' AND language_code = ''`, r.AllRaw)
+	err := r.db.SelectContext(ctx, &books, query)
+	return books, err
+}
+
+func (r *BookRepo) UpdateLanguageCode(ctx context.Context, hash, code string) error {
+	query := `UPDATE savedbooks SET language_code = $1 WHERE hash = $2`
+	_, err := r.db.ExecContext(ctx, query, code, hash)
+	return err
+}
+
+// GetStorageUsage sums the bytes of every stored book file and cover
+func (r *BookRepo) GetStorageUsage(ctx context.Context) (*model.StorageUsage, error) {
+	var usage model.StorageUsage
+	query := `
+		SELECT
+			COALESCE(SUM(CASE WHEN status = $1 AND is_uploaded = false THEN file_size ELSE 0 END), 0) AS book_bytes,
+			COALESCE(SUM(CASE WHEN status = $1 AND is_uploaded = true THEN file_size ELSE 0 END), 0) AS upload_bytes,
+			COALESCE(SUM(cover_size), 0) AS cover_bytes,
+			COALESCE(SUM(CASE WHEN status = $1 AND file_path != '' THEN 1 ELSE 0 END), 0) AS stored_books,
+			COALESCE(SUM(CASE WHEN status = $2 THEN 1 ELSE 0 END), 0) AS evicted_books
+		FROM savedbooks
+	`
+	err := r.db.GetContext(ctx, &usage, query, model.BookStatusReady, model.BookStatusEvicted)
+	return &usage, err
+}
+
+// GetEvictionCandidates returns stored books that can be fetched again from
+// the source, in the order they should be evicted. Uploads are never
+// candidates, nor are books with a download in progress. With
+// leastDownloaded set, ghost books go first, then the least downloaded;
+// otherwise the least recently downloaded go first.
+func (r *BookRepo) GetEvictionCandidates(ctx context.Context, leastDownloaded bool, limit int) ([]model.SavedBook, error) {
+	order := "COALESCE(NULLIF(last_downloaded_at, 0), created_at) ASC"
+	if leastDownloaded {
+		order = "is_ghost DESC, download_count ASC, " + order
+	}
+
+	var books []model.SavedBook
+	query := fmt.Sprintf(`
+		SELECT %s FROM savedbooks
+		WHERE status = $1 AND file_path != '' AND is_uploaded = false
+		AND NOT EXISTS (
+			SELECT 1 FROM downloadjobs
+			WHERE downloadjobs.book_hash = savedbooks.hash AND downloadjobs.status IN ($2, $3)
+		)
+		ORDER BY %s
+		LIMIT $4
+	`, r.AllRaw, order)
+	err := r.db.SelectContext(ctx, &books, query, model.BookStatusReady,
+		model.DownloadStatusPending, model.DownloadStatusDownloading, limit)
+	return books, err
+}
+
+// EvictBook turns a stored book into a stub with no file. It only applies
+// while the book still points at filePath, so a concurrent re-download is
+// left alone.
+func (r *BookRepo) EvictBook(ctx context.Context, hash, filePath string) (bool, error) {
+	query := `
+		UPDATE savedbooks SET status = $1, file_path = '', file_size = 0, updated_at = $2
+		WHERE hash = $3 AND status = $4 AND file_path = $5
+	`
+	result, err := r.db.ExecContext(ctx, query, model.BookStatusEvicted, time.Now().Unix(), hash, model.BookStatusReady, filePath)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// GetReadyBooksForUser returns books with a file to download, newest first
+// or most downloaded first. Other users' ghost books are hidden from
+// non-admins.
+func (r *BookRepo) GetReadyBooksForUser(ctx context.Context, userID int64, isAdmin, popular bool, limit, offset int) ([]model.SavedBook, error) {
+	order := "created_at DESC"
+	if popular {
+		order = "download_count DESC, created_at DESC"
+	}
+
+	var books []model.SavedBook
+	query := fmt.Sprintf(`
+		SELECT %s FROM savedbooks
+		WHERE status = $1 AND file_path != ''
+		AND ($2 OR is_ghost = false OR requested_by = $3)
+		ORDER BY %s
+		LIMIT $4 OFFSET $5
+	`, r.AllRaw, order)
+	err := r.db.SelectContext(ctx, &books, query, model.BookStatusReady, isAdmin, userID, limit, offset)
+	return books, err
+}
+
+func (r *BookRepo) CountReadyBooksForUser(ctx context.Context, userID int64, isAdmin bool) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM savedbooks
+		WHERE status = $1 AND file_path != ''
+		AND ($2 OR is_ghost = false OR requested_by = $3)
+	`
+	err := r.db.GetContext(ctx, &count, query, model.BookStatusReady, isAdmin, userID)
+	return count, err
+}
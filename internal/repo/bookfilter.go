@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/search"
+)
+
+// facetLimit caps the values returned for one facet
+const facetLimit = 50
+
+const (
+	facetLanguage = "language"
+	facetFormat   = "format"
+	facetSource   = "source"
+)
+
+// bookQuery is the FROM and WHERE of a filtered book listing
+type bookQuery struct {
+	from   string
+	conds  []string
+	args   []any
+	search bool
+}
+
+func (q *bookQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *bookQuery) sql() string {
+	return q.from + " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+// filterQuery builds the query for the books userID may see that pass the
+// filter, leaving out the facet named by skip. ok is false when the search
+// has no words to look for and so matches nothing.
+func filterQuery(f model.BookFilter, userID int64, isAdmin bool, skip string) (q *bookQuery, ok bool) {
+	q = &bookQuery{from: "savedbooks"}
+
+	if f.Query != "" {
+		terms := search.Terms(f.Query)
+		if len(terms) == 0 {
+			return nil, false
+		}
+		// searchMatches reads the search from $1
+		q.arg(matchQuery(terms))
+		q.from = fmt.Sprintf("savedbooks JOIN %s matches ON matches.match_id = savedbooks.id", searchMatches)
+		q.search = true
+	}
+
+	// Other users' ghost books are hidden from non-admins
+	q.conds = append(q.conds, fmt.Sprintf("(%s OR is_ghost = false OR requested_by = %s)", q.arg(isAdmin), q.arg(userID)))
+
+	if f.Language != "" && skip != facetLanguage {
+		q.conds = append(q.conds, "language_code = "+q.arg(f.Language))
+	}
+	if f.Format != "" && skip != facetFormat {
+		q.conds = append(q.conds, "LOWER(TRIM(format)) = "+q.arg(f.Format))
+	}
+	if f.Source != "" && skip != facetSource {
+		q.conds = append(q.conds, "is_uploaded = "+q.arg(f.Source == model.BookSourceUploaded))
+	}
+	if f.RequestedBy != nil {
+		q.conds = append(q.conds, "requested_by = "+q.arg(*f.RequestedBy))
+	}
+	if f.CreatedAfter > 0 {
+		q.conds = append(q.conds, "created_at >= "+q.arg(f.CreatedAfter))
+	}
+	if f.CreatedBefore > 0 {
+		q.conds = append(q.conds, "created_at <= "+q.arg(f.CreatedBefore))
+	}
+
+	return q, true
+}
+
+func filterOrder(sort string, search bool) string {
+	switch sort {
+	case model.BookSortPopular:
+		return "download_count DESC, created_at DESC"
+	case model.BookSortTitle:
+		return "LOWER(title), created_at DESC"
+	case model.BookSortRelevance:
+		if search {
+			return "matches.match_rank, created_at DESC"
+		}
+	}
+	return "created_at DESC"
+}
+
+// FilterBooks returns the books userID may see that pass the filter, in the
+// filter's sort order. Anonymous callers pass a zero userID.
+func (r *BookRepo) FilterBooks(ctx context.Context, f model.BookFilter, userID int64, isAdmin bool, limit, offset int) ([]model.SavedBook, error) {
+	q, ok := filterQuery(f, userID, isAdmin, "")
+	if !ok {
+		return nil, nil
+	}
+
+	var books []model.SavedBook
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s
+		ORDER BY %s
+		LIMIT %s OFFSET %s
+	`, r.AllRaw, q.sql(), filterOrder(f.Sort, q.search), q.arg(limit), q.arg(offset))
+	err := r.db.SelectContext(ctx, &books, query, q.args...)
+	return books, err
+}
+
+func (r *BookRepo) CountFilteredBooks(ctx context.Context, f model.BookFilter, userID int64, isAdmin bool) (int, error) {
+	q, ok := filterQuery(f, userID, isAdmin, "")
+	if !ok {
+		return 0, nil
+	}
+
+	var count int
+	err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM "+q.sql(), q.args...)
+	return count, err
+}
+
+// GetBookFacets counts the books userID may see by language, format and
+// source
+func (r *BookRepo) GetBookFacets(ctx context.Context, f model.BookFilter, userID int64, isAdmin bool) (*model.BookFacets, error) {
+	facets := &model.BookFacets{}
+
+	var err error
+	facets.Languages, err = r.countValues(ctx, f, userID, isAdmin, facetLanguage, "language_code")
+	if err != nil {
+		return nil, err
+	}
+	facets.Formats, err = r.countValues(ctx, f, userID, isAdmin, facetFormat, "LOWER(TRIM(format))")
+	if err != nil {
+		return nil, err
+	}
+	sourceValue := fmt.Sprintf("CASE WHEN is_uploaded THEN '%s' ELSE '%s' END", model.BookSourceUploaded, model.BookSourceAnna)
+	facets.Sources, err = r.countValues(ctx, f, userID, isAdmin, facetSource, sourceValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+// countValues counts the filtered books for each value of expr, skipping
+// the filter on facet itself. Empty values aren't counted.
+func (r *BookRepo) countValues(ctx context.Context, f model.BookFilter, userID int64, isAdmin bool, facet, expr string) ([]model.FacetCount, error) {
+	counts := []model.FacetCount{}
+	q, ok := filterQuery(f, userID, isAdmin, facet)
+	if !ok {
+		return counts, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT value, COUNT(*) AS count FROM (
+			SELECT %s AS value FROM %s
+		) facet
+		WHERE value != ''
+		GROUP BY value
+		ORDER BY count DESC, value
+		LIMIT %s
+	`, expr, q.sql(), q.arg(facetLimit))
+	err := r.db.SelectContext(ctx, &counts, query, q.args...)
+	return counts, err
+}
@@ -23,13 +23,14 @@ func NewDownloadJobRepo(db *sqlx.DB) *DownloadJobRepo {
 
 func (r *DownloadJobRepo) CreateJob(ctx context.Context, userID int64, bookHash string) (*model.DownloadJob, error) {
 	job := &model.DownloadJob{
-		ID:        utils.GenerateSnowflakeID(),
-		UserID:    userID,
-		BookHash:  bookHash,
-		Status:    model.DownloadStatusPending,
-		Progress:  0,
-		CreatedAt: time.Now().Unix(),
-		UpdatedAt: time.Now().Unix(),
+		ID:          utils.GenerateSnowflakeID(),
+		UserID:      userID,
+		BookHash:    bookHash,
+		Status:      model.DownloadStatusPending,
+		Progress:    0,
+		MaxAttempts: model.DefaultDownloadMaxAttempts,
+		CreatedAt:   time.Now().Unix(),
+		UpdatedAt:   time.Now().Unix(),
 	}
 
 	query := fmt.Sprintf(
@@ -54,6 +55,8 @@ func (r *DownloadJobRepo) GetUserJobs(ctx context.Context, userID int64, limit,
 		SELECT 
 			dj.id, dj.user_id, dj.book_hash, dj.status, dj.progress, 
 			dj.error_msg, dj.file_path, dj.created_at, dj.updated_at,
+			dj.downloaded_bytes, dj.total_bytes, dj.bytes_per_second,
+			dj.attempts, dj.max_attempts, dj.next_attempt_at, dj.priority,
 			COALESCE(sb.title, '') as title,
 			COALESCE(sb.authors, '') as authors,
 			COALESCE(sb.publisher, '') as publisher,
@@ -72,9 +75,18 @@ func (r *DownloadJobRepo) GetUserJobs(ctx context.Context, userID int64, limit,
 	return jobs, err
 }
 
+// UpdateJobStatus sets the status of a job. A cancelled job is left alone so
+// a fetch finishing late cannot bring it back.
 func (r *DownloadJobRepo) UpdateJobStatus(ctx context.Context, jobID int64, status string, progress int, errorMsg string) error {
-	query := `UPDATE downloadjobs SET status = $1, progress = $2, error_msg = $3, updated_at = $4 WHERE id = $5`
-	_, err := r.db.ExecContext(ctx, query, status, progress, errorMsg, time.Now().Unix(), jobID)
+	query := `UPDATE downloadjobs SET status = $1, progress = $2, error_msg = $3, updated_at = $4 WHERE id = $5 AND status != $6`
+	_, err := r.db.ExecContext(ctx, query, status, progress, errorMsg, time.Now().Unix(), jobID, model.DownloadStatusCancelled)
+	return err
+}
+
+// UpdateJobTransfer records how far the file transfer of a job has come
+func (r *DownloadJobRepo) UpdateJobTransfer(ctx context.Context, jobID int64, progress int, downloadedBytes, totalBytes, bytesPerSecond int64) error {
+	query := `UPDATE downloadjobs SET progress = $1, downloaded_bytes = $2, total_bytes = $3, bytes_per_second = $4, updated_at = $5 WHERE id = $6`
+	_, err := r.db.ExecContext(ctx, query, progress, downloadedBytes, totalBytes, bytesPerSecond, time.Now().Unix(), jobID)
 	return err
 }
 
@@ -84,18 +96,185 @@ func (r *DownloadJobRepo) UpdateJobFilePath(ctx context.Context, jobID int64, fi
 	return err
 }
 
+// UpdateBookFilePath points every finished job for a book at a new file path
+func (r *DownloadJobRepo) UpdateBookFilePath(ctx context.Context, bookHash, filePath string) error {
+	query := `UPDATE downloadjobs SET file_path = $1, updated_at = $2 WHERE book_hash = $3 AND file_path != ''`
+	_, err := r.db.ExecContext(ctx, query, filePath, time.Now().Unix(), bookHash)
+	return err
+}
+
 func (r *DownloadJobRepo) GetPendingJobs(ctx context.Context, limit int) ([]model.DownloadJob, error) {
 	var jobs []model.DownloadJob
 	query := fmt.Sprintf(`
 		SELECT %s FROM downloadjobs 
-		WHERE status = $1 
-		ORDER BY created_at ASC 
-		LIMIT $2
+		WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY priority DESC, created_at ASC 
+		LIMIT $3
+	`, r.AllRaw)
+	err := r.db.SelectContext(ctx, &jobs, query, model.DownloadStatusPending, time.Now().Unix(), limit)
+	return jobs, err
+}
+
+// GetPendingJobsForBook returns every queued job for a book, including ones
+// waiting out a retry backoff
+func (r *DownloadJobRepo) GetPendingJobsForBook(ctx context.Context, bookHash string) ([]model.DownloadJob, error) {
+	var jobs []model.DownloadJob
+	query := fmt.Sprintf(`
+		SELECT %s FROM downloadjobs
+		WHERE book_hash = $1 AND status = $2
+		ORDER BY created_at ASC
 	`, r.AllRaw)
-	err := r.db.SelectContext(ctx, &jobs, query, model.DownloadStatusPending, limit)
+	err := r.db.SelectContext(ctx, &jobs, query, bookHash, model.DownloadStatusPending)
 	return jobs, err
 }
 
+// ClaimJob moves a pending job to downloading and counts the attempt. It
+// reports false when the job was no longer pending, meaning another worker
+// got to it first.
+func (r *DownloadJobRepo) ClaimJob(ctx context.Context, jobID int64) (bool, error) {
+	query := `UPDATE downloadjobs SET status = $1, progress = 0, error_msg = '', attempts = attempts + 1, updated_at = $2 WHERE id = $3 AND status = $4`
+	result, err := r.db.ExecContext(ctx, query, model.DownloadStatusDownloading, time.Now().Unix(), jobID, model.DownloadStatusPending)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// ResetInterruptedJobs puts jobs left in the downloading state by a previous
+// run back in the queue so their transfer can resume. The interrupted attempt
+// is not counted against the job.
+func (r *DownloadJobRepo) ResetInterruptedJobs(ctx context.Context) (int64, error) {
+	query := `UPDATE downloadjobs SET status = $1, attempts = CASE WHEN attempts > 0 THEN attempts - 1 ELSE 0 END, updated_at = $2 WHERE status = $3`
+	result, err := r.db.ExecContext(ctx, query, model.DownloadStatusPending, time.Now().Unix(), model.DownloadStatusDownloading)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CancelJob cancels a job that has not finished yet. It reports false when
+// there was no such job.
+func (r *DownloadJobRepo) CancelJob(ctx context.Context, jobID int64) (bool, error) {
+	query := `UPDATE downloadjobs SET status = $1, bytes_per_second = 0, updated_at = $2 WHERE id = $3 AND status IN ($4, $5)`
+	result, err := r.db.ExecContext(ctx, query, model.DownloadStatusCancelled, time.Now().Unix(), jobID,
+		model.DownloadStatusPending, model.DownloadStatusDownloading)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// SetJobPriority changes where a job sits in the queue
+func (r *DownloadJobRepo) SetJobPriority(ctx context.Context, jobID int64, priority int) (bool, error) {
+	query := `UPDATE downloadjobs SET priority = $1, updated_at = $2 WHERE id = $3`
+	result, err := r.db.ExecContext(ctx, query, priority, time.Now().Unix(), jobID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// GetQueuedJobs returns the pending and active jobs in the order they will
+// be processed, active ones first
+func (r *DownloadJobRepo) GetQueuedJobs(ctx context.Context, limit, offset int) ([]model.DownloadJobWithMetadata, error) {
+	var jobs []model.DownloadJobWithMetadata
+	query := `
+		SELECT
+			dj.id, dj.user_id, dj.book_hash, dj.status, dj.progress,
+			dj.error_msg, dj.file_path, dj.created_at, dj.updated_at,
+			dj.downloaded_bytes, dj.total_bytes, dj.bytes_per_second,
+			dj.attempts, dj.max_attempts, dj.next_attempt_at, dj.priority,
+			COALESCE(sb.title, '') as title,
+			COALESCE(sb.authors, '') as authors,
+			COALESCE(sb.publisher, '') as publisher,
+			COALESCE(sb.language, '') as language,
+			COALESCE(sb.format, '') as format,
+			COALESCE(sb.size, '') as size,
+			COALESCE(sb.cover_url, '') as cover_url,
+			COALESCE(sb.cover_data, '') as cover_data
+		FROM downloadjobs dj
+		LEFT JOIN savedbooks sb ON dj.book_hash = sb.hash
+		WHERE dj.status IN ($1, $2)
+		ORDER BY CASE WHEN dj.status = $1 THEN 0 ELSE 1 END, dj.priority DESC, dj.created_at ASC
+		LIMIT $3 OFFSET $4
+	`
+	err := r.db.SelectContext(ctx, &jobs, query, model.DownloadStatusDownloading, model.DownloadStatusPending, limit, offset)
+	return jobs, err
+}
+
+// CountQueuedJobs counts pending and active jobs
+func (r *DownloadJobRepo) CountQueuedJobs(ctx context.Context) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM downloadjobs WHERE status IN ($1, $2)`
+	err := r.db.GetContext(ctx, &count, query, model.DownloadStatusDownloading, model.DownloadStatusPending)
+	return count, err
+}
+
+// CountQueuedJobsForBook counts pending and active jobs for a book
+func (r *DownloadJobRepo) CountQueuedJobsForBook(ctx context.Context, bookHash string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM downloadjobs WHERE book_hash = $1 AND status IN ($2, $3)`
+	err := r.db.GetContext(ctx, &count, query, bookHash, model.DownloadStatusDownloading, model.DownloadStatusPending)
+	return count, err
+}
+
+// ScheduleRetry puts a failed job back in the queue, to be picked up no
+// earlier than nextAttemptAt
+func (r *DownloadJobRepo) ScheduleRetry(ctx context.Context, jobID int64, errorMsg string, nextAttemptAt int64) error {
+	query := `UPDATE downloadjobs SET status = $1, progress = 0, bytes_per_second = 0, error_msg = $2, next_attempt_at = $3, updated_at = $4 WHERE id = $5 AND status != $6`
+	_, err := r.db.ExecContext(ctx, query, model.DownloadStatusPending, errorMsg, nextAttemptAt, time.Now().Unix(), jobID, model.DownloadStatusCancelled)
+	return err
+}
+
+// DeferJob puts a job back in the queue until nextAttemptAt without counting
+// the attempt against it, for failures that are not the job's fault
+func (r *DownloadJobRepo) DeferJob(ctx context.Context, jobID int64, errorMsg string, nextAttemptAt int64) error {
+	query := `
+		UPDATE downloadjobs SET status = $1, progress = 0, bytes_per_second = 0, error_msg = $2, next_attempt_at = $3,
+			attempts = CASE WHEN attempts > 0 THEN attempts - 1 ELSE 0 END, updated_at = $4
+		WHERE id = $5 AND status != $6
+	`
+	_, err := r.db.ExecContext(ctx, query, model.DownloadStatusPending, errorMsg, nextAttemptAt, time.Now().Unix(), jobID, model.DownloadStatusCancelled)
+	return err
+}
+
+// RecordAttempt adds an entry to the retry history of a job
+func (r *DownloadJobRepo) RecordAttempt(ctx context.Context, attempt *model.DownloadJobAttempt) error {
+	attempt.ID = utils.GenerateSnowflakeID()
+	query := `
+		INSERT INTO downloadjob_attempts (id, job_id, attempt, error_msg, transient, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		attempt.ID, attempt.JobID, attempt.Attempt, attempt.ErrorMsg, attempt.Transient, attempt.StartedAt, attempt.FinishedAt)
+	return err
+}
+
+// GetJobAttempts returns the retry history of a job, oldest first
+func (r *DownloadJobRepo) GetJobAttempts(ctx context.Context, jobID int64) ([]model.DownloadJobAttempt, error) {
+	var attempts []model.DownloadJobAttempt
+	query := `
+		SELECT id, job_id, attempt, error_msg, transient, started_at, finished_at
+		FROM downloadjob_attempts
+		WHERE job_id = $1
+		ORDER BY attempt ASC, started_at ASC
+	`
+	err := r.db.SelectContext(ctx, &attempts, query, jobID)
+	return attempts, err
+}
+
 func (r *DownloadJobRepo) GetJobByUserAndBook(ctx context.Context, userID int64, bookHash string) (*model.DownloadJob, error) {
 	var job model.DownloadJob
 	query := fmt.Sprintf(`
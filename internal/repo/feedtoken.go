@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type FeedTokenRepo struct {
+	Columns
+	db *sqlx.DB
+}
+
+func NewFeedTokenRepo(db *sqlx.DB) *FeedTokenRepo {
+	repo := &FeedTokenRepo{db: db}
+	repo.Columns = ExtractColumns[model.FeedToken]()
+	return repo
+}
+
+// SetFeedToken stores a new token for the user, replacing any previous one
+func (r *FeedTokenRepo) SetFeedToken(ctx context.Context, userID int64, tokenHash string) (*model.FeedToken, error) {
+	token := &model.FeedToken{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO feed_tokens (%s)
+		VALUES (%s)
+		ON CONFLICT (user_id) DO UPDATE SET
+			token_hash = excluded.token_hash, created_at = excluded.created_at, last_used_at = 0
+	`, r.AllRaw, r.AllPrefixed)
+	if _, err := r.db.NamedExecContext(ctx, query, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetFeedToken returns the user's token, or nil if they have none
+func (r *FeedTokenRepo) GetFeedToken(ctx context.Context, userID int64) (*model.FeedToken, error) {
+	var token model.FeedToken
+	query := fmt.Sprintf(`SELECT %s FROM feed_tokens WHERE user_id = $1`, r.AllRaw)
+	err := r.db.GetContext(ctx, &token, query, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UseFeedToken returns the ID of the user a token belongs to and records
+// that it was used. ok is false for unknown tokens.
+func (r *FeedTokenRepo) UseFeedToken(ctx context.Context, tokenHash string) (userID int64, ok bool, err error) {
+	err = r.db.GetContext(ctx, &userID, `SELECT user_id FROM feed_tokens WHERE token_hash = $1`, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	_, err = r.db.ExecContext(ctx, `UPDATE feed_tokens SET last_used_at = $1 WHERE user_id = $2`, time.Now().Unix(), userID)
+	return userID, true, err
+}
+
+func (r *FeedTokenRepo) DeleteFeedToken(ctx context.Context, userID int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM feed_tokens WHERE user_id = $1`, userID)
+	return err
+}
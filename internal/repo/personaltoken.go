@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type PersonalTokenRepo struct {
+	Columns
+	db *sqlx.DB
+}
+
+func NewPersonalTokenRepo(db *sqlx.DB) *PersonalTokenRepo {
+	repo := &PersonalTokenRepo{db: db}
+	repo.Columns = ExtractColumns[model.PersonalToken]()
+	return repo
+}
+
+func (r *PersonalTokenRepo) CreateToken(ctx context.Context, token *model.PersonalToken) error {
+	query := fmt.Sprintf(`
+		INSERT INTO personal_tokens (%s)
+		VALUES (%s)
+	`, r.AllRaw, r.AllPrefixed)
+	_, err := r.db.NamedExecContext(ctx, query, token)
+	return err
+}
+
+// GetTokenByHash returns the unexpired token with the given hash
+func (r *PersonalTokenRepo) GetTokenByHash(ctx context.Context, tokenHash string) (*model.PersonalToken, error) {
+	var token model.PersonalToken
+	query := fmt.Sprintf(`
+		SELECT %s FROM personal_tokens
+		WHERE token_hash = $1 AND (expires_at = 0 OR expires_at > $2)
+	`, r.AllRaw)
+	err := r.db.GetContext(ctx, &token, query, tokenHash, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *PersonalTokenRepo) GetTokensByUser(ctx context.Context, userID int64) ([]model.PersonalToken, error) {
+	var tokens []model.PersonalToken
+	query := fmt.Sprintf(`
+		SELECT %s FROM personal_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, r.AllRaw)
+	err := r.db.SelectContext(ctx, &tokens, query, userID)
+	return tokens, err
+}
+
+func (r *PersonalTokenRepo) CountTokensByUser(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM personal_tokens WHERE user_id = $1`, userID)
+	return count, err
+}
+
+// TouchToken records that a token was used. Writes are skipped while the
+// recorded time is under a minute old, so busy clients don't write on every
+// request.
+func (r *PersonalTokenRepo) TouchToken(ctx context.Context, id int64) error {
+	now := time.Now().Unix()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE personal_tokens SET last_used_at = $1
+		WHERE id = $2 AND last_used_at < $3
+	`, now, id, now-60)
+	return err
+}
+
+// DeleteToken revokes one of a user's tokens, reporting whether it existed
+func (r *PersonalTokenRepo) DeleteToken(ctx context.Context, id, userID int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM personal_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -20,6 +20,9 @@ type Repos struct {
 	RequestCredits    *RequestCreditsRepo
 	Invite            *InviteRepo
 	Settings          *SettingsRepo
+	APIKeyUsage       *APIKeyUsageRepo
+	FeedToken         *FeedTokenRepo
+	PersonalToken     *PersonalTokenRepo
 }
 
 type Columns struct {
@@ -47,6 +50,9 @@ func NewRepos(db *sqlx.DB) *Repos {
 		RequestCredits:    NewRequestCreditsRepo(db),
 		Invite:            NewInviteRepo(db, userRepo),
 		Settings:          NewSettingsRepo(db),
+		APIKeyUsage:       NewAPIKeyUsageRepo(db),
+		FeedToken:         NewFeedTokenRepo(db),
+		PersonalToken:     NewPersonalTokenRepo(db),
 	}
 }
 
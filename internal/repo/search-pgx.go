@@ -0,0 +1,19 @@
+//go:build !debug
+// +build !debug
+
+package repo
+
+import "github.com/akramboussanni/marchive/internal/search"
+
+// searchMatches selects the IDs of books matching the search in $1, with a
+// rank that sorts the best matches first. Title matches weigh the most, then
+// authors, then publisher.
+const searchMatches = `(
+	SELECT id AS match_id, -ts_rank(search_vector, query) AS match_rank
+	FROM savedbooks, to_tsquery('simple', marchive_fold($1)) AS query
+	WHERE search_vector @@ query
+)`
+
+func matchQuery(terms []string) string {
+	return search.PostgresQuery(terms)
+}
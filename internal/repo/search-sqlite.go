@@ -0,0 +1,19 @@
+//go:build debug
+// +build debug
+
+package repo
+
+import "github.com/akramboussanni/marchive/internal/search"
+
+// searchMatches selects the IDs of books matching the search in $1, with a
+// rank that sorts the best matches first. Title matches weigh the most, then
+// authors, then publisher.
+const searchMatches = `(
+	SELECT rowid AS match_id, bm25(savedbooks_fts, 10.0, 5.0, 1.0) AS match_rank
+	FROM savedbooks_fts
+	WHERE savedbooks_fts MATCH $1
+)`
+
+func matchQuery(terms []string) string {
+	return search.FTS5Query(terms)
+}
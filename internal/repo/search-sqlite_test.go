@@ -0,0 +1,138 @@
+//go:build debug
+// +build debug
+
+package repo
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/akramboussanni/marchive/internal/db"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// newSearchTestRepo returns a book repo over a fresh, fully migrated SQLite
+// database holding books
+func newSearchTestRepo(t *testing.T, books []model.SavedBook) *BookRepo {
+	t.Helper()
+
+	if err := utils.InitSnowflake(1); err != nil {
+		t.Fatalf("init snowflake: %v", err)
+	}
+
+	conn, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	db.DB = conn
+	db.RunMigrations()
+
+	r := NewBookRepo(conn)
+	for i := range books {
+		books[i].Status = model.BookStatusReady
+		if err := r.CreateBook(context.Background(), &books[i]); err != nil {
+			t.Fatalf("create book %q: %v", books[i].Title, err)
+		}
+	}
+	return r
+}
+
+func TestSearchBooksSQLite(t *testing.T) {
+	r := newSearchTestRepo(t, []model.SavedBook{
+		{Hash: "go", Title: "The Go Programming Language", Authors: "Alan Donovan, Brian Kernighan", Publisher: "Addison-Wesley"},
+		{Hash: "prince", Title: "Le Petit Prince", Authors: "Antoine de Saint-Exupéry", Publisher: "Gallimard"},
+		{Hash: "cafe", Title: "Café Society", Authors: "Jane Doe", Publisher: "Small Press"},
+		// "Tolkien" in the title, the authors and the publisher of three books
+		{Hash: "by-publisher", Title: "Collected Letters", Authors: "Various", Publisher: "Tolkien Estate Press"},
+		{Hash: "by-author", Title: "The Hobbit", Authors: "J. R. R. Tolkien", Publisher: "Allen & Unwin"},
+		{Hash: "by-title", Title: "Tolkien: A Biography", Authors: "Humphrey Carpenter", Publisher: "Allen & Unwin"},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		// Hashes in the order they should come back
+		want []string
+	}{
+		{"one word", "hobbit", []string{"by-author"}},
+		{"words in order", "go programming", []string{"go"}},
+		{"words in any order", "language programming go", []string{"go"}},
+		{"words across fields", "kernighan go", []string{"go"}},
+		{"every word has to match", "go hobbit", nil},
+		{"prefix", "progr", []string{"go"}},
+		{"prefix of every word", "pet prin", []string{"prince"}},
+		{"punctuation ignored", "go: programming!", []string{"go"}},
+		{"case ignored", "PETIT PRINCE", []string{"prince"}},
+		{"accents in the book", "exupery", []string{"prince"}},
+		{"accents in the query", "petít", []string{"prince"}},
+		{"accents both ways", "café", []string{"cafe"}},
+		{"title before authors before publisher", "tolkien", []string{"by-title", "by-author", "by-publisher"}},
+		{"no words", "?!", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := model.BookFilter{Query: tt.query}
+			f.Normalize()
+
+			books, err := r.FilterBooks(context.Background(), f, 0, false, 20, 0)
+			if err != nil {
+				t.Fatalf("FilterBooks(%q): %v", tt.query, err)
+			}
+			var got []string
+			for _, book := range books {
+				got = append(got, book.Hash)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterBooks(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+
+			count, err := r.CountFilteredBooks(context.Background(), f, 0, false)
+			if err != nil {
+				t.Fatalf("CountFilteredBooks(%q): %v", tt.query, err)
+			}
+			if count != len(tt.want) {
+				t.Errorf("CountFilteredBooks(%q) = %d, want %d", tt.query, count, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSearchIndexFollowsEdits(t *testing.T) {
+	r := newSearchTestRepo(t, []model.SavedBook{
+		{Hash: "book", Title: "Untitled", Authors: "Unknown"},
+	})
+	ctx := context.Background()
+
+	if err := r.UpdateBookMetadata(ctx, "book", "Dune", "Frank Herbert", "Chilton"); err != nil {
+		t.Fatalf("update metadata: %v", err)
+	}
+
+	for query, want := range map[string]int{"dune herbert": 1, "untitled": 0} {
+		f := model.BookFilter{Query: query}
+		f.Normalize()
+		count, err := r.CountFilteredBooks(ctx, f, 0, false)
+		if err != nil {
+			t.Fatalf("CountFilteredBooks(%q): %v", query, err)
+		}
+		if count != want {
+			t.Errorf("CountFilteredBooks(%q) after edit = %d, want %d", query, count, want)
+		}
+	}
+
+	if err := r.DeleteBook(ctx, "book"); err != nil {
+		t.Fatalf("delete book: %v", err)
+	}
+	f := model.BookFilter{Query: "dune"}
+	f.Normalize()
+	if count, err := r.CountFilteredBooks(ctx, f, 0, false); err != nil || count != 0 {
+		t.Errorf("CountFilteredBooks(dune) after delete = %d, %v, want 0", count, err)
+	}
+}
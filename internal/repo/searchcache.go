@@ -2,7 +2,9 @@ package repo
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -27,31 +29,33 @@ func NewSearchCacheRepo(db *sqlx.DB) *SearchCacheRepo {
 	return repo
 }
 
-// StoreSearchResults stores search results in cache and returns the cache ID
-func (r *SearchCacheRepo) StoreSearchResults(ctx context.Context, userID int64, query string, books []*anna.Book, total int) (*model.SearchCache, error) {
+// StoreSearchResults caches the results of a search under its normalized
+// query for ttl, replacing what was cached for it before
+func (r *SearchCacheRepo) StoreSearchResults(ctx context.Context, query string, books []*anna.Book, ttl time.Duration) (*model.SearchCache, error) {
 	// Serialize books to JSON
 	resultsJSON, err := json.Marshal(books)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal search results: %w", err)
 	}
 
-	// Cache expires in 1 hour
 	now := time.Now().Unix()
-	expiresAt := now + 3600 // 1 hour
-
 	searchCache := &model.SearchCache{
 		ID:           utils.GenerateSnowflakeID(),
-		UserID:       userID,
 		Query:        query,
 		Results:      string(resultsJSON),
-		TotalResults: total,
+		TotalResults: len(books),
 		CreatedAt:    now,
-		ExpiresAt:    expiresAt,
+		ExpiresAt:    now + int64(ttl/time.Second),
 	}
 
 	query_sql := fmt.Sprintf(`
-		INSERT INTO search_cache (%s) 
+		INSERT INTO search_cache (%s)
 		VALUES (%s)
+		ON CONFLICT (query) DO UPDATE SET
+			results = excluded.results,
+			total_results = excluded.total_results,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at
 	`, r.AllRaw, r.AllPrefixed)
 
 	_, err = r.db.NamedExecContext(ctx, query_sql, searchCache)
@@ -62,41 +66,19 @@ func (r *SearchCacheRepo) StoreSearchResults(ctx context.Context, userID int64,
 	return searchCache, nil
 }
 
-// GetSearchResult retrieves a specific search result by cache ID and index
-func (r *SearchCacheRepo) GetSearchResult(ctx context.Context, userID, searchID int64, index int) (*anna.Book, error) {
+// GetSearchCache retrieves the unexpired results cached for a normalized
+// query. A query with nothing cached returns nil.
+func (r *SearchCacheRepo) GetSearchCache(ctx context.Context, query string) (*model.SearchCache, []*anna.Book, error) {
 	var cache model.SearchCache
-	query := fmt.Sprintf(`SELECT %s FROM search_cache 
-	          WHERE id = $1 AND user_id = $2 AND expires_at > $3`, r.AllRaw)
+	query_sql := fmt.Sprintf(`SELECT %s FROM search_cache 
+	          WHERE query = $1 AND expires_at > $2`, r.AllRaw)
 
-	err := r.db.GetContext(ctx, &cache, query, searchID, userID, time.Now().Unix())
-	if err != nil {
-		return nil, fmt.Errorf("search cache not found or expired: %w", err)
+	err := r.db.GetContext(ctx, &cache, query_sql, query, time.Now().Unix())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
 	}
-
-	// Deserialize results
-	var books []*anna.Book
-	err = json.Unmarshal([]byte(cache.Results), &books)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal search results: %w", err)
-	}
-
-	// Check if index is valid
-	if index < 0 || index >= len(books) {
-		return nil, fmt.Errorf("invalid result index: %d", index)
-	}
-
-	return books[index], nil
-}
-
-// GetSearchCache retrieves full search cache by ID
-func (r *SearchCacheRepo) GetSearchCache(ctx context.Context, userID, searchID int64) (*model.SearchCache, []*anna.Book, error) {
-	var cache model.SearchCache
-	query := fmt.Sprintf(`SELECT %s FROM search_cache 
-	          WHERE id = $1 AND user_id = $2 AND expires_at > $3`, r.AllRaw)
-
-	err := r.db.GetContext(ctx, &cache, query, searchID, userID, time.Now().Unix())
-	if err != nil {
-		return nil, nil, fmt.Errorf("search cache not found or expired: %w", err)
+		return nil, nil, fmt.Errorf("failed to get search cache: %w", err)
 	}
 
 	// Deserialize results
@@ -125,23 +107,10 @@ func (r *SearchCacheRepo) CleanupExpiredCache(ctx context.Context) error {
 	return nil
 }
 
-// GetUserCacheCount returns the number of active cache entries for a user
-func (r *SearchCacheRepo) GetUserCacheCount(ctx context.Context, userID int64) (int, error) {
+// CountActiveCache returns the number of unexpired cache entries
+func (r *SearchCacheRepo) CountActiveCache(ctx context.Context) (int, error) {
 	var count int
-	query := "SELECT COUNT(*) FROM search_cache WHERE user_id = $1 AND expires_at > $2"
-	err := r.db.GetContext(ctx, &count, query, userID, time.Now().Unix())
+	query := "SELECT COUNT(*) FROM search_cache WHERE expires_at > $1"
+	err := r.db.GetContext(ctx, &count, query, time.Now().Unix())
 	return count, err
 }
-
-// DeleteUserOldestCache deletes the oldest cache entry for a user (for cache size limiting)
-func (r *SearchCacheRepo) DeleteUserOldestCache(ctx context.Context, userID int64) error {
-	query := `DELETE FROM search_cache 
-	          WHERE id = (
-	              SELECT id FROM search_cache 
-	              WHERE user_id = $1 
-	              ORDER BY created_at ASC 
-	              LIMIT 1
-	          )`
-	_, err := r.db.ExecContext(ctx, query, userID)
-	return err
-}
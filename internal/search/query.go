@@ -0,0 +1,59 @@
+// Package search turns what users type into full-text queries over the
+// local catalog. Every word has to match, in any order, and the last letters
+// of each may be left off.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxTerms bounds how many words of a query are used
+const maxTerms = 16
+
+// Terms splits a query into lowercase words, dropping punctuation
+func Terms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// Normalize folds case and whitespace, so queries that only differ in those
+// are treated as the same search
+func Normalize(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// PostgresQuery builds a to_tsquery expression matching every term as a
+// prefix
+func PostgresQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// FTS5Query builds an SQLite FTS5 MATCH expression matching every term as a
+// prefix
+func FTS5Query(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(parts, " AND ")
+}
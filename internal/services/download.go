@@ -2,131 +2,230 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"regexp"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/events"
 	"github.com/akramboussanni/marchive/internal/model"
 	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/akramboussanni/marchive/internal/storage"
 )
 
 type DownloadService struct {
 	repos       *repo.Repos
 	downloadDir string
-	secretKey   string
+	store       storage.Storage
+	limits      StorageLimits
+	source      anna.BookSource
+	workers     int
+	hub         *events.Hub
+
+	wg        sync.WaitGroup
+	jobCtx    context.Context
+	abortJobs context.CancelFunc
+
+	// Fetches in progress, by book hash
+	tasksMu sync.Mutex
+	tasks   map[string]*fetchTask
+
+	// Unix time until which no jobs are claimed, set when the source is out of quota
+	pausedUntil atomic.Int64
 }
 
-func NewDownloadService(repos *repo.Repos, downloadDir, secretKey string) *DownloadService {
+// NewDownloadService creates the download queue. Transfers are written to
+// downloadDir and moved into store once complete; limits caps what store holds.
+func NewDownloadService(repos *repo.Repos, downloadDir string, store storage.Storage, limits StorageLimits, source anna.BookSource, workers int, hub *events.Hub) *DownloadService {
 	if err := os.MkdirAll(downloadDir, 0755); err != nil {
 		log.Printf("Failed to create download directory: %v", err)
 	}
+	if workers < 1 {
+		workers = 1
+	}
+	if limits.Policy != EvictLRU && limits.Policy != EvictLeastDownloaded {
+		log.Printf("Unknown eviction policy %q, using %s", limits.Policy, EvictLRU)
+		limits.Policy = EvictLRU
+	}
 
+	jobCtx, abortJobs := context.WithCancel(context.Background())
 	return &DownloadService{
 		repos:       repos,
 		downloadDir: downloadDir,
-		secretKey:   secretKey,
+		store:       store,
+		limits:      limits,
+		source:      source,
+		workers:     workers,
+		hub:         hub,
+		jobCtx:      jobCtx,
+		abortJobs:   abortJobs,
+		tasks:       make(map[string]*fetchTask),
 	}
 }
 
-func (ds *DownloadService) ProcessPendingDownloads(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Download service shutting down...")
-			return
-		default:
-			// Clean up failed books older than 24 hours
-			ds.cleanupFailedBooks(ctx)
+// worker claims pending jobs one at a time and processes them until ctx is
+// cancelled. Jobs run on the service's own context so a shutdown lets them
+// finish instead of cutting them off.
+func (ds *DownloadService) worker(ctx context.Context) {
+	defer ds.wg.Done()
 
-			jobs, err := ds.repos.DownloadJob.GetPendingJobs(ctx, 5)
-			if err != nil {
-				log.Printf("Failed to get pending jobs: %v", err)
-				time.Sleep(10 * time.Second)
-				continue
+	for {
+		if wait := time.Until(time.Unix(ds.pausedUntil.Load(), 0)); wait > 0 {
+			if !sleepContext(ctx, min(wait, time.Minute)) {
+				return
 			}
+			continue
+		}
 
-			if len(jobs) == 0 {
-				time.Sleep(5 * time.Second)
-				continue
+		job, err := ds.claimNextJob(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Failed to claim pending job: %v", err)
+			if !sleepContext(ctx, 10*time.Second) {
+				return
 			}
+			continue
+		}
 
-			for _, job := range jobs {
-				go ds.processJob(ctx, &job)
+		if job == nil {
+			if !sleepContext(ctx, 5*time.Second) {
+				return
 			}
+			continue
+		}
 
-			time.Sleep(2 * time.Second)
+		task, taskCtx := ds.startTask(ds.jobCtx, job)
+		if task == nil {
+			continue
 		}
+		ds.adoptPendingJobs(taskCtx, task)
+		ds.processTask(taskCtx, task)
+		task.cancel()
 	}
 }
 
-func (ds *DownloadService) processJob(ctx context.Context, job *model.DownloadJob) {
-	log.Printf("Processing download job %d for book %s", job.ID, job.BookHash)
-
-	err := ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusDownloading, 10, "")
+// claimNextJob returns the oldest pending job this worker managed to claim,
+// or nil when there is nothing left to do
+func (ds *DownloadService) claimNextJob(ctx context.Context) (*model.DownloadJob, error) {
+	jobs, err := ds.repos.DownloadJob.GetPendingJobs(ctx, ds.workers)
 	if err != nil {
-		log.Printf("Failed to update job status: %v", err)
-		return
+		return nil, err
+	}
+
+	for i := range jobs {
+		claimed, err := ds.repos.DownloadJob.ClaimJob(ctx, jobs[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			jobs[i].Status = model.DownloadStatusDownloading
+			jobs[i].Attempts++
+			ds.publish(&jobs[i])
+			return &jobs[i], nil
+		}
 	}
+	return nil, nil
+}
+
+// pauseUntil stops workers from claiming jobs until t
+func (ds *DownloadService) pauseUntil(t time.Time) {
+	for {
+		current := ds.pausedUntil.Load()
+		if t.Unix() <= current {
+			return
+		}
+		if ds.pausedUntil.CompareAndSwap(current, t.Unix()) {
+			log.Printf("Download queue paused until %s: out of fast downloads", t.Format(time.RFC3339))
+			return
+		}
+	}
+}
+
+// publish sends the current state of a job to anyone watching its owner's
+// jobs. Callers update the job in memory alongside the database.
+func (ds *DownloadService) publish(job *model.DownloadJob) {
+	if ds.hub != nil {
+		ds.hub.Publish(events.NewJobEvent(job))
+	}
+}
+
+// sleepContext waits for d and reports false if ctx was cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (ds *DownloadService) processTask(ctx context.Context, task *fetchTask) {
+	job := task.leader
+	log.Printf("Processing download job %d for book %s (attempt %d/%d)", job.ID, job.BookHash, job.Attempts, job.MaxAttempts)
+	startedAt := time.Now().Unix()
 
 	book, err := ds.repos.Book.GetBookByHash(ctx, job.BookHash)
 	if err != nil {
 		// Book doesn't exist, need to download it
-		err = ds.processNewBook(ctx, job)
+		err = ds.processNewBook(ctx, task)
 		if err != nil {
 			log.Printf("Failed to process new book: %v", err)
-			ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusFailed, 0, err.Error())
+			ds.failTask(ctx, task, startedAt, err)
 			return
 		}
 		// After successful download, mark job as completed
-		ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusCompleted, 100, "")
+		ds.completeTask(ctx, task, startedAt)
 		log.Printf("Download job %d completed successfully", job.ID)
 		return
 	}
 
 	// Book already exists
 	if book.Status == model.BookStatusReady && book.FilePath != "" {
-		// Check if file actually exists on disk
-		if _, err := os.Stat(book.FilePath); err == nil {
+		// Check if file actually exists in storage
+		if _, err := ds.store.Stat(ctx, book.FilePath); err == nil {
 			// File exists, mark job as completed
-			ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusCompleted, 100, "")
-			ds.repos.DownloadJob.UpdateJobFilePath(ctx, job.ID, book.FilePath)
+			task.filePath = book.FilePath
+			ds.completeTask(ctx, task, startedAt)
 			log.Printf("Book %s already available, job %d completed", job.BookHash, job.ID)
 			return
 		} else {
 			// File doesn't exist, need to re-download
 			log.Printf("Book %s marked as ready but file missing, re-downloading", job.BookHash)
-			err = ds.processNewBook(ctx, job)
+			err = ds.processNewBook(ctx, task)
 			if err != nil {
 				log.Printf("[RE-DOWNLOAD FAILED] Job %d, Book %s: %v", job.ID, job.BookHash, err)
-				ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusFailed, 0, err.Error())
-				ds.repos.Book.UpdateBookStatus(ctx, job.BookHash, model.BookStatusError, err.Error())
+				ds.failTask(ctx, task, startedAt, err)
 				return
 			}
-			ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusCompleted, 100, "")
+			ds.completeTask(ctx, task, startedAt)
 			log.Printf("Re-download job %d completed successfully", job.ID)
 			return
 		}
 	}
 
 	// Book exists but not ready, need to download it
-	err = ds.processNewBook(ctx, job)
+	err = ds.processNewBook(ctx, task)
 	if err != nil {
 		log.Printf("[DOWNLOAD FAILED] Job %d, Existing Book %s: %v", job.ID, job.BookHash, err)
-		ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusFailed, 0, err.Error())
-		ds.repos.Book.UpdateBookStatus(ctx, job.BookHash, model.BookStatusError, err.Error())
+		ds.failTask(ctx, task, startedAt, err)
 		return
 	}
 
-	ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusCompleted, 100, "")
+	ds.completeTask(ctx, task, startedAt)
 	log.Printf("Download job %d completed successfully", job.ID)
 }
 
-func (ds *DownloadService) processNewBook(ctx context.Context, job *model.DownloadJob) error {
+func (ds *DownloadService) processNewBook(ctx context.Context, task *fetchTask) error {
+	job := task.leader
 
 	existingBook, err := ds.repos.Book.GetBookByHash(ctx, job.BookHash)
 	var bookMetadata *anna.Book
@@ -135,7 +234,7 @@ func (ds *DownloadService) processNewBook(ctx context.Context, job *model.Downlo
 
 		log.Printf("Book %s not found, fetching metadata from Anna's archive", job.BookHash)
 
-		bookMetadata, err = anna.GetBookMetadata(job.BookHash)
+		bookMetadata, err = ds.source.Metadata(ctx, job.BookHash)
 		if err != nil {
 			log.Printf("Failed to get metadata from Anna's archive: %v", err)
 
@@ -180,44 +279,51 @@ func (ds *DownloadService) processNewBook(ctx context.Context, job *model.Downlo
 		}
 	}
 
-	ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusDownloading, 30, "")
-
 	annaBook := &anna.Book{
 		Hash:   job.BookHash,
 		Title:  bookMetadata.Title,
 		Format: bookMetadata.Format,
 	}
 
-	ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusDownloading, 50, "")
-
-	err = annaBook.Download(ds.secretKey, ds.downloadDir)
+	progress := newTransferProgress(ctx, ds, task)
+	localPath, err := annaBook.Download(ctx, ds.source, ds.downloadDir, progress.update)
 	if err != nil {
-		log.Printf("[ANNA DOWNLOAD ERROR] Book %s: %v", job.BookHash, err)
-		ds.repos.Book.UpdateBookStatus(ctx, job.BookHash, model.BookStatusError, "")
+		var checksumErr *anna.ChecksumError
+		if errors.As(err, &checksumErr) {
+			log.Printf("[CHECKSUM MISMATCH] Book %s from mirror %s: %v", job.BookHash, annaBook.Mirror, err)
+		} else {
+			log.Printf("[ANNA DOWNLOAD ERROR] Book %s: %v", job.BookHash, err)
+		}
 		return fmt.Errorf("failed to download book from Anna's Archive: %w", err)
 	}
 
-	ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusDownloading, 90, "")
+	if annaBook.Mirror != "" {
+		log.Printf("Book %s downloaded via mirror %s", job.BookHash, annaBook.Mirror)
+	}
 
-	title := bookMetadata.Title
-	if title == "" || title == "Unknown Title" {
-		title = job.BookHash[:8]
+	filePath, err := anna.StoredFilename(job.BookHash, annaBook.Format)
+	if err != nil {
+		return err
+	}
+	if err := ds.store.PutFile(ctx, filePath, localPath); err != nil {
+		return fmt.Errorf("failed to store downloaded book: %w", err)
+	}
+	var fileSize int64
+	if info, err := ds.store.Stat(ctx, filePath); err == nil {
+		fileSize = info.Size
 	}
-	// Sanitize filename - remove invalid characters
-	title = sanitizeFilename(title)
-	filename := fmt.Sprintf("%s.%s", title, bookMetadata.Format)
-	filePath := filepath.Join(ds.downloadDir, filename)
 
 	err = ds.repos.Book.UpdateBookWithMetadata(ctx, job.BookHash, model.BookStatusReady, filePath, bookMetadata)
 	if err != nil {
 		return fmt.Errorf("failed to update book status: %w", err)
 	}
-
-	err = ds.repos.DownloadJob.UpdateJobFilePath(ctx, job.ID, filePath)
-	if err != nil {
-		log.Printf("Failed to update job file path: %v", err)
+	if err := ds.repos.Book.UpdateFileSize(ctx, job.BookHash, fileSize); err != nil {
+		log.Printf("Failed to record file size of book %s: %v", job.BookHash, err)
 	}
+	// Conversions of whatever file was here before no longer match
+	ds.deleteDerived(ctx, job.BookHash)
 
+	task.filePath = filePath
 	return nil
 }
 
@@ -235,31 +341,59 @@ func (ds *DownloadService) cleanupFailedBooks(ctx context.Context) {
 	}
 }
 
+// StartService starts the worker pool and runs housekeeping until ctx is
+// cancelled. Cancelling ctx stops new jobs from being claimed; use Shutdown
+// to wait for the ones already running.
 func (ds *DownloadService) StartService(ctx context.Context) {
-	log.Println("Starting download service...")
-	ds.ProcessPendingDownloads(ctx)
-}
-
-func sanitizeFilename(filename string) string {
-	// Remove or replace invalid filename characters for Windows
-	invalidChars := regexp.MustCompile(`[<>:"/\\|?*]`)
-	sanitized := invalidChars.ReplaceAllString(filename, "")
+	log.Printf("Starting download service with %d workers...", ds.workers)
 
-	// Remove control characters
-	controlChars := regexp.MustCompile(`[\x00-\x1f\x7f]`)
-	sanitized = controlChars.ReplaceAllString(sanitized, "")
+	// Jobs that were mid-transfer when the server stopped resume from their .part file
+	resumed, err := ds.repos.DownloadJob.ResetInterruptedJobs(ctx)
+	if err != nil {
+		log.Printf("Failed to requeue interrupted jobs: %v", err)
+	} else if resumed > 0 {
+		log.Printf("Requeued %d interrupted download jobs", resumed)
+	}
 
-	// Trim spaces and dots from the end
-	sanitized = strings.TrimRight(sanitized, ". ")
+	ds.reconcileFilePaths(ctx)
+	ds.moveOutsideFiles(ctx)
+	ds.recordFileSizes(ctx)
+	ds.recordLanguageCodes(ctx)
 
-	// Limit length to 200 characters to avoid path too long errors
-	if len(sanitized) > 200 {
-		sanitized = sanitized[:200]
+	ds.wg.Add(ds.workers)
+	for i := 0; i < ds.workers; i++ {
+		go ds.worker(ctx)
 	}
 
-	if sanitized == "" {
-		return "untitled"
+	for {
+		// Clean up failed books older than 24 hours
+		ds.cleanupFailedBooks(ctx)
+		ds.enforceStorageCap(ctx)
+
+		if !sleepContext(ctx, time.Minute) {
+			log.Println("Download service shutting down...")
+			return
+		}
 	}
+}
 
-	return sanitized
+// Shutdown waits for in-flight jobs to finish. If ctx expires first the
+// remaining transfers are aborted; they stay in the downloading state and
+// resume from their .part file on the next start.
+func (ds *DownloadService) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ds.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		ds.abortJobs()
+		return nil
+	case <-ctx.Done():
+		ds.abortJobs()
+		<-done
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// progressInterval throttles how often transfer progress hits the database
+	progressInterval = 1 * time.Second
+	// rateSmoothing is the weight of the newest sample in the transfer rate
+	rateSmoothing = 0.3
+)
+
+// transferProgress turns the byte counts reported by the downloader into
+// throttled progress updates, with a smoothed transfer rate, for every job
+// subscribed to a fetch
+type transferProgress struct {
+	ds        *DownloadService
+	ctx       context.Context
+	task      *fetchTask
+	lastFlush time.Time
+	lastBytes int64
+	rate      float64
+	flushed   bool
+}
+
+func newTransferProgress(ctx context.Context, ds *DownloadService, task *fetchTask) *transferProgress {
+	return &transferProgress{
+		ds:        ds,
+		ctx:       ctx,
+		task:      task,
+		lastFlush: time.Now(),
+	}
+}
+
+func (p *transferProgress) update(written, total int64) {
+	now := time.Now()
+	done := total > 0 && written >= total
+	// Always flush the first report so the total size shows up right away
+	if p.flushed && now.Sub(p.lastFlush) < progressInterval && !done {
+		return
+	}
+	p.flushed = true
+
+	if elapsed := now.Sub(p.lastFlush).Seconds(); elapsed > 0 {
+		sample := float64(written-p.lastBytes) / elapsed
+		if p.rate == 0 {
+			p.rate = sample
+		} else {
+			p.rate = rateSmoothing*sample + (1-rateSmoothing)*p.rate
+		}
+	}
+	p.lastFlush = now
+	p.lastBytes = written
+
+	// 100 is reserved for a job that is fully processed, not just transferred
+	percent := 0
+	if total > 0 {
+		percent = int(written * 100 / total)
+		if percent > 99 {
+			percent = 99
+		}
+	}
+	if total < 0 {
+		total = 0
+	}
+
+	for _, job := range p.task.subscribers() {
+		err := p.ds.repos.DownloadJob.UpdateJobTransfer(p.ctx, job.ID, percent, written, total, int64(p.rate))
+		if err != nil {
+			log.Printf("Failed to update transfer progress for job %d: %v", job.ID, err)
+		}
+
+		job.Progress = percent
+		job.DownloadedBytes = written
+		job.TotalBytes = total
+		job.BytesPerSecond = int64(p.rate)
+		p.ds.publish(job)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build debug
+// +build debug
+
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akramboussanni/marchive/internal/model"
+)
+
+func TestMoveOutsideFiles(t *testing.T) {
+	ds, repos := newTestDownloadService(t, nil)
+	ctx := context.Background()
+
+	// Where an older version saved uploads, outside today's storage root
+	legacy := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(legacy, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	bookPath := write("123_abc.epub", "uploaded book")
+	coverPath := write("456_def.jpg", "cover")
+
+	uploaded := &model.SavedBook{Hash: "upload_1_0123456789abcdef", Title: "Uploaded", FilePath: bookPath, CoverData: coverPath}
+	if err := repos.Book.CreateUploadedBook(ctx, uploaded); err != nil {
+		t.Fatalf("create book: %v", err)
+	}
+	// Already in storage, left alone
+	stored := &model.SavedBook{Hash: "upload_2_0123456789abcdef", Title: "Stored", FilePath: "uploads/stored.epub"}
+	if err := repos.Book.CreateUploadedBook(ctx, stored); err != nil {
+		t.Fatalf("create book: %v", err)
+	}
+	if err := ds.store.Put(ctx, stored.FilePath, strings.NewReader("stored"), 6); err != nil {
+		t.Fatalf("store book: %v", err)
+	}
+
+	ds.moveOutsideFiles(ctx)
+
+	book, err := repos.Book.GetBookByHash(ctx, uploaded.Hash)
+	if err != nil {
+		t.Fatalf("get book: %v", err)
+	}
+	if book.FilePath != "uploads/123_abc.epub" || book.CoverData != "covers/456_def.jpg" {
+		t.Errorf("book points at %q and %q, want uploads/123_abc.epub and covers/456_def.jpg", book.FilePath, book.CoverData)
+	}
+	if book.Status != model.BookStatusReady {
+		t.Errorf("book status = %s, want %s", book.Status, model.BookStatusReady)
+	}
+	for _, key := range []string{book.FilePath, book.CoverData} {
+		if _, err := ds.store.Stat(ctx, key); err != nil {
+			t.Errorf("%s not in storage: %v", key, err)
+		}
+	}
+	for _, path := range []string{bookPath, coverPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still outside the root: %v", path, err)
+		}
+	}
+
+	if book, err := repos.Book.GetBookByHash(ctx, stored.Hash); err != nil || book.FilePath != stored.FilePath {
+		t.Errorf("book already in storage now points at %q, %v", book.FilePath, err)
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/storage"
+)
+
+// reconcileFilePaths moves books downloaded before hash based file names
+// into storage and points savedbooks.file_path at their storage keys. Older versions saved
+// files under their title, so the stored path could name a file that was
+// never written or that another book with the same title overwrote. It runs
+// once; completion is recorded in app_settings.
+func (ds *DownloadService) reconcileFilePaths(ctx context.Context) {
+	setting, err := ds.repos.Settings.GetSetting(ctx, model.SettingFilePathsReconciled)
+	if err == nil && setting.Value == "true" {
+		return
+	}
+
+	books, err := ds.repos.Book.GetStoredBooks(ctx)
+	if err != nil {
+		log.Printf("Failed to load books for file path reconciliation: %v", err)
+		return
+	}
+
+	var moved, missing int
+	for _, book := range books {
+		if ctx.Err() != nil {
+			return
+		}
+		// Uploads are named by the upload handler and never had the problem
+		if book.IsUploaded {
+			continue
+		}
+
+		key, err := anna.StoredFilename(book.Hash, book.Format)
+		if err != nil {
+			log.Printf("Skipping book %s: %v", book.Hash, err)
+			continue
+		}
+		if book.FilePath == key {
+			continue
+		}
+		target := filepath.Join(ds.downloadDir, key)
+
+		source := ds.findBookFile(&book, target)
+		if source == "" {
+			// processJob downloads the file again the next time it is requested
+			log.Printf("No file on disk for book %s (was %s)", book.Hash, book.FilePath)
+			missing++
+			continue
+		}
+
+		if err := ds.store.PutFile(ctx, key, source); err != nil {
+			log.Printf("Failed to move %s to storage as %s: %v", source, key, err)
+			return
+		}
+
+		if err := ds.repos.Book.UpdateBookStatus(ctx, book.Hash, model.BookStatusReady, key); err != nil {
+			log.Printf("Failed to update file path of book %s: %v", book.Hash, err)
+			return
+		}
+		if err := ds.repos.DownloadJob.UpdateBookFilePath(ctx, book.Hash, key); err != nil {
+			log.Printf("Failed to update job file paths of book %s: %v", book.Hash, err)
+		}
+		moved++
+	}
+
+	if err := ds.repos.Settings.SetSetting(ctx, model.SettingFilePathsReconciled, "true"); err != nil {
+		log.Printf("Failed to record file path reconciliation: %v", err)
+		return
+	}
+	log.Printf("Reconciled book file paths: %d moved, %d missing", moved, missing)
+}
+
+// moveOutsideFiles moves book files and covers that older versions recorded
+// by an absolute path outside the storage root into storage, which refuses
+// such paths as keys. Uploads go under UploadsPrefix and covers under
+// CoversPrefix, keeping their file names. It runs once; completion is
+// recorded in app_settings.
+func (ds *DownloadService) moveOutsideFiles(ctx context.Context) {
+	setting, err := ds.repos.Settings.GetSetting(ctx, model.SettingOutsideFilesMoved)
+	if err == nil && setting.Value == "true" {
+		return
+	}
+
+	books, err := ds.repos.Book.GetStoredBooks(ctx)
+	if err != nil {
+		log.Printf("Failed to load books for moving outside files: %v", err)
+		return
+	}
+
+	var moved int
+	for _, book := range books {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if key, ok := outsideFileKey(&book); ok {
+			ok, err := ds.moveOutsideFile(ctx, book.FilePath, key)
+			if err != nil {
+				return
+			}
+			if ok {
+				if err := ds.repos.Book.UpdateBookStatus(ctx, book.Hash, book.Status, key); err != nil {
+					log.Printf("Failed to update file path of book %s: %v", book.Hash, err)
+					return
+				}
+				if err := ds.repos.DownloadJob.UpdateBookFilePath(ctx, book.Hash, key); err != nil {
+					log.Printf("Failed to update job file paths of book %s: %v", book.Hash, err)
+				}
+				moved++
+			}
+		}
+
+		if storage.IsStoredCover(book.CoverData) {
+			key := path.Join(storage.CoversPrefix, filepath.Base(book.CoverData))
+			ok, err := ds.moveOutsideFile(ctx, book.CoverData, key)
+			if err != nil {
+				return
+			}
+			if ok {
+				if err := ds.repos.Book.UpdateBookCover(ctx, book.Hash, book.CoverURL, key); err != nil {
+					log.Printf("Failed to update cover of book %s: %v", book.Hash, err)
+					return
+				}
+				moved++
+			}
+		}
+	}
+
+	if err := ds.repos.Settings.SetSetting(ctx, model.SettingOutsideFilesMoved, "true"); err != nil {
+		log.Printf("Failed to record moving outside files: %v", err)
+		return
+	}
+	if moved > 0 {
+		log.Printf("Moved %d files from outside the storage root into storage", moved)
+	}
+}
+
+// outsideFileKey is the key the file of a book is moved to when it was found
+// outside the storage root
+func outsideFileKey(book *model.SavedBook) (string, bool) {
+	if book.IsUploaded {
+		return path.Join(storage.UploadsPrefix, filepath.Base(book.FilePath)), true
+	}
+	key, err := anna.StoredFilename(book.Hash, book.Format)
+	return key, err == nil
+}
+
+// moveOutsideFile moves the file at an absolute path storage does not accept
+// as a key into storage under key, reporting whether it did
+func (ds *DownloadService) moveOutsideFile(ctx context.Context, filePath, key string) (bool, error) {
+	if !filepath.IsAbs(filePath) {
+		return false, nil
+	}
+	if _, err := ds.store.Stat(ctx, filePath); err == nil {
+		return false, nil
+	}
+	if info, err := os.Stat(filePath); err != nil || info.IsDir() {
+		return false, nil
+	}
+
+	if err := ds.store.PutFile(ctx, key, filePath); err != nil {
+		log.Printf("Failed to move %s to storage as %s: %v", filePath, key, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// findBookFile returns the file on disk that holds the book, or "" if there
+// is none. A candidate only counts when its content hashes to the book's
+// MD5, so a file written for another book with the same title is not claimed.
+func (ds *DownloadService) findBookFile(book *model.SavedBook, target string) string {
+	candidates := []string{
+		target,
+		book.FilePath,
+		filepath.Join(ds.downloadDir, anna.DisplayFilename(book.Title, book.Format)),
+	}
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		if !anna.IsMD5(book.Hash) {
+			return candidate
+		}
+		actual, err := anna.FileMD5(candidate)
+		if err == nil && strings.EqualFold(actual, book.Hash) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// recordLanguageCodes fills in the language codes of books saved before
+// they were recorded, so language filters match them
+func (ds *DownloadService) recordLanguageCodes(ctx context.Context) {
+	books, err := ds.repos.Book.GetBooksMissingLanguageCodes(ctx)
+	if err != nil {
+		log.Printf("Failed to load books without language codes: %v", err)
+		return
+	}
+
+	var recorded int
+	for _, book := range books {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := ds.repos.Book.UpdateLanguageCode(ctx, book.Hash, model.LanguageCode(book.Language)); err != nil {
+			log.Printf("Failed to record language code of book %s: %v", book.Hash, err)
+			continue
+		}
+		recorded++
+	}
+
+	if recorded > 0 {
+		log.Printf("Recorded language codes of %d books", recorded)
+	}
+}
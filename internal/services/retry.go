@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/model"
+)
+
+const (
+	// retryBaseDelay is the wait before the second attempt of a job
+	retryBaseDelay = 30 * time.Second
+	// retryMaxDelay caps the wait between attempts
+	retryMaxDelay = 30 * time.Minute
+)
+
+// retryDelay is the backoff after the given attempt: exponential, capped,
+// with jitter so jobs that failed together do not all come back together
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (ds *DownloadService) completeJob(ctx context.Context, job *model.DownloadJob, startedAt int64) {
+	if err := ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusCompleted, 100, ""); err != nil {
+		log.Printf("Failed to mark job %d completed: %v", job.ID, err)
+	}
+	ds.recordAttempt(ctx, job, startedAt, nil, false)
+
+	job.Status = model.DownloadStatusCompleted
+	job.Progress = 100
+	job.ErrorMsg = ""
+	job.BytesPerSecond = 0
+	ds.publish(job)
+}
+
+// failJob records a failed attempt. Transient errors put the job back in the
+// queue with a backoff until it runs out of attempts; anything else fails
+// the job and its book for good.
+func (ds *DownloadService) failJob(ctx context.Context, job *model.DownloadJob, startedAt int64, err error) {
+	// Aborted by shutdown: the job stays downloading and resumes on next start
+	if ds.jobCtx.Err() != nil {
+		return
+	}
+	// The fetch was stopped because its jobs were cancelled
+	if ctx.Err() != nil {
+		ds.stopJob(context.WithoutCancel(ctx), job)
+		return
+	}
+
+	// Out of fast downloads on every key: hold the whole queue until the
+	// quotas reset rather than burning through attempts
+	var quotaErr *anna.QuotaExhaustedError
+	if errors.As(err, &quotaErr) {
+		ds.pauseUntil(quotaErr.ResetAt)
+		ds.deferJob(ctx, job, err, quotaErr.ResetAt)
+		return
+	}
+
+	transient := anna.IsTransient(err)
+	ds.recordAttempt(ctx, job, startedAt, err, transient)
+
+	if transient && job.Attempts < job.MaxAttempts {
+		delay := retryDelay(job.Attempts)
+		nextAttemptAt := time.Now().Add(delay).Unix()
+
+		retryErr := ds.repos.DownloadJob.ScheduleRetry(ctx, job.ID, err.Error(), nextAttemptAt)
+		if retryErr == nil {
+			log.Printf("Download job %d failed attempt %d/%d, retrying in %s: %v",
+				job.ID, job.Attempts, job.MaxAttempts, delay.Round(time.Second), err)
+
+			job.Status = model.DownloadStatusPending
+			job.Progress = 0
+			job.ErrorMsg = err.Error()
+			job.BytesPerSecond = 0
+			job.NextAttemptAt = nextAttemptAt
+			ds.publish(job)
+			return
+		}
+		log.Printf("Failed to schedule retry for job %d: %v", job.ID, retryErr)
+	}
+
+	ds.repos.DownloadJob.UpdateJobStatus(ctx, job.ID, model.DownloadStatusFailed, 0, err.Error())
+	if err := ds.repos.Book.FailBook(ctx, job.BookHash); err != nil {
+		log.Printf("Failed to mark book %s failed: %v", job.BookHash, err)
+	}
+
+	job.Status = model.DownloadStatusFailed
+	job.Progress = 0
+	job.ErrorMsg = err.Error()
+	job.BytesPerSecond = 0
+	ds.publish(job)
+}
+
+// stopJob settles a job whose fetch was cancelled under it. A job the user
+// cancelled is reported as such; one that joined the fetch just as it was
+// being cancelled goes back in the queue.
+func (ds *DownloadService) stopJob(ctx context.Context, job *model.DownloadJob) {
+	current, err := ds.repos.DownloadJob.GetJobByID(ctx, job.ID)
+	if err != nil {
+		log.Printf("Failed to get cancelled job %d: %v", job.ID, err)
+		return
+	}
+	if current.Status != model.DownloadStatusCancelled {
+		ds.deferJob(ctx, job, errFetchStopping, time.Now())
+		return
+	}
+
+	job.Status = model.DownloadStatusCancelled
+	job.BytesPerSecond = 0
+	ds.publish(job)
+}
+
+func (ds *DownloadService) deferJob(ctx context.Context, job *model.DownloadJob, err error, until time.Time) {
+	if deferErr := ds.repos.DownloadJob.DeferJob(ctx, job.ID, err.Error(), until.Unix()); deferErr != nil {
+		log.Printf("Failed to defer job %d: %v", job.ID, deferErr)
+		return
+	}
+
+	job.Status = model.DownloadStatusPending
+	job.Progress = 0
+	job.ErrorMsg = err.Error()
+	job.BytesPerSecond = 0
+	job.NextAttemptAt = until.Unix()
+	if job.Attempts > 0 {
+		job.Attempts--
+	}
+	ds.publish(job)
+}
+
+func (ds *DownloadService) recordAttempt(ctx context.Context, job *model.DownloadJob, startedAt int64, err error, transient bool) {
+	attempt := &model.DownloadJobAttempt{
+		JobID:      job.ID,
+		Attempt:    job.Attempts,
+		Transient:  transient,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now().Unix(),
+	}
+	if err != nil {
+		attempt.ErrorMsg = err.Error()
+	}
+
+	if err := ds.repos.DownloadJob.RecordAttempt(ctx, attempt); err != nil {
+		log.Printf("Failed to record attempt for job %d: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/akramboussanni/marchive/internal/search"
+)
+
+// searchCacheCleanupInterval is how often expired search results are removed
+const searchCacheCleanupInterval = 10 * time.Minute
+
+// SearchCache answers searches from the book source, keeping the results for
+// a while so repeating a search or paging through it doesn't hit the source
+// again. Results are shared by everyone making the same search.
+type SearchCache struct {
+	repo   *repo.SearchCacheRepo
+	source anna.BookSource
+	ttl    time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewSearchCache caches searches of source for ttl. A ttl of zero turns the
+// cache off.
+func NewSearchCache(searchCacheRepo *repo.SearchCacheRepo, source anna.BookSource, ttl time.Duration) *SearchCache {
+	return &SearchCache{
+		repo:   searchCacheRepo,
+		source: source,
+		ttl:    ttl,
+	}
+}
+
+// Search returns the source's results for query, from the cache when they
+// are there. Failing to read or write the cache only costs a live search.
+func (sc *SearchCache) Search(ctx context.Context, query anna.SearchQuery) ([]*anna.Book, error) {
+	if sc.ttl <= 0 {
+		return sc.source.Search(ctx, query)
+	}
+
+	key := searchCacheKey(query)
+	cached, books, err := sc.repo.GetSearchCache(ctx, key)
+	if err != nil {
+		log.Printf("Failed to read search cache for %q: %v", key, err)
+	} else if cached != nil {
+		sc.hits.Add(1)
+		return books, nil
+	}
+
+	sc.misses.Add(1)
+	books, err = sc.source.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := sc.repo.StoreSearchResults(ctx, key, books, sc.ttl); err != nil {
+		log.Printf("Failed to cache search results for %q: %v", key, err)
+	}
+	return books, nil
+}
+
+// searchCacheKey identifies a search by its normalized words, followed by
+// whatever else narrows or orders it
+func searchCacheKey(query anna.SearchQuery) string {
+	key := search.Normalize(query.Query)
+
+	params := query.Params()
+	first, count := query.PageRange()
+	if first > 1 {
+		params.Set("page", strconv.Itoa(first))
+	}
+	if count > 1 {
+		params.Set("pages", strconv.Itoa(count))
+	}
+	if len(params) > 0 {
+		key += "?" + params.Encode()
+	}
+	return key
+}
+
+// Stats reports the cache's size and hit rate
+func (sc *SearchCache) Stats(ctx context.Context) (*model.SearchCacheStats, error) {
+	entries, err := sc.repo.CountActiveCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &model.SearchCacheStats{
+		Entries:    entries,
+		Hits:       sc.hits.Load(),
+		Misses:     sc.misses.Load(),
+		TTLSeconds: int64(sc.ttl / time.Second),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats, nil
+}
+
+// StartCleanup removes expired search results until ctx is done
+func (sc *SearchCache) StartCleanup(ctx context.Context) {
+	for {
+		if err := sc.repo.CleanupExpiredCache(ctx); err != nil {
+			log.Printf("Failed to clean up search cache: %v", err)
+		}
+
+		if !sleepContext(ctx, searchCacheCleanupInterval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/akramboussanni/marchive/internal/convert"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/akramboussanni/marchive/internal/storage"
+)
+
+// Eviction policies, chosen with STORAGE_EVICTION_POLICY
+const (
+	// EvictLRU evicts the least recently downloaded books first
+	EvictLRU = "lru"
+	// EvictLeastDownloaded evicts ghost books first, then the least downloaded
+	EvictLeastDownloaded = "least-downloaded"
+)
+
+// StorageLimits caps the bytes kept in storage. A zero CapBytes means no cap.
+type StorageLimits struct {
+	CapBytes int64
+	Policy   string
+}
+
+const evictionBatch = 50
+
+// recordFileSizes fills in the sizes of files stored before sizes were
+// recorded, so usage and the cap account for them
+func (ds *DownloadService) recordFileSizes(ctx context.Context) {
+	books, err := ds.repos.Book.GetBooksMissingSizes(ctx)
+	if err != nil {
+		log.Printf("Failed to load books without recorded sizes: %v", err)
+		return
+	}
+
+	var recorded int
+	for _, book := range books {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if book.FileSize == 0 && book.FilePath != "" && book.Status == model.BookStatusReady {
+			if info, err := ds.store.Stat(ctx, book.FilePath); err == nil {
+				if err := ds.repos.Book.UpdateFileSize(ctx, book.Hash, info.Size); err == nil {
+					recorded++
+				}
+			}
+		}
+
+		if book.CoverSize == 0 && storage.IsStoredCover(book.CoverData) {
+			if info, err := ds.store.Stat(ctx, book.CoverData); err == nil {
+				ds.repos.Book.UpdateCoverSize(ctx, book.Hash, info.Size)
+			}
+		}
+	}
+
+	if recorded > 0 {
+		log.Printf("Recorded file sizes of %d books", recorded)
+	}
+}
+
+// GetStorageUsage adds the cached conversions in store to the usage the
+// database records
+func GetStorageUsage(ctx context.Context, bookRepo *repo.BookRepo, store storage.Storage) (*model.StorageUsage, error) {
+	usage, err := bookRepo.GetStorageUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	derived, err := store.List(ctx, convert.DerivedPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range derived {
+		usage.DerivedBytes += obj.Size
+	}
+	usage.DerivedFiles = len(derived)
+	return usage, nil
+}
+
+// enforceStorageCap brings usage back under the cap. Cached conversions go
+// first, oldest first, since they are made again on request. Then books that
+// can be downloaded again are evicted; they keep their metadata, and
+// requesting one queues a fresh download.
+func (ds *DownloadService) enforceStorageCap(ctx context.Context) {
+	if ds.limits.CapBytes <= 0 {
+		return
+	}
+
+	usage, err := GetStorageUsage(ctx, ds.repos.Book, ds.store)
+	if err != nil {
+		log.Printf("Failed to get storage usage: %v", err)
+		return
+	}
+
+	excess := usage.TotalBytes() - ds.limits.CapBytes
+	if excess <= 0 {
+		return
+	}
+
+	excess -= ds.evictDerived(ctx, excess)
+	if excess <= 0 {
+		return
+	}
+
+	var evicted int
+	var freed int64
+	for excess > 0 && ctx.Err() == nil {
+		candidates, err := ds.repos.Book.GetEvictionCandidates(ctx, ds.limits.Policy == EvictLeastDownloaded, evictionBatch)
+		if err != nil {
+			log.Printf("Failed to get eviction candidates: %v", err)
+			break
+		}
+		if len(candidates) == 0 {
+			log.Printf("Storage is %d bytes over the cap but nothing can be evicted", excess)
+			break
+		}
+
+		progressed := false
+		for _, book := range candidates {
+			if excess <= 0 {
+				break
+			}
+
+			// Flip the row first so nobody is sent to a file that is about to go
+			ok, err := ds.repos.Book.EvictBook(ctx, book.Hash, book.FilePath)
+			if err != nil {
+				log.Printf("Failed to evict book %s: %v", book.Hash, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if err := ds.store.Delete(ctx, book.FilePath); err != nil {
+				log.Printf("Failed to delete evicted file %s: %v", book.FilePath, err)
+			}
+			ds.deleteDerived(ctx, book.Hash)
+
+			progressed = true
+			evicted++
+			freed += book.FileSize
+			excess -= book.FileSize
+		}
+		if !progressed {
+			break
+		}
+	}
+
+	if evicted > 0 {
+		log.Printf("Evicted %d books to stay under the storage cap, freed %d bytes", evicted, freed)
+	}
+}
+
+// evictDerived deletes cached conversions, oldest first, until excess bytes
+// are freed or none are left, and returns the bytes freed
+func (ds *DownloadService) evictDerived(ctx context.Context, excess int64) int64 {
+	derived, err := ds.store.List(ctx, convert.DerivedPrefix)
+	if err != nil {
+		log.Printf("Failed to list converted copies: %v", err)
+		return 0
+	}
+	sort.Slice(derived, func(i, j int) bool {
+		return derived[i].ModTime.Before(derived[j].ModTime)
+	})
+
+	var deleted int
+	var freed int64
+	for _, obj := range derived {
+		if freed >= excess || ctx.Err() != nil {
+			break
+		}
+		if err := ds.store.Delete(ctx, obj.Key); err != nil {
+			log.Printf("Failed to delete converted copy %s: %v", obj.Key, err)
+			continue
+		}
+		deleted++
+		freed += obj.Size
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %d converted copies to stay under the storage cap, freed %d bytes", deleted, freed)
+	}
+	return freed
+}
+
+// deleteDerived removes every cached conversion of a book, which go stale
+// when its file is replaced
+func (ds *DownloadService) deleteDerived(ctx context.Context, hash string) {
+	for _, key := range convert.DerivedKeys(hash) {
+		if err := ds.store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete converted copy %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+//go:build debug
+// +build debug
+
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/anna"
+	"github.com/akramboussanni/marchive/internal/db"
+	"github.com/akramboussanni/marchive/internal/model"
+	"github.com/akramboussanni/marchive/internal/repo"
+	"github.com/akramboussanni/marchive/internal/storage"
+	"github.com/akramboussanni/marchive/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// blockingSource hands out links to url, except that the first download it
+// resolves hangs until cancelled and then until release is closed, so a test
+// can act while a cancelled fetch is still winding down
+type blockingSource struct {
+	url     string
+	started chan struct{}
+	release chan struct{}
+	calls   int
+}
+
+func (s *blockingSource) Search(ctx context.Context, query anna.SearchQuery) ([]*anna.Book, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *blockingSource) Metadata(ctx context.Context, hash string) (*anna.Book, error) {
+	return &anna.Book{Hash: hash, Title: "Dune", Format: "epub"}, nil
+}
+
+func (s *blockingSource) ResolveDownload(ctx context.Context, hash string) (*anna.DownloadLink, error) {
+	s.calls++
+	if s.calls == 1 {
+		close(s.started)
+		<-ctx.Done()
+		<-s.release
+		return nil, ctx.Err()
+	}
+	return &anna.DownloadLink{URL: s.url}, nil
+}
+
+func newTestDownloadService(t *testing.T, source anna.BookSource) (*DownloadService, *repo.Repos) {
+	t.Helper()
+
+	if err := utils.InitSnowflake(1); err != nil {
+		t.Fatalf("init snowflake: %v", err)
+	}
+
+	dir := t.TempDir()
+	conn, err := sqlx.Open("sqlite", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	db.DB = conn
+	db.RunMigrations()
+	repos := repo.NewRepos(conn)
+
+	store, err := storage.NewLocalStorage(filepath.Join(dir, "books"))
+	if err != nil {
+		t.Fatalf("create storage: %v", err)
+	}
+	ds := NewDownloadService(repos, filepath.Join(dir, "downloads"), store, StorageLimits{}, source, 1, nil)
+	t.Cleanup(ds.abortJobs)
+	return ds, repos
+}
+
+// runJob claims jobID and fetches its book in the background, returning a
+// channel closed once the fetch is done
+func runJob(t *testing.T, ds *DownloadService, jobID int64) <-chan struct{} {
+	t.Helper()
+	ctx := context.Background()
+
+	if claimed, err := ds.repos.DownloadJob.ClaimJob(ctx, jobID); err != nil || !claimed {
+		t.Fatalf("claim job %d: %v, %v", jobID, claimed, err)
+	}
+	job, err := ds.repos.DownloadJob.GetJobByID(ctx, jobID)
+	if err != nil {
+		t.Fatalf("get job %d: %v", jobID, err)
+	}
+
+	done := make(chan struct{})
+	task, taskCtx := ds.startTask(ds.jobCtx, job)
+	if task == nil {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		ds.processTask(taskCtx, task)
+		task.cancel()
+	}()
+	return done
+}
+
+func jobStatus(t *testing.T, repos *repo.Repos, jobID int64) string {
+	t.Helper()
+	job, err := repos.DownloadJob.GetJobByID(context.Background(), jobID)
+	if err != nil {
+		t.Fatalf("get job %d: %v", jobID, err)
+	}
+	return job.Status
+}
+
+func TestCancelThenRequestSameBook(t *testing.T) {
+	content := []byte("the spice must flow")
+	sum := md5.Sum(content)
+	hash := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	source := &blockingSource{url: server.URL, started: make(chan struct{}), release: make(chan struct{})}
+	ds, repos := newTestDownloadService(t, source)
+	ctx := context.Background()
+
+	first, err := repos.DownloadJob.CreateJob(ctx, 1, hash)
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	firstDone := runJob(t, ds, first.ID)
+	<-source.started
+
+	// Cancel the only job on the fetch, as HandleCancelJob does
+	if cancelled, err := repos.DownloadJob.CancelJob(ctx, first.ID); err != nil || !cancelled {
+		t.Fatalf("cancel job: %v, %v", cancelled, err)
+	}
+	ds.CancelJob(first.ID)
+
+	// Requested again while the cancelled fetch is still stopping: the new
+	// job must not join it
+	second, err := repos.DownloadJob.CreateJob(ctx, 2, hash)
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	runJob(t, ds, second.ID)
+	if got := jobStatus(t, repos, second.ID); got != model.DownloadStatusPending {
+		t.Errorf("second job is %s while the cancelled fetch stops, want %s", got, model.DownloadStatusPending)
+	}
+
+	close(source.release)
+	<-firstDone
+
+	if got := jobStatus(t, repos, first.ID); got != model.DownloadStatusCancelled {
+		t.Errorf("cancelled job is %s, want %s", got, model.DownloadStatusCancelled)
+	}
+	book, err := repos.Book.GetBookByHash(ctx, hash)
+	if err != nil {
+		t.Fatalf("get book: %v", err)
+	}
+	if book.Status == model.BookStatusProcessing {
+		t.Errorf("book still %s after its fetch was cancelled", book.Status)
+	}
+
+	// The requeued job waits out a short delay; claim it directly
+	secondDone := runJob(t, ds, second.ID)
+	select {
+	case <-secondDone:
+	case <-time.After(10 * time.Second):
+		t.Fatal("second fetch did not finish")
+	}
+
+	if got := jobStatus(t, repos, second.ID); got != model.DownloadStatusCompleted {
+		t.Errorf("second job is %s, want %s", got, model.DownloadStatusCompleted)
+	}
+	book, err = repos.Book.GetBookByHash(ctx, hash)
+	if err != nil {
+		t.Fatalf("get book: %v", err)
+	}
+	if book.Status != model.BookStatusReady {
+		t.Errorf("book is %s after the second fetch, want %s", book.Status, model.BookStatusReady)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/akramboussanni/marchive/internal/model"
+)
+
+// stoppingFetchDelay is how long a job for a book whose cancelled fetch is
+// still winding down waits before it is picked up again
+const stoppingFetchDelay = 5 * time.Second
+
+var errFetchStopping = errors.New("waiting for a cancelled download of this book to stop")
+
+// fetchTask is a single download of a book shared by every job waiting on
+// that book. Jobs that show up while the fetch is running subscribe to it
+// instead of fetching the file again, and all of them finish together.
+type fetchTask struct {
+	hash     string
+	leader   *model.DownloadJob
+	filePath string
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu   sync.Mutex
+	jobs []*model.DownloadJob
+}
+
+// subscribers returns a snapshot of the jobs waiting on the task
+func (t *fetchTask) subscribers() []*model.DownloadJob {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jobs := make([]*model.DownloadJob, len(t.jobs))
+	copy(jobs, t.jobs)
+	return jobs
+}
+
+func (t *fetchTask) subscribe(job *model.DownloadJob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.jobs = append(t.jobs, job)
+}
+
+// unsubscribe removes a job from the task and reports whether it was
+// subscribed and whether any job is left waiting on the task
+func (t *fetchTask) unsubscribe(jobID int64) (found, remaining bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, job := range t.jobs {
+		if job.ID == jobID {
+			t.jobs = append(t.jobs[:i], t.jobs[i+1:]...)
+			return true, len(t.jobs) > 0
+		}
+	}
+	return false, len(t.jobs) > 0
+}
+
+// CancelJob detaches a cancelled job from the fetch it is waiting on. The
+// fetch, and with it the HTTP transfer, is stopped once no job is left
+// waiting on it.
+func (ds *DownloadService) CancelJob(jobID int64) {
+	ds.tasksMu.Lock()
+	defer ds.tasksMu.Unlock()
+
+	for _, task := range ds.tasks {
+		found, remaining := task.unsubscribe(jobID)
+		if !found {
+			continue
+		}
+		if !remaining {
+			log.Printf("Stopping fetch of book %s, every job for it was cancelled", task.hash)
+			task.cancel()
+		}
+		return
+	}
+}
+
+// startTask makes job the leader of a new fetch of its book and returns the
+// context the fetch runs on. If that book is already being fetched the job
+// subscribes to the running task instead and nil is returned. A fetch whose
+// jobs were all cancelled is never joined; the job goes back in the queue
+// until it has stopped.
+func (ds *DownloadService) startTask(ctx context.Context, job *model.DownloadJob) (*fetchTask, context.Context) {
+	ds.tasksMu.Lock()
+
+	if task, ok := ds.tasks[job.BookHash]; ok {
+		if task.ctx.Err() == nil {
+			task.subscribe(job)
+			ds.tasksMu.Unlock()
+			log.Printf("Download job %d joined the running fetch of book %s", job.ID, job.BookHash)
+			return nil, nil
+		}
+		ds.tasksMu.Unlock()
+
+		log.Printf("Download job %d waits for the cancelled fetch of book %s to stop", job.ID, job.BookHash)
+		ds.deferJob(ctx, job, errFetchStopping, time.Now().Add(stoppingFetchDelay))
+		return nil, nil
+	}
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	task := &fetchTask{hash: job.BookHash, leader: job, ctx: taskCtx, cancel: cancel, jobs: []*model.DownloadJob{job}}
+	ds.tasks[job.BookHash] = task
+	ds.tasksMu.Unlock()
+	return task, taskCtx
+}
+
+// finishTask stops the task from taking new subscribers and returns every job
+// that subscribed to it
+func (ds *DownloadService) finishTask(task *fetchTask) []*model.DownloadJob {
+	ds.tasksMu.Lock()
+	if ds.tasks[task.hash] == task {
+		delete(ds.tasks, task.hash)
+	}
+	ds.tasksMu.Unlock()
+
+	return task.subscribers()
+}
+
+// adoptPendingJobs pulls jobs for the same book that are still queued into
+// the task, so they do not wait for a worker of their own
+func (ds *DownloadService) adoptPendingJobs(ctx context.Context, task *fetchTask) {
+	jobs, err := ds.repos.DownloadJob.GetPendingJobsForBook(ctx, task.hash)
+	if err != nil {
+		log.Printf("Failed to get queued jobs for book %s: %v", task.hash, err)
+		return
+	}
+
+	for i := range jobs {
+		claimed, err := ds.repos.DownloadJob.ClaimJob(ctx, jobs[i].ID)
+		if err != nil {
+			log.Printf("Failed to claim job %d: %v", jobs[i].ID, err)
+			continue
+		}
+		if claimed {
+			jobs[i].Status = model.DownloadStatusDownloading
+			jobs[i].Attempts++
+			task.subscribe(&jobs[i])
+			ds.publish(&jobs[i])
+		}
+	}
+}
+
+func (ds *DownloadService) completeTask(ctx context.Context, task *fetchTask, startedAt int64) {
+	for _, job := range ds.finishTask(task) {
+		ds.completeJob(ctx, job, startedAt)
+		if task.filePath != "" {
+			if err := ds.repos.DownloadJob.UpdateJobFilePath(ctx, job.ID, task.filePath); err != nil {
+				log.Printf("Failed to update job file path: %v", err)
+			}
+		}
+	}
+}
+
+func (ds *DownloadService) failTask(ctx context.Context, task *fetchTask, startedAt int64, err error) {
+	// Stopped because every job on it was cancelled: the book is no longer
+	// being processed, so a later request fetches it again
+	if ctx.Err() != nil && ds.jobCtx.Err() == nil {
+		if err := ds.repos.Book.FailBook(context.WithoutCancel(ctx), task.hash); err != nil {
+			log.Printf("Failed to reset book %s after cancelling its fetch: %v", task.hash, err)
+		}
+	}
+
+	for _, job := range ds.finishTask(task) {
+		ds.failJob(ctx, job, startedAt, err)
+	}
+}
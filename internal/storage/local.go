@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStorage keeps objects as files under a root directory
+type LocalStorage struct {
+	root    string
+	absRoot string
+}
+
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if root == "" {
+		return nil, errors.New("storage: local root directory is required")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("storage: failed to create %s: %w", root, err)
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to resolve %s: %w", root, err)
+	}
+	return &LocalStorage{root: filepath.Clean(root), absRoot: absRoot}, nil
+}
+
+// Path returns the file a key is stored in. Books saved before storage keys
+// existed recorded a full path instead; absolute paths and paths that
+// already start with the root are used as they are. Keys that end up
+// outside the root are refused with ErrInvalidKey.
+func (s *LocalStorage) Path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	full := clean
+	if !filepath.IsAbs(clean) && clean != s.root && !strings.HasPrefix(clean, s.root+string(filepath.Separator)) {
+		full = filepath.Join(s.root, clean)
+	}
+
+	abs, err := filepath.Abs(full)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.absRoot, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	return full, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	dest, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// Write next to the destination and rename so readers never see half a file
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (s *LocalStorage) PutFile(ctx context.Context, key, localPath string) error {
+	dest, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	src, err := filepath.Abs(localPath)
+	if err != nil {
+		return err
+	}
+	if absDest, err := filepath.Abs(dest); err == nil && absDest == src {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	// Rename fails across filesystems, fall back to a copy
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := s.Put(ctx, key, f, -1); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := s.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	file, err := s.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a directory", ErrNotExist, key)
+	}
+	return &ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	file, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	dir, err := s.Path(prefix)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]ObjectInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, ObjectInfo{
+			Key:     strings.TrimPrefix(prefix+entry.Name(), "/"),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return objects, nil
+}
+
+func (s *LocalStorage) PresignedURL(ctx context.Context, key string, expiry time.Duration, filename string) (string, error) {
+	return "", ErrPresignNotSupported
+}
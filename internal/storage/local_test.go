@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStoragePath(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "books")
+	s, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	outside := filepath.Join(filepath.Dir(root), "outside.epub")
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"book.epub", filepath.Join(root, "book.epub")},
+		{"uploads/book.epub", filepath.Join(root, "uploads", "book.epub")},
+		{"uploads/../book.epub", filepath.Join(root, "book.epub")},
+		{"", root},
+		// Paths recorded before storage keys
+		{filepath.Join(root, "covers", "a.jpg"), filepath.Join(root, "covers", "a.jpg")},
+		// Outside the root
+		{"../outside.epub", ""},
+		{"uploads/../../outside.epub", ""},
+		{outside, ""},
+		{"/etc/passwd", ""},
+		{root + "-other/book.epub", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := s.Path(tt.key)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Path(%q) = %q, %v, want ErrInvalidKey", tt.key, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Path(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
+
+func TestLocalStorageOutsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(filepath.Join(dir, "books"))
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	ctx := context.Background()
+
+	victim := filepath.Join(dir, "victim.txt")
+	if err := os.WriteFile(victim, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../victim.txt", victim} {
+		if err := s.Put(ctx, key, nil, 0); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.Open(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Open(%q): %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.Stat(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Stat(%q): %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q): %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := s.List(ctx, "../"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("List(../): %v, want ErrInvalidKey", err)
+	}
+
+	if data, err := os.ReadFile(victim); err != nil || string(data) != "keep me" {
+		t.Errorf("file outside the root changed: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotExist is returned, possibly wrapped, when a key has no object
+	ErrNotExist = errors.New("storage: object does not exist")
+	// ErrPresignNotSupported is returned by backends that cannot hand out
+	// direct links; callers serve the object themselves instead
+	ErrPresignNotSupported = errors.New("storage: presigned URLs not supported")
+	// ErrInvalidKey is returned for keys that would reach outside the
+	// backend's root
+	ErrInvalidKey = errors.New("storage: key outside the storage root")
+)
+
+// Key prefixes. Downloaded and uploaded books are stored at the root under
+// their content hash; UploadsPrefix holds books uploaded before that.
+const (
+	UploadsPrefix = "uploads/"
+	CoversPrefix  = "covers/"
+)
+
+// IsStoredCover reports whether a book's cover data names an uploaded cover
+// in storage rather than an image URL. Covers uploaded before storage keys
+// were saved by absolute path.
+func IsStoredCover(coverData string) bool {
+	return strings.HasPrefix(coverData, CoversPrefix) || filepath.IsAbs(coverData)
+}
+
+// Storage is where book files and covers live. Keys are slash separated
+// paths relative to the backend's root, such as "uploads/123.epub".
+type Storage interface {
+	// Put stores size bytes read from r under key. size may be -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// PutFile moves a finished local file into storage under key. The local
+	// file is gone afterwards.
+	PutFile(ctx context.Context, key, localPath string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the objects directly under prefix, not recursing into
+	// deeper "directories"
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// PresignedURL returns a time limited link to download key directly from
+	// the backend, offering filename as the download name
+	PresignedURL(ctx context.Context, key string, expiry time.Duration, filename string) (string, error)
+}
+
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Config selects and configures a storage backend
+type Config struct {
+	Backend   string
+	LocalRoot string
+
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+}
+
+// New builds the storage backend named by cfg.Backend, "local" or "s3"
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocalStorage(cfg.LocalRoot)
+	case "s3":
+		return NewS3Storage(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PathStyle)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (available: local, s3)", cfg.Backend)
+	}
+}
@@ -10,7 +10,18 @@ type contextKey string
 
 const UserKey contextKey = "user"
 
+// TokenScopeKey holds the scope of the personal token a request was
+// authenticated with. Cookie sessions don't set it.
+const TokenScopeKey contextKey = "token-scope"
+
 func UserFromContext(ctx context.Context) (*model.User, bool) {
 	user, ok := ctx.Value(UserKey).(*model.User)
 	return user, ok
 }
+
+// TokenScopeFromContext returns the scope of the personal token used for the
+// request; ok is false for cookie sessions
+func TokenScopeFromContext(ctx context.Context) (string, bool) {
+	scope, ok := ctx.Value(TokenScopeKey).(string)
+	return scope, ok
+}
@@ -53,3 +53,15 @@ func GetRandomToken(bytes uint8) (*model.Token, error) {
 		Hash: base64.URLEncoding.EncodeToString(hashed[:]),
 	}, err
 }
+
+// HashRandomToken hashes the raw form of a token from GetRandomToken, giving
+// the same value as its Hash
+func HashRandomToken(raw string) (string, error) {
+	b, err := base64.URLEncoding.DecodeString(raw)
+	if err != nil {
+		return "", err
+	}
+
+	hashed := sha256.Sum256(b)
+	return base64.URLEncoding.EncodeToString(hashed[:]), nil
+}